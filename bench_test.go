@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -224,3 +225,52 @@ func newRefreshBoth() Cache {
 	})
 	return asyncCache
 }
+
+const (
+	zipfKeys      = 100000
+	zipfTraceLen  = 1 << 20
+	zipfBudget    = 2 * local.MB
+	zipfValueSize = 64
+	// tinyLFUEntryCost is the cost of an entry in TinyLFU: 1 plus ristretto's internal item cost.
+	tinyLFUEntryCost = 1 + 56
+)
+
+// BenchmarkLocalZipf compares the hit ratio and ns/op of the local caches on a Zipf
+// trace, each with the same byte budget. A miss is followed by a Set, as in getBytes.
+func BenchmarkLocalZipf(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.01, 1, zipfKeys-1)
+	trace := make([]string, zipfTraceLen)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("zipf-%06d", zipf.Uint64())
+	}
+	value := make([]byte, zipfValueSize)
+	entries := int(zipfBudget) / (len(trace[0]) + zipfValueSize)
+
+	caches := []struct {
+		name string
+		new  func() local.Local
+	}{
+		{"S3FIFO", func() local.Local { return local.NewS3FIFO(zipfBudget, time.Hour) }},
+		{"LRU", func() local.Local { return local.NewLRU(zipfBudget, time.Hour) }},
+		{"TinyLFU", func() local.Local { return local.NewTinyLFU(entries*tinyLFUEntryCost, time.Hour) }},
+		{"FreeCache", func() local.Local { return local.NewIsolatedFreeCache(zipfBudget, time.Hour) }},
+	}
+	for _, c := range caches {
+		b.Run(c.name, func(b *testing.B) {
+			cache := c.new()
+			var hits int
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := trace[i%len(trace)]
+				if _, ok := cache.Get(key); ok {
+					hits++
+				} else {
+					cache.Set(key, value)
+				}
+			}
+			b.ReportMetric(float64(hits)*100/float64(b.N), "hit%")
+		})
+	}
+}
@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/sync/singleflight"
 
 	"github.com/mgtv-tech/jetcache-go/encoding"
+	"github.com/mgtv-tech/jetcache-go/local"
 	"github.com/mgtv-tech/jetcache-go/logger"
+	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/stats"
 	"github.com/mgtv-tech/jetcache-go/util"
 )
 
@@ -61,13 +65,39 @@ type (
 		Close()
 	}
 
+	// LocalExtender is implemented by the caches created by New. It is kept out of
+	// Cache so that other implementations of Cache do not have to provide it; check
+	// for it with a type assertion.
+	LocalExtender interface {
+		// LocalExtended returns the local cache as local.Extended for admin tooling.
+		// It returns false if there is no local cache or it does not implement local.Extended.
+		LocalExtended() (local.Extended, bool)
+	}
+
+	// EventApplier is implemented by the caches created by New. Like LocalExtender,
+	// it is kept out of Cache; check for it with a type assertion.
+	EventApplier interface {
+		// CacheName returns the name set by WithName, which the events of the cache
+		// carry.
+		CacheName() string
+		// ApplyEvent applies the sync event of another process to the local cache,
+		// deleting its keys or clearing it on flush all. With local sync, it later
+		// drops the values loaded before the event.
+		ApplyEvent(event *Event)
+	}
+
 	jetCache struct {
 		sync.Mutex
 		Options
 		group          singleflight.Group
 		safeRand       *util.SafeRand
 		refreshTaskMap sync.Map
+		events         *eventBuffer
+		versions       *versionTracker
+		extended       stats.ExtendedHandler // statsHandler if it observes latencies, or nil.
+		clock          atomic.Int64
 		eventCh        chan *Event
+		eventDone      chan struct{} // closed when the eventHandler has handled eventCh.
 		stopChan       chan struct{}
 	}
 )
@@ -80,12 +110,16 @@ func New(opts ...Option) Cache {
 		eventCh:  make(chan *Event, o.eventChBufSize),
 		stopChan: make(chan struct{}),
 	}
+	cache.extended = extendedHandler(&o)
 
 	if cache.refreshDuration > 0 {
 		cache.tick()
 	}
 
 	if cache.isSyncLocal() {
+		cache.events = newEventBuffer(&cache.Options)
+		cache.versions = newVersionTracker(cache.eventVersionWindow, maxVersionKeys)
+		cache.startEventFlusher()
 		cache.startEventHandler()
 	}
 
@@ -102,13 +136,16 @@ func (c *jetCache) Set(ctx context.Context, key string, opts ...ItemOption) erro
 }
 
 func (c *jetCache) set(item *item) ([]byte, bool, error) {
+	version := c.version()
+	start := c.startTimer()
 	val, err := item.getValue()
 	if item.do != nil {
+		c.observe(stats.TierLoader, stats.OpLoad, start)
 		c.statsHandler.IncrQuery()
 	}
 
 	if c.IsNotFound(err) {
-		if e := c.setNotFound(item.Context(), item.key, item.skipLocal); e != nil {
+		if e := c.setNotFound(item.Context(), item.key, item.skipLocal, version); e != nil {
 			logger.Error("setNotFound(%s) error(%v)", item.key, err)
 		}
 		return notFoundPlaceholder, true, nil
@@ -123,7 +160,7 @@ func (c *jetCache) set(item *item) ([]byte, bool, error) {
 	}
 
 	if c.local != nil && !item.skipLocal {
-		c.local.Set(item.key, b)
+		c.setLocal(item.key, b, version)
 	}
 
 	if c.remote == nil {
@@ -137,20 +174,26 @@ func (c *jetCache) set(item *item) ([]byte, bool, error) {
 	if ttl == 0 {
 		return b, true, nil
 	}
+	ttl = c.remoteTTL(ttl)
 
-	if item.setXX {
-		_, err := c.remote.SetXX(item.Context(), item.key, b, ttl)
-		return b, true, err
+	start = c.startTimer()
+	switch {
+	case item.setXX:
+		_, err = c.remote.SetXX(item.Context(), item.key, b, ttl)
+	case item.setNX:
+		_, err = c.remote.SetNX(item.Context(), item.key, b, ttl)
+	default:
+		err = c.remote.SetEX(item.Context(), item.key, b, ttl)
 	}
-	if item.setNX {
-		_, err := c.remote.SetNX(item.Context(), item.key, b, ttl)
-		return b, true, err
+	c.observe(stats.TierRemote, stats.OpSet, start)
+	if err == nil {
+		c.addBytesWritten(stats.TierRemote, len(b))
 	}
-	return b, true, c.remote.SetEX(item.Context(), item.key, b, ttl)
+	return b, true, err
 }
 
 func (c *jetCache) Exists(ctx context.Context, key string) bool {
-	_, err := c.getBytes(ctx, key, false)
+	_, _, err := c.getBytes(ctx, key, false)
 	return err == nil
 }
 
@@ -163,59 +206,120 @@ func (c *jetCache) GetSkippingLocal(ctx context.Context, key string, val any) er
 }
 
 func (c *jetCache) get(ctx context.Context, key string, val any, skipLocal bool) error {
-	b, err := c.getBytes(ctx, key, skipLocal)
+	b, payload, err := c.getBytes(ctx, key, skipLocal)
 	if err != nil {
 		return err
 	}
 
-	return c.Unmarshal(b, val)
+	return c.unmarshal(b, payload, val)
 }
 
-func (c *jetCache) getBytes(ctx context.Context, key string, skipLocal bool) ([]byte, error) {
+// getBytes returns the cached value of key. payload is the value without its
+// checksum if getBytes verified it already, or nil otherwise.
+func (c *jetCache) getBytes(ctx context.Context, key string, skipLocal bool) (b, payload []byte, err error) {
 	if !skipLocal && c.local != nil {
-		b, ok := c.local.Get(key)
+		b, ok := c.getLocal(key)
 		if ok {
 			c.statsHandler.IncrHit()
 			c.statsHandler.IncrLocalHit()
 			if bytes.Compare(b, notFoundPlaceholder) == 0 {
-				return nil, c.errNotFound
+				return nil, nil, c.errNotFound
 			}
-			return b, nil
+			return b, nil, nil
 		}
 		c.statsHandler.IncrLocalMiss()
 	}
 
 	if c.remote == nil {
 		if c.local == nil {
-			return nil, ErrRemoteLocalBothNil
+			return nil, nil, ErrRemoteLocalBothNil
 		}
 		c.statsHandler.IncrMiss()
-		return nil, ErrCacheMiss
+		return nil, nil, ErrCacheMiss
 	}
 
+	version := c.version()
+	start := c.startTimer()
 	s, err := c.remote.Get(ctx, key)
+	c.observe(stats.TierRemote, stats.OpGet, start)
 	if err != nil {
 		c.statsHandler.IncrMiss()
 		c.statsHandler.IncrRemoteMiss()
 		if errors.Is(err, c.remote.Nil()) {
-			return nil, ErrCacheMiss
+			return nil, nil, ErrCacheMiss
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	c.statsHandler.IncrHit()
 	c.statsHandler.IncrRemoteHit()
+	c.addBytesRead(stats.TierRemote, len(s))
 
-	b := util.Bytes(s)
+	b = util.Bytes(s)
 	if bytes.Compare(b, notFoundPlaceholder) == 0 {
-		return nil, c.errNotFound
+		return nil, nil, c.errNotFound
 	}
+	b, payload = c.reseal(ctx, key, b)
 
 	if !skipLocal && c.local != nil {
-		c.local.Set(key, b)
+		c.setLocal(key, b, version)
+	}
+
+	return b, payload, nil
+}
+
+// reseal writes back b in the current wire format of its codec, e.g. encrypted with
+// the current key, if b is outdated and both the codec of the cache and that of b,
+// named by its envelope, are an encoding.Resealer. It keeps the remaining TTL of b,
+// and only writes to a remote.TTLKeeper. verified is the returned value without its
+// checksum if reseal verified it, or nil otherwise.
+func (c *jetCache) reseal(ctx context.Context, key string, b []byte) (resealed, verified []byte) {
+	resealer, ok := c.codecInstance.(encoding.Resealer)
+	if !ok {
+		return b, nil
+	}
+
+	var (
+		data = b
+		err  error
+	)
+	if c.checksum != encoding.ChecksumNone {
+		if data, err = encoding.VerifyChecksum(b); err != nil {
+			return b, nil
+		}
+		verified = data
+	}
+	payload := data
+	if c.codecEnvelope {
+		var codec encoding.Codec
+		if codec, payload, err = encoding.Resolve(data, c.codecInstance); err != nil {
+			return b, verified
+		}
+		if resealer, ok = codec.(encoding.Resealer); !ok {
+			return b, verified
+		}
+	}
+
+	resealed, changed, err := resealer.Reseal(payload)
+	if err != nil {
+		logger.Warn("reseal#Reseal(%s) error(%v)", key, err)
+		return b, verified
+	}
+	if !changed {
+		return b, verified
+	}
+	if header := data[:len(data)-len(payload)]; len(header) > 0 {
+		resealed = append(append(make([]byte, 0, len(header)+len(resealed)), header...), resealed...)
+	}
+	if c.checksum != encoding.ChecksumNone {
+		verified = resealed
+	}
+	resealed = encoding.AppendChecksum(c.checksum, resealed)
+	if _, err = remote.SetXXKeepTTL(ctx, c.remote, key, resealed); err != nil && !errors.Is(err, remote.ErrKeepTTLUnsupported) {
+		logger.Warn("reseal#remote.SetXXKeepTTL(%s) error(%v)", key, err)
 	}
 
-	return b, nil
+	return resealed, verified
 }
 
 func (c *jetCache) Once(ctx context.Context, key string, opts ...ItemOption) error {
@@ -223,7 +327,7 @@ func (c *jetCache) Once(ctx context.Context, key string, opts ...ItemOption) err
 
 	c.addOrUpdateRefreshTask(item)
 
-	b, cached, err := c.getSetItemBytesOnce(item)
+	b, payload, cached, err := c.getSetItemBytesOnce(item)
 	if err != nil {
 		return err
 	}
@@ -236,35 +340,78 @@ func (c *jetCache) Once(ctx context.Context, key string, opts ...ItemOption) err
 		return nil
 	}
 
-	if err := c.Unmarshal(b, item.value); err != nil {
-		if cached {
-			_ = c.Delete(ctx, item.key)
-			return c.Once(ctx, key, opts...)
+	for retries := 0; ; retries++ {
+		err = c.unmarshal(b, payload, item.value)
+		if err == nil || !cached || retries >= c.corruptRetries {
+			return err
+		}
+		c.quarantine(ctx, item.key, b, err)
+
+		if b, payload, cached, err = c.getSetItemBytesOnce(item); err != nil {
+			return err
+		}
+		if bytes.Compare(b, notFoundPlaceholder) == 0 {
+			return c.errNotFound
+		}
+		if len(b) == 0 {
+			return nil
+		}
+	}
+}
+
+// quarantine deletes a cached value that failed to decode, after copying it to the
+// quarantine key if it comes from the remote.
+func (c *jetCache) quarantine(ctx context.Context, key string, b []byte, err error) {
+	logger.Warn("cache[%s] quarantine key(%s) value(%d bytes) error(%v)", c.name, key, len(b), err)
+	if h, ok := c.statsHandler.(stats.CorruptionHandler); ok {
+		h.IncrCorrupted()
+	}
+
+	if c.remote != nil {
+		if s, e := c.remote.Get(ctx, key); e == nil && s == string(b) {
+			if e = c.remote.SetEX(ctx, c.quarantineKey(key), b, c.quarantineTTL); e != nil {
+				logger.Warn("quarantine#c.remote.SetEX(%s) error(%v)", key, e)
+			}
 		}
-		return err
 	}
+	_ = c.Delete(ctx, key)
+}
 
-	return nil
+// quarantineKey returns the key of the quarantined copy of the value of key:
+// "<name>:quarantine:<key>", with the separator of the cache, or ":" if disabled.
+func (c *jetCache) quarantineKey(key string) string {
+	sep := c.separator
+	if sep == "" {
+		sep = defaultSeparator
+	}
+	return c.name + sep + quarantineSegment + sep + key
 }
 
-func (c *jetCache) getSetItemBytesOnce(item *item) (b []byte, cached bool, err error) {
+// onceBytes is the result of getSetItemBytesOnce shared by the calls of a singleflight.
+type onceBytes struct {
+	b, payload []byte
+}
+
+// getSetItemBytesOnce returns the cached value of item, loading and setting it on a
+// miss. payload is as returned by getBytes, and cached reports whether b was cached.
+func (c *jetCache) getSetItemBytesOnce(item *item) (b, payload []byte, cached bool, err error) {
 	if !item.skipLocal && c.local != nil {
-		b, ok := c.local.Get(item.key)
+		b, ok := c.getLocal(item.key)
 		if ok {
 			c.statsHandler.IncrHit()
 			c.statsHandler.IncrLocalHit()
 			if bytes.Compare(b, notFoundPlaceholder) == 0 {
-				return nil, true, c.errNotFound
+				return nil, nil, true, c.errNotFound
 			}
-			return b, true, nil
+			return b, nil, true, nil
 		}
 	}
 
-	v, err, _ := c.group.Do(item.key, func() (any, error) {
-		b, err := c.getBytes(item.Context(), item.key, item.skipLocal)
+	v, err, shared := c.group.Do(item.key, func() (any, error) {
+		b, payload, err := c.getBytes(item.Context(), item.key, item.skipLocal)
 		if err == nil {
 			cached = true
-			return b, nil
+			return onceBytes{b: b, payload: payload}, nil
 		} else if errors.Is(err, c.errNotFound) {
 			cached = true
 			return nil, c.errNotFound
@@ -273,17 +420,19 @@ func (c *jetCache) getSetItemBytesOnce(item *item) (b []byte, cached bool, err e
 		b, ok, err := c.set(item)
 		if ok {
 			c.send(EventTypeSetByOnce, item.key)
-			return b, nil
+			return onceBytes{b: b}, nil
 		}
 
 		return nil, err
 	})
+	c.shared(shared)
 
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
-	return v.([]byte), cached, nil
+	ob := v.(onceBytes)
+	return ob.b, ob.payload, cached, nil
 }
 
 func (c *jetCache) Delete(ctx context.Context, key string) error {
@@ -298,7 +447,9 @@ func (c *jetCache) Delete(ctx context.Context, key string) error {
 		return nil
 	}
 
+	start := c.startTimer()
 	_, err := c.remote.Del(ctx, key)
+	c.observe(stats.TierRemote, stats.OpDel, start)
 	if err == nil {
 		c.send(EventTypeDelete, key)
 	}
@@ -320,9 +471,9 @@ func (c *jetCache) IsNotFound(err error) bool {
 	return errors.Is(err, c.errNotFound)
 }
 
-func (c *jetCache) setNotFound(ctx context.Context, key string, skipLocal bool) error {
+func (c *jetCache) setNotFound(ctx context.Context, key string, skipLocal bool, version int64) error {
 	if c.local != nil && !skipLocal {
-		c.local.Set(key, notFoundPlaceholder)
+		c.setLocal(key, notFoundPlaceholder, version)
 	}
 
 	if c.remote == nil {
@@ -332,9 +483,20 @@ func (c *jetCache) setNotFound(ctx context.Context, key string, skipLocal bool)
 		return nil
 	}
 
-	ttl := c.notFoundExpiry + time.Duration(c.safeRand.Int63n(int64(c.offset)))
+	return c.remote.SetEX(ctx, key, notFoundPlaceholder, c.notFoundTTL())
+}
+
+// remoteTTL returns ttl plus a random jitter in [0, remoteOffset).
+func (c *jetCache) remoteTTL(ttl time.Duration) time.Duration {
+	if c.remoteOffset > 0 {
+		ttl += time.Duration(c.safeRand.Int63n(int64(c.remoteOffset)))
+	}
+	return ttl
+}
 
-	return c.remote.SetEX(ctx, key, notFoundPlaceholder, ttl)
+// notFoundTTL returns the ttl of a not-found placeholder, with a random jitter in [0, offset).
+func (c *jetCache) notFoundTTL() time.Duration {
+	return c.notFoundExpiry + time.Duration(c.safeRand.Int63n(int64(c.offset)))
 }
 
 func (c *jetCache) Marshal(val any) ([]byte, error) {
@@ -347,10 +509,29 @@ func (c *jetCache) Marshal(val any) ([]byte, error) {
 		return []byte(val), nil
 	}
 
-	return encoding.GetCodec(c.codec).Marshal(val)
+	var (
+		b   []byte
+		err error
+	)
+	if c.codecEnvelope {
+		b, err = encoding.Seal(c.codecInstance, val)
+	} else {
+		b, err = c.codecInstance.Marshal(val)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return encoding.AppendChecksum(c.checksum, b), nil
 }
 
 func (c *jetCache) Unmarshal(b []byte, val any) error {
+	return c.unmarshal(b, nil, val)
+}
+
+// unmarshal is Unmarshal, decoding payload instead of verifying the checksum of b
+// again if payload is not nil.
+func (c *jetCache) unmarshal(b, payload []byte, val any) error {
 	if len(b) == 0 {
 		return nil
 	}
@@ -368,12 +549,63 @@ func (c *jetCache) Unmarshal(b []byte, val any) error {
 		return nil
 	}
 
-	return encoding.GetCodec(c.codec).Unmarshal(b, val)
+	if payload != nil {
+		return c.decode(payload, val)
+	}
+
+	if c.checksum == encoding.ChecksumNone {
+		// Read the values of caches with a checksum, once b fails to decode.
+		err := c.decode(b, val)
+		if data, e := encoding.VerifyChecksum(b); err != nil && e == nil && len(data) < len(b) {
+			if c.decode(data, val) == nil {
+				return nil
+			}
+		}
+		return err
+	}
+
+	// A wire format can start like a checksum frame: values failing the check are
+	// read as is if they decode.
+	data, err := encoding.VerifyChecksum(b)
+	if err != nil {
+		if c.decode(b, val) == nil {
+			return nil
+		}
+		return err
+	}
+	return c.decode(data, val)
+}
+
+// decode parses the wire format b into val. Only caches with codec envelope look
+// for an envelope first, and fall back to their codec if it fails to open, as a
+// wire format can start like one. Other caches look for it only if their codec
+// fails, to read the values of caches that enabled it.
+func (c *jetCache) decode(b []byte, val any) error {
+	if c.codecEnvelope {
+		err := encoding.Open(b, val, c.codecInstance)
+		if _, _, ok := encoding.Envelope(b); err != nil && ok {
+			if e := c.codecInstance.Unmarshal(b, val); e == nil {
+				return nil
+			}
+		}
+		return err
+	}
+
+	err := c.codecInstance.Unmarshal(b, val)
+	if _, _, ok := encoding.Envelope(b); err != nil && ok {
+		if e := encoding.Open(b, val, c.codecInstance); e == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 func (c *jetCache) Close() {
 	c.stopRefresh()
 	close(c.stopChan)
+	if c.eventDone != nil {
+		<-c.eventDone
+	}
 }
 
 func (c *jetCache) TaskSize() (size int) {
@@ -393,6 +625,17 @@ func (c *jetCache) CacheType() string {
 	return TypeLocal
 }
 
+var _ LocalExtender = (*jetCache)(nil)
+
+func (c *jetCache) LocalExtended() (local.Extended, bool) {
+	if c.local == nil {
+		return nil, false
+	}
+
+	ext, ok := c.local.(local.Extended)
+	return ext, ok
+}
+
 func (c *jetCache) addOrUpdateRefreshTask(item *item) {
 	if c.refreshDuration <= 0 || !item.refresh {
 		return
@@ -496,6 +739,7 @@ func (c *jetCache) externalLoad(ctx context.Context, task *refreshTask, now time
 		if ok {
 			c.send(EventTypeSetByRefresh, task.key)
 		}
+		c.refreshed(err)
 		if err != nil {
 			logger.Error("externalLoad#c.Set(%s) error(%v)", task.key, err)
 			return
@@ -517,18 +761,21 @@ func (c *jetCache) externalLoad(ctx context.Context, task *refreshTask, now time
 func (c *jetCache) load(ctx context.Context, task *refreshTask) {
 	_, _, err := c.set(newItemOptions(ctx, task.key, TTL(task.ttl), Do(task.do), SetXX(task.setXX),
 		SetNX(task.setNX), SkipLocal(task.skipLocal)))
+	c.refreshed(err)
 	if err != nil {
 		logger.Error("load#c.Set(%s) error(%v)", task.key, err)
 	}
 }
 
 func (c *jetCache) refreshLocal(ctx context.Context, task *refreshTask) {
+	version := c.version()
 	val, err := c.remote.Get(ctx, task.key)
+	c.refreshed(err)
 	if err != nil {
 		logger.Error("refreshLocal#c.remote.Get(%s) error(%v)", task.key, err)
 		return
 	}
-	c.local.Set(task.key, util.Bytes(val))
+	c.setLocal(task.key, util.Bytes(val), version)
 }
 
 // isSyncLocal is
@@ -536,48 +783,20 @@ func (c *jetCache) isSyncLocal() bool {
 	return c.syncLocal && c.CacheType() == TypeBoth
 }
 
-func (c *jetCache) send(eventType EventType, keys ...string) {
-	if !c.isSyncLocal() {
-		return
-	}
-
-	defer func() {
-		// recover the panic caused by close eventCh
-		if err := recover(); err != nil {
-			logger.Error("send syncEvent error(%v)", err)
-		}
-	}()
-	select {
-	case c.eventCh <- &Event{
-		CacheName: c.name,
-		SourceID:  c.sourceID,
-		EventType: eventType,
-		Keys:      keys,
-	}:
-	default:
-		logger.Warn("reach max send buffer(%d)", len(c.eventCh))
-	}
-}
-
 func (c *jetCache) startEventHandler() {
 	if c.eventHandler == nil {
 		logger.Warn("cache[%s].syncLocal is true, but eventHandler is nil", c.name)
 		return
 	}
 
+	c.eventDone = make(chan struct{})
 	go util.WithRecover(func() {
-		for {
-			select {
-			case e, ok := <-c.eventCh:
-				if !ok {
-					continue
-				}
-				util.WithRecover(func() {
-					c.eventHandler(e)
-				})
-			case <-c.stopChan:
-				return
-			}
+		defer close(c.eventDone)
+
+		for e := range c.eventCh {
+			util.WithRecover(func() {
+				c.eventHandler(e)
+			})
 		}
 	})
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -15,9 +16,12 @@ import (
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/mgtv-tech/jetcache-go/encoding"
+	"github.com/mgtv-tech/jetcache-go/encoding/encrypt"
+	_ "github.com/mgtv-tech/jetcache-go/encoding/json"
 	"github.com/mgtv-tech/jetcache-go/local"
 	"github.com/mgtv-tech/jetcache-go/logger"
 	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/stats"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/redis/go-redis/v9"
@@ -26,12 +30,13 @@ import (
 var (
 	localId         int32
 	errTestNotFound = errors.New("not found")
-	localTypes      = []localType{tinyLFU, freeCache}
+	localTypes      = []localType{tinyLFU, freeCache, lru}
 )
 
 const (
 	freeCache localType = 1
 	tinyLFU   localType = 2
+	lru       localType = 3
 
 	localExpire                = time.Minute
 	refreshDuration            = time.Second
@@ -93,7 +98,7 @@ var _ = Describe("Cache", func() {
 			}))
 			Expect(err).To(Equal(ErrRemoteLocalBothNil))
 
-			err = nilCache.setNotFound(ctx, "key", false)
+			err = nilCache.setNotFound(ctx, "key", false, 0)
 			Expect(err).To(Equal(ErrRemoteLocalBothNil))
 		})
 
@@ -202,6 +207,25 @@ var _ = Describe("Cache", func() {
 			Expect(n).To(Equal(int64(124)))
 		})
 
+		It("LocalExtended", func() {
+			ext, ok := cache.(LocalExtender).LocalExtended()
+			if cache.CacheType() == TypeRemote {
+				Expect(ok).To(BeFalse())
+				Expect(ext).To(BeNil())
+				return
+			}
+			Expect(ok).To(BeTrue())
+
+			err := cache.Set(ctx, key, Value(obj), TTL(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ext.Len()).To(BeNumerically(">=", 1))
+
+			ext.Clear()
+			Expect(ext.Len()).To(Equal(0))
+			_, ok = ext.Get(key)
+			Expect(ok).To(BeFalse())
+		})
+
 		Describe("Generic Set/Get/MGet/Delete/Exists func", func() {
 			It("cache hit with set first", func() {
 				cacheT := NewT[int, *object](cache)
@@ -353,6 +377,43 @@ var _ = Describe("Cache", func() {
 				}
 			})
 
+			It("jitters remote ttl with remote offset", func() {
+				if rdb == nil {
+					return
+				}
+				jitterCache := New(WithName("jitter"),
+					WithRemote(remote.NewGoRedisV9Adapter(rdb)),
+					WithRemoteExpiry(time.Hour),
+					WithRemoteOffset(time.Hour))
+				cacheT := NewT[int, *object](jitterCache)
+
+				ids := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+				ret := cacheT.MGet(context.Background(), "jitter", ids,
+					func(ctx context.Context, ids []int) (map[int]*object, error) {
+						ret := make(map[int]*object, len(ids))
+						for _, id := range ids {
+							ret[id] = &object{Num: id}
+						}
+						return ret, nil
+					})
+				Expect(ret).To(HaveLen(len(ids)))
+
+				ttls := make(map[time.Duration]struct{})
+				for _, id := range ids {
+					ttl := rdb.TTL(ctx, fmt.Sprintf("jitter:%d", id)).Val()
+					Expect(ttl).To(BeNumerically(">=", time.Hour))
+					Expect(ttl).To(BeNumerically("<", 2*time.Hour))
+					ttls[ttl] = struct{}{}
+				}
+				Expect(len(ttls)).To(BeNumerically(">", 1))
+
+				err := jitterCache.Set(ctx, "jitter:set", Value(obj))
+				Expect(err).NotTo(HaveOccurred())
+				ttl := rdb.TTL(ctx, "jitter:set").Val()
+				Expect(ttl).To(BeNumerically(">=", time.Hour))
+				Expect(ttl).To(BeNumerically("<", 2*time.Hour))
+			})
+
 			It("with returning both the results and any errors", func() {
 				if cache.CacheType() == TypeRemote {
 					codecErrCache := New(WithName("redisError"),
@@ -374,6 +435,73 @@ var _ = Describe("Cache", func() {
 				}
 			})
 
+			It("with hash storage", func() {
+				cacheT := NewT[int, *object](cache, WithHashStorage(4))
+
+				err := cacheT.Set(ctx, "hkey", 1, &object{Str: "str1", Num: 1})
+				Expect(err).NotTo(HaveOccurred())
+				val, err := cacheT.Get(ctx, "hkey", 2, func(ctx context.Context, id int) (*object, error) {
+					return &object{Str: "str2", Num: 2}, nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(val).To(Equal(&object{Str: "str2", Num: 2}))
+
+				ret, err := cacheT.MGetWithErr(ctx, "hkey", []int{1, 2, 3, 4},
+					func(ctx context.Context, ids []int) (map[int]*object, error) {
+						return map[int]*object{3: {Str: "str3", Num: 3}}, nil
+					})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ret).To(Equal(map[int]*object{
+					1: {Str: "str1", Num: 1}, 2: {Str: "str2", Num: 2}, 3: {Str: "str3", Num: 3}}))
+				Expect(cacheT.Exists(ctx, "hkey", 3)).To(BeTrue())
+				Expect(cacheT.Exists(ctx, "hkey", 4)).To(BeFalse())
+
+				if rdb != nil {
+					for _, id := range []int{1, 2, 3, 4} {
+						hashKey, field := cacheT.hashLocation(cache.(*jetCache), "hkey", id)
+						Expect(hashKey).To(HavePrefix("hkey:#"))
+						Expect(rdb.HExists(ctx, hashKey, field).Val()).To(BeTrue())
+						Expect(rdb.Exists(ctx, fmt.Sprintf("hkey:%d", id)).Val()).To(BeZero())
+					}
+				}
+
+				err = cacheT.Delete(ctx, "hkey", 1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cacheT.Exists(ctx, "hkey", 1)).To(BeFalse())
+				if rdb != nil {
+					hashKey, field := cacheT.hashLocation(cache.(*jetCache), "hkey", 1)
+					Expect(rdb.HExists(ctx, hashKey, field).Val()).To(BeFalse())
+				}
+
+				_, err = cacheT.Get(ctx, "hkey", 5, func(ctx context.Context, id int) (*object, error) {
+					return nil, errTestNotFound
+				})
+				Expect(err).To(MatchError(errTestNotFound))
+				_, err = cacheT.Get(ctx, "hkey", 6, func(ctx context.Context, id int) (*object, error) {
+					return nil, errors.New("any")
+				})
+				Expect(err).To(MatchError("any"))
+				if rdb != nil {
+					_, err = cacheT.Get(ctx, "hkey", 7, nil)
+					Expect(err).To(MatchError(ErrCacheMiss))
+				}
+
+				Expect(func() {
+					NewT[int, *object](New(WithRemote(&mockGoRedisMGetMSetErrAdapter{})), WithHashStorage(0))
+				}).To(Panic())
+				// A wrapping remote supports hash storage if the remote it wraps does.
+				Expect(func() {
+					NewT[int, *object](New(WithRemote(remote.NewHedged(remote.NewMemory()))), WithHashStorage(0))
+				}).To(Panic())
+				if rdb != nil {
+					hedged := remote.NewHedged(remote.NewGoRedisV9Adapter(rdb))
+					Expect(NewT[int, *object](New(WithRemote(hedged)), WithHashStorage(0)).hash).To(Equal(hedged))
+				}
+
+				// A Cache other than jetCache, e.g. a wrapper, needs no hash storage check.
+				Expect(NewT[int, *object](struct{ Cache }{cache}).Cache).NotTo(BeNil())
+			})
+
 			It("delete key and not exists", func() {
 				cacheT := NewT[int, *object](cache)
 
@@ -798,35 +926,26 @@ var _ = Describe("Cache", func() {
 				}
 			})
 
-			It("send when eventCh full", func() {
+			It("coalesces sync events", func() {
 				var jetCache = cache.(*jetCache)
 				if !jetCache.isSyncLocal() {
 					return
 				}
 
-				var buf = new(bytes.Buffer)
-				logger.SetDefaultLogger(&testLogger{})
-				log.SetOutput(buf)
-
 				for i := 0; i < testEventChSize+1; i++ {
 					jetCache.send(EventTypeSet, key)
 				}
-				Expect(buf.String()).To(ContainSubstring("reach max send buffer"))
-			})
+				jetCache.send(EventTypeSet, key+"2")
+				jetCache.send(EventTypeDelete, key)
 
-			It("send wend eventCh closed", func() {
-				var jetCache = cache.(*jetCache)
-				if !jetCache.isSyncLocal() {
-					return
-				}
-
-				var buf = new(bytes.Buffer)
-				logger.SetDefaultLogger(&testLogger{})
-				log.SetOutput(buf)
-
-				close(jetCache.eventCh)
-				jetCache.send(EventTypeSet, key)
-				Expect(buf.String()).To(ContainSubstring("send syncEvent error(send on closed channel)"))
+				e, ok := <-jetCache.eventCh
+				Expect(ok).To(BeTrue())
+				Expect(e.EventType).To(Equal(EventTypeSet))
+				Expect(e.Keys).To(Equal([]string{key, key + "2"}))
+				e, ok = <-jetCache.eventCh
+				Expect(ok).To(BeTrue())
+				Expect(e.EventType).To(Equal(EventTypeDelete))
+				Expect(e.Keys).To(Equal([]string{key}))
 			})
 		})
 	}
@@ -887,6 +1006,624 @@ var _ = Describe("Cache", func() {
 	})
 })
 
+var _ = Describe("Sync events", func() {
+	newBuffer := func(policy EventOverflowPolicy) *eventBuffer {
+		o := newOptions(WithEventMaxPending(2), WithEventOverflowPolicy(policy), WithEventBlockTimeout(50*time.Millisecond))
+		return newEventBuffer(&o)
+	}
+
+	It("drops the oldest keys on overflow", func() {
+		b := newBuffer(EventOverflowDropOldest)
+		dropped, coalesced := b.add(EventTypeSet, []string{"k1", "k2", "k1", "k3"})
+		Expect(dropped).To(Equal(uint64(1)))
+		Expect(coalesced).To(Equal(uint64(1)))
+		Expect(b.take()).To(Equal([]*Event{{EventType: EventTypeSet, Keys: []string{"k2", "k3"}}}))
+		Expect(b.take()).To(BeEmpty())
+	})
+
+	It("blocks on overflow until the keys are taken", func() {
+		b := newBuffer(EventOverflowBlock)
+		b.add(EventTypeSet, []string{"k1", "k2"})
+
+		start := time.Now()
+		dropped, _ := b.add(EventTypeDelete, []string{"k3"})
+		Expect(dropped).To(Equal(uint64(1)))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			b.take()
+		}()
+		dropped, _ = b.add(EventTypeDelete, []string{"k3"})
+		Expect(dropped).To(BeZero())
+		Expect(b.take()).To(Equal([]*Event{{EventType: EventTypeDelete, Keys: []string{"k3"}}}))
+	})
+
+	It("collapses to flush all on overflow", func() {
+		b := newBuffer(EventOverflowFlushAll)
+		dropped, coalesced := b.add(EventTypeSet, []string{"k1", "k2", "k3"})
+		Expect(dropped).To(BeZero())
+		Expect(coalesced).To(Equal(uint64(3)))
+		b.add(EventTypeDelete, []string{"k4"})
+		Expect(b.take()).To(Equal([]*Event{{EventType: EventTypeFlushAll}}))
+
+		b.add(EventTypeDelete, []string{"k4"})
+		Expect(b.take()).To(Equal([]*Event{{EventType: EventTypeDelete, Keys: []string{"k4"}}}))
+	})
+
+	It("delivers coalesced events and counts dropped keys", func() {
+		var buf = new(bytes.Buffer)
+		logger.SetDefaultLogger(&testLogger{})
+		log.SetOutput(buf)
+
+		var (
+			mu     sync.Mutex
+			events []*Event
+		)
+		handler := &testEventStats{}
+		cache := New(WithName("events"),
+			WithLocal(local.NewLRU(local.MB, time.Minute)),
+			WithRemote(remote.NewMemory()),
+			WithSyncLocal(true),
+			WithStatsHandler(handler),
+			WithEventWindow(time.Hour),
+			WithEventMaxPending(3),
+			WithEventHandler(func(event *Event) {
+				mu.Lock()
+				events = append(events, event)
+				mu.Unlock()
+			}))
+
+		for i := 0; i < 3; i++ {
+			Expect(cache.Set(context.Background(), "k1", Value("v1"))).To(Succeed())
+		}
+		for _, key := range []string{"k2", "k3", "k4"} {
+			Expect(cache.Delete(context.Background(), key)).To(Succeed())
+		}
+		Expect(handler.coalesced.Load()).To(Equal(uint64(2)))
+		Expect(handler.dropped.Load()).To(Equal(uint64(1)))
+		Expect(buf.String()).To(ContainSubstring("reach max pending sync event keys(3), dropped(1)"))
+
+		// Close delivers the keys pending in the window.
+		cache.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].CacheName).To(Equal("events"))
+		Expect(events[0].EventType).To(Equal(EventTypeDelete))
+		Expect(events[0].Keys).To(Equal([]string{"k2", "k3", "k4"}))
+	})
+
+	It("delivers every pending key on Close, one event at a time", func() {
+		var (
+			running, overlaps atomic.Int32
+			mu                sync.Mutex
+			keys              []string
+		)
+		cache := New(WithName("events"),
+			WithLocal(local.NewLRU(local.MB, time.Minute)),
+			WithRemote(remote.NewMemory()),
+			WithSyncLocal(true),
+			WithEventWindow(time.Millisecond),
+			WithEventChBufSize(1),
+			WithEventHandler(func(event *Event) {
+				if running.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				keys = append(keys, event.Keys...)
+				mu.Unlock()
+				running.Add(-1)
+			}))
+
+		for i := 0; i < 20; i++ {
+			Expect(cache.Delete(context.Background(), fmt.Sprintf("k%d", i))).To(Succeed())
+			time.Sleep(time.Millisecond)
+		}
+		cache.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(keys).To(HaveLen(20))
+		Expect(overlaps.Load()).To(BeZero())
+	})
+
+	Context("Versions", func() {
+		var jc *jetCache
+
+		BeforeEach(func() {
+			jc = New(WithName("versions"),
+				WithLocal(local.NewLRU(local.MB, time.Minute)),
+				WithRemote(remote.NewMemory()),
+				WithSyncLocal(true),
+				WithEventWindow(time.Hour),
+				WithEventHandler(func(event *Event) {})).(*jetCache)
+		})
+
+		AfterEach(func() {
+			jc.Close()
+		})
+
+		It("versions the events", func() {
+			before := time.Now().UnixNano()
+			Expect(jc.Delete(context.Background(), "k1")).To(Succeed())
+			events := jc.takeEvents()
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Version).To(BeNumerically(">=", before))
+		})
+
+		It("applies invalidations older than the local value", func() {
+			// The clock of the other process may lag behind.
+			skewed := time.Now().Add(-time.Minute).UnixNano()
+			Expect(jc.Set(context.Background(), "k1", Value("v1"))).To(Succeed())
+
+			jc.ApplyEvent(&Event{CacheName: "versions", SourceID: "other", EventType: EventTypeSet, Keys: []string{"k1"}, Version: skewed})
+			_, ok := jc.local.Get("k1")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("always applies invalidations without version", func() {
+			Expect(jc.Set(context.Background(), "k1", Value("v1"))).To(Succeed())
+			jc.ApplyEvent(&Event{CacheName: "versions", SourceID: "other", EventType: EventTypeDelete, Keys: []string{"k1"}})
+			_, ok := jc.local.Get("k1")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("drops values loaded before the last invalidation", func() {
+			// A refresh reads the remote, then an invalidation of another process
+			// arrives before the refresh writes the local value.
+			loaded := jc.version()
+			jc.ApplyEvent(&Event{CacheName: "versions", SourceID: "other", EventType: EventTypeSetByRefresh, Keys: []string{"k1"}, Version: time.Now().UnixNano()})
+			jc.setLocal("k1", []byte("stale"), loaded)
+			_, ok := jc.local.Get("k1")
+			Expect(ok).To(BeFalse())
+
+			jc.setLocal("k1", []byte("fresh"), jc.version())
+			_, ok = jc.local.Get("k1")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("bounds the versions kept", func() {
+			t := newVersionTracker(time.Hour, versionShards)
+			for i := 0; i < 10*versionShards; i++ {
+				t.apply(strconv.Itoa(i), int64(i+1), func() {})
+			}
+			for i := range t.shards {
+				Expect(len(t.shards[i].events)).To(BeNumerically("<=", 1))
+			}
+
+			// Entries loaded before a forgotten version stay unwritten.
+			for i := 0; i < 10*versionShards; i++ {
+				Expect(t.set(strconv.Itoa(i), int64(i), func() {})).To(BeFalse())
+			}
+			Expect(t.set("0", int64(10*versionShards), func() {})).To(BeTrue())
+		})
+
+		It("drops values loaded before the last flush all", func() {
+			loaded := jc.version()
+			jc.ApplyEvent(&Event{CacheName: "versions", SourceID: "other", EventType: EventTypeFlushAll, Version: time.Now().UnixNano()})
+			jc.setLocal("k1", []byte("stale"), loaded)
+			_, ok := jc.local.Get("k1")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("ApplyEvent without sync", func() {
+	It("clears the local cache on flush all", func() {
+		cache := New(WithName("apply"),
+			WithLocal(local.NewLRU(local.MB, time.Minute)),
+			WithRemote(remote.NewMemory()))
+		defer cache.Close()
+
+		Expect(cache.Set(context.Background(), "k1", Value("v1"))).To(Succeed())
+		local, ok := cache.(LocalExtender).LocalExtended()
+		Expect(ok).To(BeTrue())
+		_, ok = local.Get("k1")
+		Expect(ok).To(BeTrue())
+
+		cache.(EventApplier).ApplyEvent(&Event{CacheName: "apply", SourceID: "other", EventType: EventTypeFlushAll})
+		_, ok = local.Get("k1")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Codec envelope", func() {
+	It("reads values of another codec", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		msgpackCache := New(WithName("envelope"), WithRemote(rds), WithCodecEnvelope(true))
+		defer msgpackCache.Close()
+		jsonCache := New(WithName("envelope"), WithRemote(rds), WithCodec("json"), WithCodecEnvelope(true))
+		defer jsonCache.Close()
+
+		Expect(msgpackCache.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		name, _, ok := encoding.Envelope([]byte(b))
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("msgpack"))
+
+		var got object
+		Expect(jsonCache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+
+		Expect(jsonCache.Set(ctx, "k2", Value(&object{Str: "v2", Num: 2}))).To(Succeed())
+		Expect(msgpackCache.Get(ctx, "k2", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v2", Num: 2}))
+	})
+
+	It("reads values without envelope with its codec", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		legacy := New(WithName("envelope"), WithRemote(rds))
+		defer legacy.Close()
+		cache := New(WithName("envelope"), WithRemote(rds), WithCodecEnvelope(true))
+		defer cache.Close()
+
+		Expect(legacy.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		var got object
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+	})
+
+	It("reads values without envelope starting with its magic byte", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		legacy := New(WithName("envelope"), WithRemote(rds))
+		defer legacy.Close()
+		cache := New(WithName("envelope"), WithRemote(rds), WithCodecEnvelope(true))
+		defer cache.Close()
+
+		// The s2 block of 193 bytes of msgpack starts with 0xc1 0x01.
+		want := []string{s2Prefixed(190)}
+		Expect(legacy.Set(ctx, "k1", Value(&want))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]byte(b[:2])).To(Equal([]byte{0xc1, 0x01}))
+
+		var got []string
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(want))
+	})
+
+	It("falls back to its codec for values starting like an envelope", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		legacy := New(WithName("envelope"), WithRemote(rds), WithCodecInstance(rawCodec{}))
+		defer legacy.Close()
+		cache := New(WithName("envelope"), WithRemote(rds), WithCodecInstance(rawCodec{}), WithCodecEnvelope(true))
+		defer cache.Close()
+
+		// A wire format of the codec that is an envelope naming an unknown codec.
+		want, err := encoding.Seal(&namedCodec{Codec: rawCodec{}, name: "unknown"}, &rawValue{B: []byte("v1")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(legacy.Set(ctx, "k1", Value(&rawValue{B: want}))).To(Succeed())
+
+		var got rawValue
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got.B).To(Equal(want))
+	})
+
+	It("does not look for an envelope when disabled", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		cache := New(WithName("envelope"), WithRemote(rds))
+		defer cache.Close()
+
+		// The s2 block of 193 bytes of msgpack starts with 0xc1 0x01.
+		want := []string{s2Prefixed(190)}
+		Expect(cache.Set(ctx, "k1", Value(&want))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]byte(b[:2])).To(Equal([]byte{0xc1, 0x01}))
+
+		var got []string
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(want))
+	})
+
+	It("reads enveloped values when disabled", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		jsonCache := New(WithName("envelope"), WithRemote(rds), WithCodec("json"), WithCodecEnvelope(true))
+		defer jsonCache.Close()
+		cache := New(WithName("envelope"), WithRemote(rds))
+		defer cache.Close()
+
+		Expect(jsonCache.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		var got object
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+	})
+})
+
+var _ = Describe("Codec instance", func() {
+	It("uses its own codec instance", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		c1 := &namedCodec{Codec: encoding.GetCodec("json"), name: "json"}
+		c2 := &namedCodec{Codec: encoding.GetCodec("json"), name: "json"}
+		cache1 := New(WithName("instance"), WithRemote(rds), WithCodecInstance(c1), WithCodecEnvelope(true))
+		defer cache1.Close()
+		cache2 := New(WithName("instance"), WithRemote(rds), WithCodecInstance(c2), WithCodecEnvelope(true))
+		defer cache2.Close()
+
+		Expect(cache1.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		Expect(cache2.Set(ctx, "k2", Value(&object{Str: "v2", Num: 2}))).To(Succeed())
+		Expect(cache2.Set(ctx, "k3", Value(&object{Str: "v3", Num: 3}))).To(Succeed())
+		Expect(c1.marshal.Load()).To(Equal(int64(1)))
+		Expect(c2.marshal.Load()).To(Equal(int64(2)))
+
+		var got object
+		Expect(cache1.Get(ctx, "k2", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v2", Num: 2}))
+	})
+})
+
+var _ = Describe("Checksum", func() {
+	var (
+		ctx     context.Context
+		rds     *remote.Memory
+		handler *testCorruptionStats
+		cache   Cache
+		loads   int
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		rds = remote.NewMemory()
+		handler = &testCorruptionStats{Handler: stats.NewStatsLogger("checksum")}
+		loads = 0
+	})
+
+	AfterEach(func() {
+		cache.Close()
+	})
+
+	once := func(val any) error {
+		return cache.Once(ctx, "k1", Value(val), Do(func(context.Context) (any, error) {
+			loads++
+			return &object{Str: "v1", Num: 1}, nil
+		}))
+	}
+
+	It("reloads and quarantines corrupted values", func() {
+		cache = New(WithName("checksum"), WithRemote(rds), WithStatsHandler(handler), WithChecksum(encoding.ChecksumCRC32C))
+		Expect(cache.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b).To(HavePrefix("\xc1\x00jc\x81"))
+
+		corrupted := []byte(b)
+		corrupted[len(corrupted)-1] ^= 0xff
+		Expect(rds.SetEX(ctx, "k1", corrupted, time.Minute)).To(Succeed())
+
+		var got object
+		Expect(cache.Get(ctx, "k1", &got)).To(MatchError(encoding.ErrChecksum))
+
+		Expect(once(&got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+		Expect(loads).To(Equal(1))
+		Expect(handler.corrupted.Load()).To(Equal(uint64(1)))
+
+		quarantined, err := rds.Get(ctx, "checksum:quarantine:k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quarantined).To(Equal(string(corrupted)))
+
+		b, err = rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = encoding.VerifyChecksum([]byte(b))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("bounds the reloads", func() {
+		cache = New(WithName("checksum"), WithRemote(rds), WithStatsHandler(handler), WithCodec(mockUnmarshalErr))
+		Expect(cache.Set(ctx, "k1", Value("v1"))).To(Succeed())
+
+		var got object
+		Expect(once(&got)).To(HaveOccurred())
+		Expect(loads).To(Equal(1))
+		Expect(handler.corrupted.Load()).To(Equal(uint64(1)))
+	})
+
+	It("does not verify values when disabled", func() {
+		cache = New(WithName("checksum"), WithRemote(rds), WithStatsHandler(handler))
+		// The s2 block of 16577 bytes of msgpack starts with 0xc1 0x81.
+		want := []string{s2Prefixed(16573)}
+		Expect(cache.Set(ctx, "k1", Value(&want))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b[:2]).To(Equal("\xc1\x81"))
+
+		var got []string
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(want))
+
+		checked := New(WithName("checksum"), WithRemote(rds), WithChecksum(encoding.ChecksumCRC32C))
+		defer checked.Close()
+		got = nil
+		Expect(checked.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(want))
+		Expect(handler.corrupted.Load()).To(BeZero())
+	})
+
+	It("reads values with checksum when disabled", func() {
+		cache = New(WithName("checksum"), WithRemote(rds))
+		checked := New(WithName("checksum"), WithRemote(rds), WithChecksum(encoding.ChecksumXXHash))
+		defer checked.Close()
+		Expect(checked.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+
+		var got object
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+	})
+
+	It("reads values without checksum", func() {
+		cache = New(WithName("checksum"), WithRemote(rds), WithStatsHandler(handler), WithChecksum(encoding.ChecksumXXHash))
+		legacy := New(WithName("checksum"), WithRemote(rds))
+		defer legacy.Close()
+		Expect(legacy.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+
+		var got object
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+		Expect(once(&got)).To(Succeed())
+		Expect(loads).To(BeZero())
+	})
+})
+
+var _ = Describe("Reseal", func() {
+	BeforeEach(func() {
+		json := encoding.GetCodec("json")
+		key1, key2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+		encoding.RegisterCodec(encrypt.New(json, encrypt.NewStaticKeys("k1", map[string][]byte{"k1": key1}), encrypt.WithName("pii-k1")))
+		encoding.RegisterCodec(encrypt.New(json, encrypt.NewStaticKeys("k2", map[string][]byte{"k1": key1, "k2": key2}), encrypt.WithName("pii-k2")))
+	})
+
+	It("re-encrypts values of a retired key on read", func() {
+		ctx := context.Background()
+		rds := remote.NewMemory()
+		old := New(WithName("reseal"), WithRemote(rds), WithCodec("pii-k1"))
+		defer old.Close()
+		rotated := New(WithName("reseal"), WithRemote(rds), WithCodec("pii-k2"))
+		defer rotated.Close()
+
+		Expect(old.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}))).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b[:4]).To(Equal("\x01\x02k1"))
+
+		var got object
+		Expect(rotated.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+		b, err = rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b[:4]).To(Equal("\x01\x02k2"))
+
+		got = object{}
+		Expect(rotated.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(got).To(Equal(object{Str: "v1", Num: 1}))
+	})
+
+	It("keeps the remaining TTL", func() {
+		ctx := context.Background()
+		s := miniredis.RunT(GinkgoT())
+		rds := remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s.Addr()}))
+		old := New(WithName("reseal"), WithRemote(rds), WithCodec("pii-k1"))
+		defer old.Close()
+		rotated := New(WithName("reseal"), WithRemote(rds), WithCodec("pii-k2"))
+		defer rotated.Close()
+
+		Expect(old.Set(ctx, "k1", Value(&object{Str: "v1", Num: 1}), TTL(time.Minute))).To(Succeed())
+		ttl := s.TTL("k1")
+
+		var got object
+		Expect(rotated.Get(ctx, "k1", &got)).To(Succeed())
+		b, err := rds.Get(ctx, "k1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b[:4]).To(Equal("\x01\x02k2"))
+		Expect(s.TTL("k1")).To(Equal(ttl))
+	})
+})
+
+var _ = Describe("Extended stats", func() {
+	var (
+		ctx     context.Context
+		handler *stats.Stats
+		cache   Cache
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		handler = stats.NewStatsLogger("extended").(*stats.Stats)
+		cache = New(WithName("extended"), WithRemote(remote.NewMemory()), WithLocal(localNew(tinyLFU)),
+			WithStatsHandler(handler))
+	})
+
+	AfterEach(func() {
+		cache.Close()
+	})
+
+	It("observes latencies and bytes per tier", func() {
+		var got object
+		Expect(cache.Once(ctx, "k1", Value(&got), Do(func(context.Context) (any, error) {
+			return &object{Str: "v1", Num: 1}, nil
+		}))).To(Succeed())
+		Expect(cache.Get(ctx, "k1", &got)).To(Succeed())
+		Expect(cache.GetSkippingLocal(ctx, "k1", &got)).To(Succeed())
+		Expect(cache.Delete(ctx, "k1")).To(Succeed())
+
+		Expect(handler.Latency(stats.TierLoader, stats.OpLoad).Count).To(Equal(uint64(1)))
+		Expect(handler.Latency(stats.TierRemote, stats.OpGet).Count).To(Equal(uint64(2)))
+		Expect(handler.Latency(stats.TierRemote, stats.OpSet).Count).To(Equal(uint64(1)))
+		Expect(handler.Latency(stats.TierRemote, stats.OpDel).Count).To(Equal(uint64(1)))
+		Expect(handler.Latency(stats.TierLocal, stats.OpGet).Count).To(Equal(uint64(3)))
+
+		size := handler.BytesWritten[stats.TierRemote]
+		Expect(size).To(BeNumerically(">", 0))
+		Expect(handler.BytesWritten[stats.TierLocal]).To(Equal(size))
+		Expect(handler.BytesRead[stats.TierLocal]).To(Equal(size))
+		Expect(handler.BytesRead[stats.TierRemote]).To(Equal(size))
+	})
+
+	It("does not observe with stats disabled", func() {
+		disabled := New(WithName("extended"), WithRemote(remote.NewMemory()), WithStatsDisabled(true))
+		defer disabled.Close()
+		Expect(disabled.(*jetCache).extended).To(BeNil())
+
+		custom := New(WithName("extended"), WithRemote(remote.NewMemory()),
+			WithStatsHandler(stats.NewHandles(false, &testEventStats{})))
+		defer custom.Close()
+		Expect(custom.(*jetCache).extended).To(BeNil())
+
+		Expect(cache.(*jetCache).extended).NotTo(BeNil())
+	})
+
+	It("counts refreshes and shared loads", func() {
+		jc := cache.(*jetCache)
+		task := newItemOptions(ctx, "k1", Do(func(context.Context) (any, error) {
+			return "v1", nil
+		})).toRefreshTask()
+		jc.load(ctx, task)
+		task.do = func(context.Context) (any, error) {
+			return nil, context.DeadlineExceeded
+		}
+		jc.load(ctx, task)
+		Expect(handler.Refresh).To(Equal(uint64(1)))
+		Expect(handler.RefreshFail).To(Equal(uint64(1)))
+		Expect(handler.QueryFailClass[stats.ErrorTimeout]).To(Equal(uint64(1)))
+
+		var (
+			wg      sync.WaitGroup
+			started = make(chan struct{})
+			release = make(chan struct{})
+		)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				var got string
+				Expect(cache.Once(ctx, "k2", Value(&got), Do(func(context.Context) (any, error) {
+					close(started)
+					<-release
+					return "v2", nil
+				}))).To(Succeed())
+			}()
+			if i == 0 {
+				<-started
+			}
+		}
+		// Let the second caller join the pending load.
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		Expect(handler.Shared).To(Equal(uint64(2)))
+	})
+})
+
 func newRdb() *redis.Client {
 	s, err := miniredis.Run()
 	if err != nil {
@@ -927,7 +1664,9 @@ func newBoth(rds *redis.Client, localType localType, syncLocal ...bool) Cache {
 
 func localNew(localType localType) local.Local {
 	if localType == tinyLFU {
-		return local.NewTinyLFU(100000, localExpire)
+		return local.NewIndexedTinyLFU(100000, localExpire)
+	} else if localType == lru {
+		return local.NewLRU(256*local.MB, localExpire)
 	} else {
 		id := atomic.AddInt32(&localId, 1)
 		return local.NewFreeCache(256*local.MB, localExpire, strconv.Itoa(int(id)))
@@ -1010,6 +1749,62 @@ func (m mockGoRedisMGetMSetErrAdapter) Nil() error {
 	panic("implement me")
 }
 
+// s2Prefixed returns a string of n bytes, s2 compressing to literals past its head,
+// so that the msgpack codec writes the uvarint of its encoded length first.
+func s2Prefixed(n int) string {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("a", 32))
+	for i := 1; b.Len() < n; i++ {
+		b.WriteString(strconv.Itoa(i * i * 7919))
+	}
+	return b.String()[:n]
+}
+
+// rawCodec stores the bytes of a *rawValue as is, so they may start like an
+// envelope.
+type rawCodec struct{}
+
+type rawValue struct {
+	B []byte
+}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	return v.(*rawValue).B, nil
+}
+
+func (rawCodec) Unmarshal(b []byte, v any) error {
+	v.(*rawValue).B = append([]byte(nil), b...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "raw"
+}
+
+// testEventStats is a stats.Handler counting the keys of sync events.
+type testEventStats struct {
+	stats.Handler
+	dropped   atomic.Uint64
+	coalesced atomic.Uint64
+}
+
+func (s *testEventStats) IncrEventDropped(n uint64) {
+	s.dropped.Add(n)
+}
+
+func (s *testEventStats) IncrEventCoalesced(n uint64) {
+	s.coalesced.Add(n)
+}
+
+type testCorruptionStats struct {
+	stats.Handler
+	corrupted atomic.Uint64
+}
+
+func (s *testCorruptionStats) IncrCorrupted() {
+	s.corrupted.Add(1)
+}
+
 type testLogger struct{}
 
 func (l *testLogger) Debug(format string, v ...any) {
@@ -0,0 +1,428 @@
+package cache
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/local"
+	"github.com/mgtv-tech/jetcache-go/logger"
+	"github.com/mgtv-tech/jetcache-go/stats"
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+type (
+	// eventBuffer holds the keys of sync events until they are delivered, each key
+	// once per EventType.
+	eventBuffer struct {
+		mu       sync.Mutex
+		pending  []pendingEvent
+		index    map[pendingEvent]struct{}
+		flushAll bool
+		ready    chan struct{} // signals the flusher that keys are pending.
+		space    chan struct{} // closed when the pending keys are taken, to wake blocked writes.
+
+		maxPending   int
+		policy       EventOverflowPolicy
+		blockTimeout time.Duration
+	}
+
+	pendingEvent struct {
+		eventType EventType
+		key       string
+	}
+
+	// versionTracker remembers, for a window, the versions of the events received, so
+	// that an entry loaded before an event on its key is not written to the local
+	// cache. Keys are spread over shards, each holding at most maxKeys versions.
+	versionTracker struct {
+		window  int64
+		maxKeys int
+		shards  [versionShards]versionShard
+	}
+
+	versionShard struct {
+		mu     sync.Mutex
+		events map[string]int64
+		floor  int64 // entries loaded before are stale on every key: flush all, or versions forgotten on overflow.
+		swept  int64
+	}
+)
+
+const (
+	versionShards = 64
+	// maxVersionKeys bounds the event versions kept by a versionTracker.
+	maxVersionKeys = 1 << 16
+)
+
+func newEventBuffer(o *Options) *eventBuffer {
+	return &eventBuffer{
+		index:        make(map[pendingEvent]struct{}),
+		ready:        make(chan struct{}, 1),
+		space:        make(chan struct{}),
+		maxPending:   o.eventMaxPending,
+		policy:       o.eventOverflowPolicy,
+		blockTimeout: o.eventBlockTimeout,
+	}
+}
+
+// add adds keys to the pending keys, and returns the number of keys dropped and
+// coalesced with a pending key.
+func (b *eventBuffer) add(eventType EventType, keys []string) (dropped, coalesced uint64) {
+	var deadline time.Time
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+keys:
+	for _, key := range keys {
+		e := pendingEvent{eventType: eventType, key: key}
+		if _, ok := b.index[e]; ok || b.flushAll {
+			coalesced++
+			continue
+		}
+
+		for len(b.pending) >= b.maxPending && !b.flushAll {
+			switch b.policy {
+			case EventOverflowBlock:
+				if deadline.IsZero() {
+					deadline = time.Now().Add(b.blockTimeout)
+				}
+				if !b.wait(deadline) {
+					dropped++
+					continue keys
+				}
+			case EventOverflowFlushAll:
+				coalesced += uint64(len(b.pending))
+				b.reset()
+				b.flushAll = true
+			default:
+				delete(b.index, b.pending[0])
+				b.pending = b.pending[1:]
+				dropped++
+			}
+		}
+		if b.flushAll {
+			coalesced++
+			continue
+		}
+
+		b.pending = append(b.pending, e)
+		b.index[e] = struct{}{}
+	}
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+
+	return
+}
+
+// wait releases b.mu until the pending keys are taken or the deadline passes, and
+// reports whether they were taken. b.mu must be held.
+func (b *eventBuffer) wait(deadline time.Time) bool {
+	d := time.Until(deadline)
+	if d <= 0 {
+		return false
+	}
+
+	space := b.space
+	b.mu.Unlock()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-space:
+	case <-timer.C:
+	}
+	b.mu.Lock()
+
+	return len(b.pending) < b.maxPending
+}
+
+// take returns the pending keys as one Event per EventType, in the order of their
+// first key, and empties the buffer.
+func (b *eventBuffer) take() []*Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []*Event
+	if b.flushAll {
+		events = []*Event{{EventType: EventTypeFlushAll}}
+	} else {
+		byType := make(map[EventType]*Event)
+		for _, e := range b.pending {
+			event, ok := byType[e.eventType]
+			if !ok {
+				event = &Event{EventType: e.eventType}
+				byType[e.eventType] = event
+				events = append(events, event)
+			}
+			event.Keys = append(event.Keys, e.key)
+		}
+	}
+	b.reset()
+
+	close(b.space)
+	b.space = make(chan struct{})
+
+	return events
+}
+
+// reset empties the buffer. b.mu must be held.
+func (b *eventBuffer) reset() {
+	b.pending = nil
+	b.index = make(map[pendingEvent]struct{})
+	b.flushAll = false
+}
+
+func newVersionTracker(window time.Duration, maxKeys int) *versionTracker {
+	t := &versionTracker{
+		window:  int64(window),
+		maxKeys: max(maxKeys/versionShards, 1),
+	}
+	now := time.Now().UnixNano()
+	for i := range t.shards {
+		t.shards[i].events = make(map[string]int64)
+		t.shards[i].swept = now
+	}
+	return t
+}
+
+func (t *versionTracker) shard(key string) *versionShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &t.shards[h.Sum32()%versionShards]
+}
+
+// set runs set, which writes the local entry of key loaded at version, unless an
+// event received on key is newer. It reports whether it ran set.
+func (t *versionTracker) set(key string, version int64, set func()) bool {
+	s := t.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version < s.floor || version < s.events[key] {
+		return false
+	}
+	set()
+	return true
+}
+
+// apply remembers the version of an event on key and runs del, which deletes the
+// local entry of key. Invalidations always delete: versions of other processes are
+// only comparable within their clock skew.
+func (t *versionTracker) apply(key string, version int64, del func()) {
+	s := t.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version > s.events[key] {
+		s.sweep(t.window)
+		if _, ok := s.events[key]; !ok && len(s.events) >= t.maxKeys {
+			s.overflow()
+		}
+		if version > s.floor {
+			s.events[key] = version
+		}
+	}
+	del()
+}
+
+// applyFlushAll runs clear, which clears the local cache, for a flush all event.
+func (t *versionTracker) applyFlushAll(version int64, clear func()) {
+	for i := range t.shards {
+		t.shards[i].mu.Lock()
+	}
+	defer func() {
+		for i := range t.shards {
+			t.shards[i].mu.Unlock()
+		}
+	}()
+
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.floor = max(s.floor, version)
+	}
+	clear()
+}
+
+// sweep forgets the versions older than the window, once per window. Versions are
+// unix nanoseconds. s.mu must be held.
+func (s *versionShard) sweep(window int64) {
+	now := time.Now().UnixNano()
+	if now-s.swept < window {
+		return
+	}
+	s.swept = now
+
+	for key, version := range s.events {
+		if now-version >= window {
+			delete(s.events, key)
+		}
+	}
+}
+
+// overflow forgets the versions of the shard, raising its floor to the newest, so
+// that the entries loaded before any of them stay unwritten. s.mu must be held.
+func (s *versionShard) overflow() {
+	for _, version := range s.events {
+		s.floor = max(s.floor, version)
+	}
+	s.events = make(map[string]int64)
+}
+
+// version returns a version for a local entry loaded from now on, or for an event,
+// or 0 without local sync. Versions follow a hybrid logical clock: the unix time in
+// nanoseconds, but never below a version seen before.
+func (c *jetCache) version() int64 {
+	if c.versions == nil {
+		return 0
+	}
+
+	for {
+		last := c.clock.Load()
+		version := max(time.Now().UnixNano(), last+1)
+		if c.clock.CompareAndSwap(last, version) {
+			return version
+		}
+	}
+}
+
+// observeVersion moves the clock past the version of an event received.
+func (c *jetCache) observeVersion(version int64) {
+	for {
+		last := c.clock.Load()
+		if version <= last || c.clock.CompareAndSwap(last, version) {
+			return
+		}
+	}
+}
+
+// setLocal writes the local entry of key, loaded at version.
+func (c *jetCache) setLocal(key string, b []byte, version int64) {
+	c.addBytesWritten(stats.TierLocal, len(b))
+	if c.versions == nil {
+		c.local.Set(key, b)
+		return
+	}
+
+	c.versions.set(key, version, func() {
+		c.local.Set(key, b)
+	})
+}
+
+var _ EventApplier = (*jetCache)(nil)
+
+func (c *jetCache) CacheName() string {
+	return c.name
+}
+
+func (c *jetCache) ApplyEvent(event *Event) {
+	if c.local == nil || event.SourceID == c.sourceID {
+		return
+	}
+
+	if event.EventType == EventTypeFlushAll {
+		clear := func() {
+			if clearer, ok := c.local.(local.Clearer); ok {
+				clearer.Clear()
+			} else {
+				logger.Warn("cache[%s] can not clear local cache for flush all event", c.name)
+			}
+		}
+		if c.versions == nil {
+			clear()
+			return
+		}
+		c.observeVersion(event.Version)
+		c.versions.applyFlushAll(event.Version, clear)
+		return
+	}
+
+	if c.versions == nil {
+		for _, key := range event.Keys {
+			c.local.Del(key)
+		}
+		return
+	}
+
+	c.observeVersion(event.Version)
+	for _, key := range event.Keys {
+		c.versions.apply(key, event.Version, func() {
+			c.local.Del(key)
+		})
+	}
+}
+
+// send queues the keys of a sync event for delivery.
+func (c *jetCache) send(eventType EventType, keys ...string) {
+	if !c.isSyncLocal() {
+		return
+	}
+
+	dropped, coalesced := c.events.add(eventType, keys)
+	if dropped > 0 {
+		logger.Warn("cache[%s] reach max pending sync event keys(%d), dropped(%d)", c.name, c.eventMaxPending, dropped)
+	}
+	if h, ok := c.statsHandler.(stats.EventHandler); ok {
+		if dropped > 0 {
+			h.IncrEventDropped(dropped)
+		}
+		if coalesced > 0 {
+			h.IncrEventCoalesced(coalesced)
+		}
+	}
+}
+
+// startEventFlusher delivers the pending keys to eventCh, at most once per eventWindow.
+// Once stopChan is closed, it delivers the keys still pending and closes eventCh.
+func (c *jetCache) startEventFlusher() {
+	go util.WithRecover(func() {
+		defer close(c.eventCh)
+
+		for {
+			select {
+			case <-c.events.ready:
+			case <-c.stopChan:
+				c.deliverEvents()
+				return
+			}
+
+			select {
+			case <-time.After(c.eventWindow):
+				c.deliverEvents()
+			case <-c.stopChan:
+				c.deliverEvents()
+				return
+			}
+		}
+	})
+}
+
+// deliverEvents passes the pending keys to eventCh. Without eventHandler, nothing
+// is waiting for them on Close, so they are only queued until stopChan is closed.
+func (c *jetCache) deliverEvents() {
+	for _, e := range c.takeEvents() {
+		if c.eventHandler != nil {
+			c.eventCh <- e
+			continue
+		}
+		select {
+		case c.eventCh <- e:
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+// takeEvents returns the pending keys as events of the cache.
+func (c *jetCache) takeEvents() []*Event {
+	events := c.events.take()
+	for _, e := range events {
+		e.CacheName = c.name
+		e.SourceID = c.sourceID
+		e.Version = c.version()
+	}
+	return events
+}
@@ -10,23 +10,45 @@ import (
 	"golang.org/x/exp/constraints"
 
 	"github.com/mgtv-tech/jetcache-go/logger"
+	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/stats"
 	"github.com/mgtv-tech/jetcache-go/util"
 )
 
 // T wrap Cache to support golang's generics
 type T[K constraints.Ordered, V any] struct {
 	Cache
+	hash        remote.HashRemote // hash is set when values are stored in remote hashes.
+	hashBuckets int
 }
 
 // NewT new a T
-func NewT[K constraints.Ordered, V any](cache Cache) *T[K, V] {
-	return &T[K, V]{cache}
+func NewT[K constraints.Ordered, V any](cache Cache, opts ...TOption) *T[K, V] {
+	var o tOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &T[K, V]{Cache: cache, hashBuckets: o.hashBuckets}
+	if o.hashStorage {
+		if c := cache.(*jetCache); c.remote != nil {
+			if !remote.SupportsHash(c.remote) {
+				panic(fmt.Sprintf("remote %T does not implement remote.HashRemote, required by WithHashStorage", c.remote))
+			}
+			w.hash = c.remote.(remote.HashRemote)
+		}
+	}
+
+	return w
 }
 
 // Set sets the value `v` associated with the given `key` and `id` in the cache.
 // The expiration time of the cached value is determined by the cache configuration.
 func (w *T[K, V]) Set(ctx context.Context, key string, id K, v V) error {
 	c := w.Cache.(*jetCache)
+	if w.hash != nil {
+		return w.hSet(ctx, key, id, v)
+	}
 	return w.Cache.Set(ctx, w.combKey(c, key, id), Value(v))
 }
 
@@ -40,6 +62,9 @@ func (w *T[K, V]) Set(ctx context.Context, key string, id K, v V) error {
 // combination, even under concurrent access.
 func (w *T[K, V]) Get(ctx context.Context, key string, id K, fn func(context.Context, K) (V, error)) (V, error) {
 	c := w.Cache.(*jetCache)
+	if w.hash != nil {
+		return w.hGet(ctx, key, id, fn)
+	}
 
 	var varT V
 	err := w.Once(ctx, w.combKey(c, key, id), Value(&varT), Do(func(ctx context.Context) (any, error) {
@@ -99,7 +124,7 @@ func (w *T[K, V]) MGetWithErr(ctx context.Context, key string, ids []K, fn func(
 	})
 
 	combKey := fmt.Sprintf("%s%s%v", key, c.separator, missIds)
-	v, err, _ := c.group.Do(combKey, func() (interface{}, error) {
+	v, err, shared := c.group.Do(combKey, func() (interface{}, error) {
 		var ret map[K]V
 
 		process := func(r map[K]V, e error) {
@@ -115,18 +140,19 @@ func (w *T[K, V]) MGetWithErr(ctx context.Context, key string, ids []K, fn func(
 		}
 
 		if c.remote != nil {
-			process(w.mGetRemote(ctx, miss))
+			process(w.mGetRemote(ctx, key, miss))
 			if len(miss) == 0 {
 				return ret, nil
 			}
 		}
 
 		if fn != nil {
-			process(w.mQueryAndSetCache(ctx, miss, fn))
+			process(w.mQueryAndSetCache(ctx, key, miss, fn))
 		}
 
 		return ret, nil
 	})
+	c.shared(shared)
 
 	if err != nil {
 		errs = errors.Join(errs, err)
@@ -141,7 +167,7 @@ func (w *T[K, V]) mGetLocal(miss map[string]K, skipMissStats bool) (result map[K
 
 	result = make(map[K]V, len(miss))
 	for missKey, missId := range miss {
-		if b, ok := c.local.Get(missKey); ok {
+		if b, ok := c.getLocal(missKey); ok {
 			delete(miss, missKey)
 			c.statsHandler.IncrHit()
 			c.statsHandler.IncrLocalHit()
@@ -165,18 +191,19 @@ func (w *T[K, V]) mGetLocal(miss map[string]K, skipMissStats bool) (result map[K
 	return
 }
 
-func (w *T[K, V]) mGetRemote(ctx context.Context, miss map[string]K) (result map[K]V, errs error) {
+func (w *T[K, V]) mGetRemote(ctx context.Context, key string, miss map[string]K) (result map[K]V, errs error) {
 	c := w.Cache.(*jetCache)
 
-	missKeys := make([]string, 0, len(miss))
-	for missKey := range miss {
-		missKeys = append(missKeys, missKey)
-	}
-
-	cacheValues, err := c.remote.MGet(ctx, missKeys...)
+	version := c.version()
+	start := c.startTimer()
+	cacheValues, err := w.remoteMGet(ctx, key, miss)
+	c.observe(stats.TierRemote, stats.OpGet, start)
 	if err != nil {
 		errs = errors.Join(errs, fmt.Errorf("mGetRemote#c.Remote.MGet error(%v)", err))
-		return
+		// A *remote.BatchError still carries the values of the batches that succeeded.
+		if len(cacheValues) == 0 {
+			return
+		}
 	}
 
 	result = make(map[K]V, len(cacheValues))
@@ -186,6 +213,7 @@ func (w *T[K, V]) mGetRemote(ctx context.Context, miss map[string]K) (result map
 			c.statsHandler.IncrHit()
 			c.statsHandler.IncrRemoteHit()
 			b := util.Bytes(val.(string))
+			c.addBytesRead(stats.TierRemote, len(b))
 			if bytes.Compare(b, notFoundPlaceholder) == 0 {
 				continue
 			}
@@ -195,7 +223,7 @@ func (w *T[K, V]) mGetRemote(ctx context.Context, miss map[string]K) (result map
 			} else {
 				result[missId] = varT
 				if c.local != nil {
-					c.local.Set(missKey, b)
+					c.setLocal(missKey, b, version)
 				}
 			}
 		} else {
@@ -207,7 +235,7 @@ func (w *T[K, V]) mGetRemote(ctx context.Context, miss map[string]K) (result map
 	return
 }
 
-func (w *T[K, V]) mQueryAndSetCache(ctx context.Context, miss map[string]K, fn func(context.Context, []K) (map[K]V, error)) (result map[K]V, errs error) {
+func (w *T[K, V]) mQueryAndSetCache(ctx context.Context, key string, miss map[string]K, fn func(context.Context, []K) (map[K]V, error)) (result map[K]V, errs error) {
 	c := w.Cache.(*jetCache)
 
 	missIds := make([]K, 0, len(miss))
@@ -216,7 +244,10 @@ func (w *T[K, V]) mQueryAndSetCache(ctx context.Context, miss map[string]K, fn f
 	}
 
 	c.statsHandler.IncrQuery()
+	version := c.version()
+	start := c.startTimer()
 	fnValues, err := fn(ctx, missIds)
+	c.observe(stats.TierLoader, stats.OpLoad, start)
 	if err != nil {
 		errs = errors.Join(errs, fmt.Errorf("mQueryAndSetCache#fn(%v) error(%v)", missIds, err))
 		c.statsHandler.IncrQueryFail(err)
@@ -243,25 +274,35 @@ func (w *T[K, V]) mQueryAndSetCache(ctx context.Context, miss map[string]K, fn f
 	if c.local != nil {
 		if len(cacheValues) > 0 {
 			for key, value := range cacheValues {
-				c.local.Set(key, value.([]byte))
+				c.setLocal(key, value.([]byte), version)
 			}
 		}
 		if len(placeholderValues) > 0 {
 			for key, value := range placeholderValues {
-				c.local.Set(key, value.([]byte))
+				c.setLocal(key, value.([]byte), version)
 			}
 		}
 	}
 
 	if c.remote != nil {
-		if len(cacheValues) > 0 {
-			if err = c.remote.MSet(ctx, cacheValues, c.remoteExpiry); err != nil {
-				errs = errors.Join(errs, fmt.Errorf("mQueryAndSetCache#c.Remote.MSet error(%v)", err))
-			}
+		// Every key gets its own jittered ttl, so the batch does not expire at once.
+		entries := make(map[string]remote.Entry, len(cacheValues)+len(placeholderValues))
+		for key, value := range cacheValues {
+			entries[key] = remote.Entry{Value: value, Expire: c.remoteTTL(c.remoteExpiry)}
 		}
-		if len(placeholderValues) > 0 {
-			if err = c.remote.MSet(ctx, placeholderValues, c.notFoundExpiry); err != nil {
+		for key, value := range placeholderValues {
+			entries[key] = remote.Entry{Value: value, Expire: c.notFoundTTL()}
+		}
+		if len(entries) > 0 {
+			start = c.startTimer()
+			err = w.remoteMSet(ctx, key, miss, entries)
+			c.observe(stats.TierRemote, stats.OpSet, start)
+			if err != nil {
 				errs = errors.Join(errs, fmt.Errorf("mQueryAndSetCache#c.Remote.MSet error(%v)", err))
+			} else {
+				for _, entry := range entries {
+					c.addBytesWritten(stats.TierRemote, len(entry.Value.([]byte)))
+				}
 			}
 		}
 		if c.isSyncLocal() {
@@ -279,12 +320,20 @@ func (w *T[K, V]) mQueryAndSetCache(ctx context.Context, miss map[string]K, fn f
 // Delete deletes cached val with the given `key` and `id`.
 func (w *T[K, V]) Delete(ctx context.Context, key string, id K) error {
 	c := w.Cache.(*jetCache)
+	if w.hash != nil {
+		return w.hDel(ctx, key, id)
+	}
 	return c.Delete(ctx, w.combKey(c, key, id))
 }
 
 // Exists reports whether val for the given `key` and `id` exists.
 func (w *T[K, V]) Exists(ctx context.Context, key string, id K) bool {
 	c := w.Cache.(*jetCache)
+	if w.hash != nil {
+		ret, _ := w.MGetWithErr(ctx, key, []K{id}, nil)
+		_, ok := ret[id]
+		return ok
+	}
 	return c.Exists(ctx, w.combKey(c, key, id))
 }
 
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+)
+
+type (
+	// TOption defines the method to customize a T.
+	TOption func(o *tOptions)
+
+	tOptions struct {
+		hashStorage bool
+		hashBuckets int
+	}
+)
+
+// WithHashStorage stores the values of T in remote hashes instead of one string key
+// per id: the values of `key` are fields of the hash `key`, named by id, so Set, MGet
+// and Delete map to HSET, HMGET and HDEL. It saves the per-key overhead of millions
+// of small values. The remote must implement remote.HashRemote.
+//
+// With buckets > 1, the ids of `key` are spread by hash over the hashes `key:#0` to
+// `key:#<buckets-1>`, to keep hashes small and spread them over a cluster.
+//
+// Fields expire on their own where the server supports it (Redis 7.4+); otherwise
+// each field carries its deadline, checked on read, and a hash expires with its
+// longest-lived field. Get loads through MGet, so it does not
+// support refresh.
+func WithHashStorage(buckets int) TOption {
+	return func(o *tOptions) {
+		o.hashStorage = true
+		o.hashBuckets = buckets
+	}
+}
+
+// hashLocation returns the hash and the field storing the value of `key` and `id`.
+func (w *T[K, V]) hashLocation(c *jetCache, key string, id K) (hashKey, field string) {
+	field = fmt.Sprintf("%v", id)
+	if w.hashBuckets <= 1 {
+		return key, field
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(field))
+	return fmt.Sprintf("%s%s#%d", key, c.separator, h.Sum32()%uint32(w.hashBuckets)), field
+}
+
+// remoteMGet retrieves the remote values of miss, by cache key.
+func (w *T[K, V]) remoteMGet(ctx context.Context, key string, miss map[string]K) (map[string]any, error) {
+	c := w.Cache.(*jetCache)
+
+	if w.hash == nil {
+		missKeys := make([]string, 0, len(miss))
+		for missKey := range miss {
+			missKeys = append(missKeys, missKey)
+		}
+		return c.remote.MGet(ctx, missKeys...)
+	}
+
+	fields := make(map[string][]string)
+	cacheKeys := make(map[string]map[string]string)
+	for missKey, missId := range miss {
+		hashKey, field := w.hashLocation(c, key, missId)
+		fields[hashKey] = append(fields[hashKey], field)
+		if cacheKeys[hashKey] == nil {
+			cacheKeys[hashKey] = make(map[string]string)
+		}
+		cacheKeys[hashKey][field] = missKey
+	}
+
+	values, err := w.hash.HMGet(ctx, fields)
+	ret := make(map[string]any, len(miss))
+	for hashKey, hashValues := range values {
+		for field, val := range hashValues {
+			ret[cacheKeys[hashKey][field]] = val
+		}
+	}
+
+	return ret, err
+}
+
+// remoteMSet writes entries, by cache key, to the remote.
+func (w *T[K, V]) remoteMSet(ctx context.Context, key string, miss map[string]K, entries map[string]remote.Entry) error {
+	c := w.Cache.(*jetCache)
+
+	if w.hash == nil {
+		return remote.MSetEntries(ctx, c.remote, entries)
+	}
+
+	values := make(map[string]map[string]remote.Entry)
+	for cacheKey, entry := range entries {
+		hashKey, field := w.hashLocation(c, key, miss[cacheKey])
+		if values[hashKey] == nil {
+			values[hashKey] = make(map[string]remote.Entry)
+		}
+		values[hashKey][field] = entry
+	}
+
+	return w.hash.HSet(ctx, values)
+}
+
+func (w *T[K, V]) hSet(ctx context.Context, key string, id K, v V) error {
+	c := w.Cache.(*jetCache)
+	cacheKey := w.combKey(c, key, id)
+
+	version := c.version()
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if c.local != nil {
+		c.setLocal(cacheKey, b, version)
+	}
+
+	hashKey, field := w.hashLocation(c, key, id)
+	if err = w.hash.HSet(ctx, map[string]map[string]remote.Entry{
+		hashKey: {field: {Value: b, Expire: c.remoteTTL(c.remoteExpiry)}},
+	}); err != nil {
+		return err
+	}
+	c.send(EventTypeSet, cacheKey)
+
+	return nil
+}
+
+func (w *T[K, V]) hGet(ctx context.Context, key string, id K, fn func(context.Context, K) (V, error)) (V, error) {
+	c := w.Cache.(*jetCache)
+
+	var (
+		varT    V
+		loadErr error
+		load    func(context.Context, []K) (map[K]V, error)
+	)
+	if fn != nil {
+		load = func(ctx context.Context, ids []K) (map[K]V, error) {
+			v, err := fn(ctx, ids[0])
+			if c.IsNotFound(err) {
+				return nil, nil
+			} else if err != nil {
+				loadErr = err
+				return nil, err
+			}
+			return map[K]V{ids[0]: v}, nil
+		}
+	}
+
+	ret, err := w.MGetWithErr(ctx, key, []K{id}, load)
+	if v, ok := ret[id]; ok {
+		return v, nil
+	}
+	if loadErr != nil {
+		return varT, loadErr
+	}
+	if err != nil {
+		return varT, err
+	}
+	if fn == nil {
+		return varT, ErrCacheMiss
+	}
+
+	return varT, c.errNotFound
+}
+
+func (w *T[K, V]) hDel(ctx context.Context, key string, id K) error {
+	c := w.Cache.(*jetCache)
+	cacheKey := w.combKey(c, key, id)
+
+	if c.local != nil {
+		c.local.Del(cacheKey)
+	}
+
+	hashKey, field := w.hashLocation(c, key, id)
+	if _, err := w.hash.HDel(ctx, hashKey, field); err != nil {
+		return err
+	}
+	c.send(EventTypeDelete, cacheKey)
+
+	return nil
+}
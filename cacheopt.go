@@ -22,6 +22,13 @@ const (
 	defaultCodec              = msgpack.Name
 	defaultRandSourceIdLen    = 16
 	defaultEventChBufSize     = 100
+	defaultEventWindow        = 10 * time.Millisecond
+	defaultEventMaxPending    = 10000
+	defaultEventBlockTimeout  = 100 * time.Millisecond
+	defaultEventVersionWindow = 10 * time.Second
+	defaultCorruptRetries     = 1
+	defaultQuarantineTTL      = time.Hour
+	quarantineSegment         = "quarantine"
 	defaultSeparator          = ":"
 	minEffectRefreshDuration  = time.Second
 	maxOffset                 = 10 * time.Second
@@ -33,30 +40,54 @@ const (
 	EventTypeSetByRefresh EventType = 3
 	EventTypeSetByMGet    EventType = 4
 	EventTypeDelete       EventType = 5
+	// EventTypeFlushAll replaces the pending events when they overflow with
+	// EventOverflowFlushAll. It has no keys: the whole local cache is stale.
+	EventTypeFlushAll EventType = 6
+)
+
+const (
+	// EventOverflowDropOldest drops the oldest pending keys to make room.
+	EventOverflowDropOldest EventOverflowPolicy = iota
+	// EventOverflowBlock blocks the write until there is room, up to the block
+	// timeout, then drops the new keys.
+	EventOverflowBlock
+	// EventOverflowFlushAll collapses the pending keys into one EventTypeFlushAll event.
+	EventOverflowFlushAll
 )
 
 type (
 	// Options are used to store cache options.
 	Options struct {
-		name                       string             // Cache name, used for log identification and metric reporting
-		remote                     remote.Remote      // Remote is distributed cache, such as Redis.
-		local                      local.Local        // Local is memory cache, such as FreeCache.
-		codec                      string             // Value encoding and decoding method. Default is "msgpack.Name". You can also customize it.
-		errNotFound                error              // Error to return for cache miss. Used to prevent cache penetration.
-		remoteExpiry               time.Duration      // Remote cache ttl, Default is 1 hour.
-		notFoundExpiry             time.Duration      // Duration for placeholder cache when there is a cache miss. Default is 1 minute.
-		offset                     time.Duration      // Expiration time jitter factor for cache misses.
-		refreshDuration            time.Duration      // Interval for asynchronous cache refresh. Default is 0 (refresh is disabled).
-		stopRefreshAfterLastAccess time.Duration      // Duration for cache to stop refreshing after no access. Default is refreshDuration + 1 second.
-		refreshConcurrency         int                // Maximum number of concurrent cache refreshes. Default is 4.
-		statsDisabled              bool               // Flag to disable cache statistics.
-		statsHandler               stats.Handler      // Metrics statsHandler collector.
-		sourceID                   string             // Unique identifier for cache instance.
-		syncLocal                  bool               // Enable events for syncing local cache (only for "Both" cache type).
-		eventChBufSize             int                // Buffer size for event channel (default: 100).
-		eventHandler               func(event *Event) // Function to handle local cache invalidation events.
-		separatorDisabled          bool               // Disable separator for cache key. Default is false. If true, the cache key will not be split into multiple parts.
-		separator                  string             // Separator for cache key. Default is ":".
+		name                       string              // Cache name, used for log identification and metric reporting
+		remote                     remote.Remote       // Remote is distributed cache, such as Redis.
+		local                      local.Local         // Local is memory cache, such as FreeCache.
+		codec                      string              // Value encoding and decoding method. Default is "msgpack.Name". You can also customize it.
+		codecInstance              encoding.Codec      // Codec used for values, resolved from codec unless set by WithCodecInstance.
+		codecEnvelope              bool                // Write values in an envelope naming their codec (default: false).
+		checksum                   encoding.Checksum   // Checksum appended to stored values (default: none).
+		corruptRetries             int                 // Reloads of Once after a cached value fails to decode (default: 1).
+		quarantineTTL              time.Duration       // TTL of the copy of a value that failed to decode (default: 1h).
+		errNotFound                error               // Error to return for cache miss. Used to prevent cache penetration.
+		remoteExpiry               time.Duration       // Remote cache ttl, Default is 1 hour.
+		notFoundExpiry             time.Duration       // Duration for placeholder cache when there is a cache miss. Default is 1 minute.
+		offset                     time.Duration       // Expiration time jitter factor for cache misses.
+		remoteOffset               time.Duration       // Expiration time jitter for remote cache values. Default is 0 (disabled).
+		refreshDuration            time.Duration       // Interval for asynchronous cache refresh. Default is 0 (refresh is disabled).
+		stopRefreshAfterLastAccess time.Duration       // Duration for cache to stop refreshing after no access. Default is refreshDuration + 1 second.
+		refreshConcurrency         int                 // Maximum number of concurrent cache refreshes. Default is 4.
+		statsDisabled              bool                // Flag to disable cache statistics.
+		statsHandler               stats.Handler       // Metrics statsHandler collector.
+		sourceID                   string              // Unique identifier for cache instance.
+		syncLocal                  bool                // Enable events for syncing local cache (only for "Both" cache type).
+		eventChBufSize             int                 // Buffer size for event channel (default: 100).
+		eventWindow                time.Duration       // Time window to coalesce the keys of events (default: 10ms).
+		eventMaxPending            int                 // Maximum number of keys pending delivery (default: 10000).
+		eventOverflowPolicy        EventOverflowPolicy // What to do when eventMaxPending keys are pending (default: drop oldest).
+		eventBlockTimeout          time.Duration       // Maximum wait of EventOverflowBlock (default: 100ms).
+		eventVersionWindow         time.Duration       // How long the versions of the events received are kept to drop stale loads (default: 10s).
+		eventHandler               func(event *Event)  // Function to handle local cache invalidation events.
+		separatorDisabled          bool                // Disable separator for cache key. Default is false. If true, the cache key will not be split into multiple parts.
+		separator                  string              // Separator for cache key. Default is ":".
 	}
 
 	// Option defines the method to customize an Options.
@@ -64,16 +95,24 @@ type (
 
 	EventType int
 
+	// EventOverflowPolicy defines what happens to a new event key when the pending
+	// keys reach the limit set by WithEventMaxPending.
+	EventOverflowPolicy int
+
 	Event struct {
 		CacheName string
 		SourceID  string
 		EventType EventType
 		Keys      []string
+		// Version orders the events and the local values of all processes: unix
+		// nanoseconds of a hybrid logical clock. 0 means unknown.
+		Version int64
 	}
 )
 
 func newOptions(opts ...Option) Options {
-	var o Options
+	// corruptRetries is negative until set, as 0 turns the reloads off.
+	o := Options{corruptRetries: -1}
 	for _, opt := range opts {
 		opt(&o)
 	}
@@ -113,10 +152,33 @@ func newOptions(opts ...Option) Options {
 	if o.eventChBufSize <= 0 {
 		o.eventChBufSize = defaultEventChBufSize
 	}
+	if o.eventWindow <= 0 {
+		o.eventWindow = defaultEventWindow
+	}
+	if o.eventMaxPending <= 0 {
+		o.eventMaxPending = defaultEventMaxPending
+	}
+	if o.eventBlockTimeout <= 0 {
+		o.eventBlockTimeout = defaultEventBlockTimeout
+	}
+	if o.eventVersionWindow <= 0 {
+		o.eventVersionWindow = defaultEventVersionWindow
+	}
+	if o.corruptRetries < 0 {
+		o.corruptRetries = defaultCorruptRetries
+	}
+	if o.quarantineTTL <= 0 {
+		o.quarantineTTL = defaultQuarantineTTL
+	}
 	if o.separator == "" && !o.separatorDisabled {
 		o.separator = defaultSeparator
 	}
-	if encoding.GetCodec(o.codec) == nil {
+	if o.codecInstance == nil {
+		o.codecInstance = encoding.GetCodec(o.codec)
+	} else {
+		o.codec = o.codecInstance.Name()
+	}
+	if o.codecInstance == nil {
 		panic(fmt.Sprintf("encoding %s is not registered, please register it first", o.codec))
 	}
 	return o
@@ -146,6 +208,52 @@ func WithCodec(codec string) Option {
 	}
 }
 
+// WithCodecInstance sets the codec of values, which needs not be registered. Caches
+// can thus use differently configured instances of the same codec. It overrides
+// WithCodec.
+func WithCodecInstance(codec encoding.Codec) Option {
+	return func(o *Options) {
+		o.codecInstance = codec
+	}
+}
+
+// WithCodecEnvelope writes values in an envelope naming their codec, and reads
+// values with the codec named by their envelope, if any, so caches with different
+// codecs read each other's values. Caches without it read enveloped values only when
+// their own codec fails. Enable it on every instance before changing the codec, as
+// older versions do not read envelopes.
+func WithCodecEnvelope(codecEnvelope bool) Option {
+	return func(o *Options) {
+		o.codecEnvelope = codecEnvelope
+	}
+}
+
+// WithChecksum appends a checksum to the stored values, to detect values truncated
+// or corrupted in the remote. Only caches with a checksum verify it; caches without
+// read the values with a checksum when they fail to decode them as is.
+func WithChecksum(checksum encoding.Checksum) Option {
+	return func(o *Options) {
+		o.checksum = checksum
+	}
+}
+
+// WithCorruptRetries sets how many times Once reloads a cached value that fails to
+// decode, before returning the error. 0 turns the reloads off. Default is 1.
+func WithCorruptRetries(corruptRetries int) Option {
+	return func(o *Options) {
+		o.corruptRetries = corruptRetries
+	}
+}
+
+// WithQuarantineTTL sets how long a copy of a remote value that failed to decode is
+// kept under "<name>:quarantine:<key>", with the separator of the cache, for
+// inspection. Default is 1 hour.
+func WithQuarantineTTL(quarantineTTL time.Duration) Option {
+	return func(o *Options) {
+		o.quarantineTTL = quarantineTTL
+	}
+}
+
 func WithErrNotFound(err error) Option {
 	return func(o *Options) {
 		o.errNotFound = err
@@ -170,6 +278,14 @@ func WithOffset(offset time.Duration) Option {
 	}
 }
 
+// WithRemoteOffset adds a random jitter in [0, remoteOffset) to the remote ttl of every
+// value written, so that values loaded together do not expire together.
+func WithRemoteOffset(remoteOffset time.Duration) Option {
+	return func(o *Options) {
+		o.remoteOffset = remoteOffset
+	}
+}
+
 func WithRefreshDuration(refreshDuration time.Duration) Option {
 	return func(o *Options) {
 		o.refreshDuration = refreshDuration
@@ -224,6 +340,47 @@ func WithEventHandler(eventHandler func(event *Event)) Option {
 	}
 }
 
+// WithEventWindow sets the time window in which the keys of sync events are
+// coalesced: the keys changed within it are delivered as one Event per EventType,
+// each key once.
+func WithEventWindow(eventWindow time.Duration) Option {
+	return func(o *Options) {
+		o.eventWindow = eventWindow
+	}
+}
+
+// WithEventMaxPending sets the maximum number of keys of sync events waiting for
+// delivery, e.g. while the eventHandler is slow. Beyond it, the overflow policy applies.
+func WithEventMaxPending(eventMaxPending int) Option {
+	return func(o *Options) {
+		o.eventMaxPending = eventMaxPending
+	}
+}
+
+// WithEventOverflowPolicy sets what happens to new keys of sync events when
+// eventMaxPending keys are pending. Default is EventOverflowDropOldest.
+func WithEventOverflowPolicy(eventOverflowPolicy EventOverflowPolicy) Option {
+	return func(o *Options) {
+		o.eventOverflowPolicy = eventOverflowPolicy
+	}
+}
+
+// WithEventBlockTimeout sets the maximum time EventOverflowBlock blocks a write.
+func WithEventBlockTimeout(eventBlockTimeout time.Duration) Option {
+	return func(o *Options) {
+		o.eventBlockTimeout = eventBlockTimeout
+	}
+}
+
+// WithEventVersionWindow sets how long the versions of the events received are kept
+// to drop the values loaded before them. It should exceed the time to load a value
+// plus the delivery delay of events.
+func WithEventVersionWindow(eventVersionWindow time.Duration) Option {
+	return func(o *Options) {
+		o.eventVersionWindow = eventVersionWindow
+	}
+}
+
 func WithSeparatorDisabled(separatorDisabled bool) Option {
 	return func(o *Options) {
 		o.separatorDisabled = separatorDisabled
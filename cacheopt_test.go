@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mgtv-tech/jetcache-go/encoding"
 	"github.com/mgtv-tech/jetcache-go/encoding/json"
 	"github.com/mgtv-tech/jetcache-go/stats"
 )
@@ -23,6 +25,10 @@ func TestCacheOptions(t *testing.T) {
 		assert.Equal(t, defaultRandSourceIdLen, len(o.sourceID))
 		assert.False(t, o.syncLocal)
 		assert.Equal(t, defaultEventChBufSize, o.eventChBufSize)
+		assert.Equal(t, defaultEventWindow, o.eventWindow)
+		assert.Equal(t, defaultEventMaxPending, o.eventMaxPending)
+		assert.Equal(t, EventOverflowDropOldest, o.eventOverflowPolicy)
+		assert.Equal(t, defaultEventBlockTimeout, o.eventBlockTimeout)
 		assert.Nil(t, o.eventHandler)
 		assert.Equal(t, defaultSeparator, o.separator)
 		assert.Equal(t, false, o.separatorDisabled)
@@ -53,6 +59,13 @@ func TestCacheOptions(t *testing.T) {
 		assert.Equal(t, time.Second, o.offset)
 	})
 
+	t.Run("with remote offset", func(t *testing.T) {
+		o := newOptions()
+		assert.Equal(t, time.Duration(0), o.remoteOffset)
+		o = newOptions(WithRemoteOffset(time.Minute))
+		assert.Equal(t, time.Minute, o.remoteOffset)
+	})
+
 	t.Run("with max offset", func(t *testing.T) {
 		o := newOptions(WithOffset(30 * time.Second))
 		assert.Equal(t, maxOffset, o.offset)
@@ -104,6 +117,27 @@ func TestCacheOptions(t *testing.T) {
 		assert.Equal(t, o.eventChBufSize, 10)
 	})
 
+	t.Run("with event delivery", func(t *testing.T) {
+		o := newOptions(WithEventWindow(time.Second), WithEventMaxPending(10),
+			WithEventOverflowPolicy(EventOverflowBlock), WithEventBlockTimeout(time.Second))
+		assert.Equal(t, time.Second, o.eventWindow)
+		assert.Equal(t, 10, o.eventMaxPending)
+		assert.Equal(t, EventOverflowBlock, o.eventOverflowPolicy)
+		assert.Equal(t, time.Second, o.eventBlockTimeout)
+	})
+
+	t.Run("with codec envelope", func(t *testing.T) {
+		o := newOptions(WithCodecEnvelope(true))
+		assert.True(t, o.codecEnvelope)
+	})
+
+	t.Run("with event version window", func(t *testing.T) {
+		o := newOptions()
+		assert.Equal(t, defaultEventVersionWindow, o.eventVersionWindow)
+		o = newOptions(WithEventVersionWindow(time.Minute))
+		assert.Equal(t, time.Minute, o.eventVersionWindow)
+	})
+
 	t.Run("with event handler", func(t *testing.T) {
 		o := newOptions(WithEventHandler(func(event *Event) {
 		}))
@@ -134,6 +168,33 @@ func TestCacheOptions(t *testing.T) {
 	t.Run("with not registered codec", func(t *testing.T) {
 		assert.Panics(t, func() { newOptions(WithCodec("not-registered")) })
 	})
+
+	t.Run("with checksum", func(t *testing.T) {
+		o := newOptions()
+		assert.Equal(t, encoding.ChecksumNone, o.checksum)
+		assert.Equal(t, defaultCorruptRetries, o.corruptRetries)
+		assert.Equal(t, defaultQuarantineTTL, o.quarantineTTL)
+
+		o = newOptions(WithChecksum(encoding.ChecksumXXHash), WithCorruptRetries(3), WithQuarantineTTL(time.Minute))
+		assert.Equal(t, encoding.ChecksumXXHash, o.checksum)
+		assert.Equal(t, 3, o.corruptRetries)
+		assert.Equal(t, time.Minute, o.quarantineTTL)
+
+		o = newOptions(WithCorruptRetries(0))
+		assert.Equal(t, 0, o.corruptRetries)
+		o = newOptions(WithCorruptRetries(-1))
+		assert.Equal(t, defaultCorruptRetries, o.corruptRetries)
+	})
+
+	t.Run("with codec instance", func(t *testing.T) {
+		o := newOptions()
+		assert.Equal(t, encoding.GetCodec(defaultCodec), o.codecInstance)
+
+		instance := &namedCodec{Codec: encoding.GetCodec(json.Name), name: "not-registered"}
+		o = newOptions(WithCodec(json.Name), WithCodecInstance(instance))
+		assert.Same(t, instance, o.codecInstance)
+		assert.Equal(t, "not-registered", o.codec)
+	})
 }
 
 func TestCacheOptionsRefreshDuration(t *testing.T) {
@@ -160,3 +221,19 @@ func TestCacheOptionsRefreshDuration(t *testing.T) {
 		assert.Equal(t, v.expect, o.refreshDuration)
 	}
 }
+
+// namedCodec is a Codec instance under another name.
+type namedCodec struct {
+	encoding.Codec
+	name    string
+	marshal atomic.Int64
+}
+
+func (c *namedCodec) Marshal(v any) ([]byte, error) {
+	c.marshal.Add(1)
+	return c.Codec.Marshal(v)
+}
+
+func (c *namedCodec) Name() string {
+	return c.name
+}
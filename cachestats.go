@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/stats"
+)
+
+// extendedHandler returns the statsHandler of o if it observes latencies, or nil if
+// it does not or stats are disabled.
+func extendedHandler(o *Options) stats.ExtendedHandler {
+	if o.statsDisabled {
+		return nil
+	}
+
+	switch h := o.statsHandler.(type) {
+	case *stats.Handlers:
+		return h.Extended()
+	case stats.ExtendedHandler:
+		return h
+	default:
+		return nil
+	}
+}
+
+// startTimer returns the start of an operation to observe, or the zero time if the
+// stats handler is not a stats.ExtendedHandler.
+func (c *jetCache) startTimer() time.Time {
+	if c.extended == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe records the latency of op on tier since start.
+func (c *jetCache) observe(tier stats.Tier, op stats.Op, start time.Time) {
+	if c.extended != nil && !start.IsZero() {
+		c.extended.ObserveLatency(tier, op, time.Since(start))
+	}
+}
+
+func (c *jetCache) addBytesRead(tier stats.Tier, n int) {
+	if c.extended != nil && n > 0 {
+		c.extended.AddBytesRead(tier, uint64(n))
+	}
+}
+
+func (c *jetCache) addBytesWritten(tier stats.Tier, n int) {
+	if c.extended != nil && n > 0 {
+		c.extended.AddBytesWritten(tier, uint64(n))
+	}
+}
+
+// refreshed counts the outcome of a refresh task.
+func (c *jetCache) refreshed(err error) {
+	if c.extended == nil {
+		return
+	}
+	if err != nil {
+		c.extended.IncrRefreshFail(err)
+	} else {
+		c.extended.IncrRefresh()
+	}
+}
+
+// shared counts a load whose result was shared with concurrent callers.
+func (c *jetCache) shared(shared bool) {
+	if shared && c.extended != nil {
+		c.extended.IncrShared()
+	}
+}
+
+// getLocal gets the value of key from the local cache.
+func (c *jetCache) getLocal(key string) ([]byte, bool) {
+	start := c.startTimer()
+	b, ok := c.local.Get(key)
+	c.observe(stats.TierLocal, stats.OpGet, start)
+	if ok {
+		c.addBytesRead(stats.TierLocal, len(b))
+	}
+	return b, ok
+}
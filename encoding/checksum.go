@@ -0,0 +1,98 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Checksum is an algorithm checking the integrity of stored values.
+type Checksum byte
+
+const (
+	ChecksumNone Checksum = iota
+	// ChecksumCRC32C appends a 4-byte CRC-32 with the Castagnoli polynomial.
+	ChecksumCRC32C
+	// ChecksumXXHash appends an 8-byte XXH64.
+	ChecksumXXHash
+)
+
+const (
+	// checksumFlag marks the byte of a checksum frame after envelopeMagic, where an
+	// envelope has its version.
+	checksumFlag = 0x80
+	// checksumHeaderLen is the length of the header before the checksum.
+	checksumHeaderLen = len(envelopeMagic) + 1
+)
+
+var (
+	// ErrChecksum is returned by VerifyChecksum for data whose checksum does not
+	// match, e.g. truncated or corrupted in the remote.
+	ErrChecksum = errors.New("encoding: checksum mismatch")
+
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// AppendChecksum returns data in a frame with its checksum: envelopeMagic, a byte
+// with the checksum flag and algorithm, the checksum, then data.
+func AppendChecksum(checksum Checksum, data []byte) []byte {
+	size := checksum.size()
+	if size == 0 {
+		return data
+	}
+
+	b := make([]byte, checksumHeaderLen+size, checksumHeaderLen+size+len(data))
+	copy(b, envelopeMagic)
+	b[checksumHeaderLen-1] = checksumFlag | byte(checksum)
+	checksum.put(b[checksumHeaderLen:], data)
+	return append(b, data...)
+}
+
+// VerifyChecksum returns the data in a frame of AppendChecksum if its checksum
+// matches, or ErrChecksum. Data without frame is returned as is.
+func VerifyChecksum(data []byte) ([]byte, error) {
+	if !hasMagic(data) || len(data) < checksumHeaderLen || data[checksumHeaderLen-1]&checksumFlag == 0 {
+		return data, nil
+	}
+
+	checksum := Checksum(data[checksumHeaderLen-1] &^ checksumFlag)
+	size := checksum.size()
+	if size == 0 {
+		return nil, fmt.Errorf("%w: unknown checksum %d", ErrChecksum, checksum)
+	}
+	if len(data) < checksumHeaderLen+size {
+		return nil, fmt.Errorf("%w: truncated", ErrChecksum)
+	}
+
+	payload := data[checksumHeaderLen+size:]
+	sum := make([]byte, size)
+	checksum.put(sum, payload)
+	if string(sum) != string(data[checksumHeaderLen:checksumHeaderLen+size]) {
+		return nil, ErrChecksum
+	}
+	return payload, nil
+}
+
+func (c Checksum) size() int {
+	switch c {
+	case ChecksumCRC32C:
+		return 4
+	case ChecksumXXHash:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// put writes the checksum of data to b.
+func (c Checksum) put(b, data []byte) {
+	switch c {
+	case ChecksumCRC32C:
+		binary.BigEndian.PutUint32(b, crc32.Checksum(data, crc32c))
+	case ChecksumXXHash:
+		binary.BigEndian.PutUint64(b, xxhash.Sum64(data))
+	}
+}
@@ -0,0 +1,45 @@
+package encoding
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	data := []byte("jetcache")
+	for _, checksum := range []Checksum{ChecksumCRC32C, ChecksumXXHash} {
+		b := AppendChecksum(checksum, data)
+		if len(b) != checksumHeaderLen+checksum.size()+len(data) {
+			t.Fatalf("AppendChecksum(%d) got %d bytes", checksum, len(b))
+		}
+		got, err := VerifyChecksum(b)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("VerifyChecksum(%d) got (%s, %v) want (%s, nil)", checksum, got, err, data)
+		}
+
+		corrupted := append([]byte(nil), b...)
+		corrupted[len(corrupted)-1] ^= 0xff
+		if _, err = VerifyChecksum(corrupted); !errors.Is(err, ErrChecksum) {
+			t.Fatalf("VerifyChecksum(%d) of corrupted data error got %v want %v", checksum, err, ErrChecksum)
+		}
+		if _, err = VerifyChecksum(b[:len(b)-1]); !errors.Is(err, ErrChecksum) {
+			t.Fatalf("VerifyChecksum(%d) of truncated data error got %v want %v", checksum, err, ErrChecksum)
+		}
+		if _, err = VerifyChecksum(b[:checksumHeaderLen+1]); !errors.Is(err, ErrChecksum) {
+			t.Fatalf("VerifyChecksum(%d) of truncated checksum error got %v want %v", checksum, err, ErrChecksum)
+		}
+	}
+
+	if b := AppendChecksum(ChecksumNone, data); !bytes.Equal(b, data) {
+		t.Fatalf("AppendChecksum(ChecksumNone) got %s want %s", b, data)
+	}
+	for _, b := range [][]byte{data, append([]byte(envelopeMagic), envelopeVersion, 1, 'x'), {0xc1, checksumFlag | 1, 0, 0, 0, 0}} {
+		if got, err := VerifyChecksum(b); err != nil || !bytes.Equal(got, b) {
+			t.Fatalf("VerifyChecksum(%v) got (%v, %v) want data as is", b, got, err)
+		}
+	}
+	if _, err := VerifyChecksum(append([]byte(envelopeMagic), checksumFlag|9, 0)); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("VerifyChecksum() of unknown checksum error got %v want %v", err, ErrChecksum)
+	}
+}
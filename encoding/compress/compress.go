@@ -0,0 +1,342 @@
+// Package compress provides a Codec wrapper compressing the wire format of any
+// encoding.Codec with s2, zstd or gzip.
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+	"github.com/mgtv-tech/jetcache-go/stats"
+)
+
+const (
+	defaultThreshold      = 64
+	defaultMaxDecodedSize = 64 << 20
+)
+
+// Algorithm is a compression algorithm. Its value is the marker appended to the
+// values it compressed, so that any Codec decodes them.
+type Algorithm byte
+
+const (
+	None Algorithm = iota
+	S2
+	Zstd
+	Gzip
+)
+
+var (
+	_ encoding.Codec = (*Codec)(nil)
+
+	errEmpty    = errors.New("compress: empty data")
+	errTooLarge = errors.New("compress: decoded size exceeds the maximum")
+)
+
+type (
+	// Codec is an encoding.Codec compressing the wire format of another Codec above a
+	// size threshold. It decodes the values of every Algorithm, whatever its own.
+	Codec struct {
+		codec      encoding.Codec
+		name       string
+		algorithm  Algorithm
+		threshold  int
+		level      int
+		dictionary []byte
+		maxDecoded int
+		handler    stats.Handler
+
+		zstdEncoder *zstd.Encoder
+		zstdDecoder func() (*zstd.Decoder, error)
+		gzipWriters sync.Pool
+
+		values atomic.Uint64
+		raw    atomic.Uint64
+		stored atomic.Uint64
+	}
+
+	// Option defines the method to customize a Codec.
+	Option func(o *Codec)
+
+	// Stats counts the values marshaled by a Codec.
+	Stats struct {
+		// Values is the number of values marshaled.
+		Values uint64
+		// RawBytes is the size of the values before compression.
+		RawBytes uint64
+		// StoredBytes is the size of the values after compression, markers included.
+		StoredBytes uint64
+	}
+)
+
+// WithName sets the name the Codec is registered under. Default is the name of the
+// wrapped Codec followed by "+compress".
+func WithName(name string) Option {
+	return func(o *Codec) {
+		o.name = name
+	}
+}
+
+// WithAlgorithm sets the compression algorithm. Default is S2.
+func WithAlgorithm(algorithm Algorithm) Option {
+	return func(o *Codec) {
+		o.algorithm = algorithm
+	}
+}
+
+// WithThreshold sets the size from which values are compressed. Default is 64 bytes.
+func WithThreshold(threshold int) Option {
+	return func(o *Codec) {
+		o.threshold = threshold
+	}
+}
+
+// WithLevel sets the compression level of the algorithm: 1 to 3 for s2 (fast,
+// better, best), 1 to 22 for zstd, 1 to 9 for gzip. Default is the default level of
+// the algorithm.
+func WithLevel(level int) Option {
+	return func(o *Codec) {
+		o.level = level
+	}
+}
+
+// WithDictionary sets a trained zstd dictionary, e.g. by `zstd --train`, which
+// improves the compression of small values. Readers need the same dictionary.
+func WithDictionary(dictionary []byte) Option {
+	return func(o *Codec) {
+		o.dictionary = dictionary
+	}
+}
+
+// WithMaxDecodedSize sets the maximum size of a decompressed value. Unmarshal fails
+// on larger values rather than allocating them, e.g. for a corrupted or hostile
+// value in the remote. Default is 64MB.
+func WithMaxDecodedSize(maxDecoded int) Option {
+	return func(o *Codec) {
+		o.maxDecoded = maxDecoded
+	}
+}
+
+// WithStatsHandler reports the size of every value marshaled to handler, if it
+// implements stats.CompressionHandler.
+func WithStatsHandler(handler stats.Handler) Option {
+	return func(o *Codec) {
+		o.handler = handler
+	}
+}
+
+// New creates a Codec compressing the wire format of codec. Register it with
+// encoding.RegisterCodec to use it by name.
+func New(codec encoding.Codec, opts ...Option) (*Codec, error) {
+	c := &Codec{codec: codec, algorithm: S2}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.name == "" {
+		c.name = codec.Name() + "+compress"
+	}
+	if c.algorithm > Gzip {
+		return nil, fmt.Errorf("compress: unknown algorithm %d", c.algorithm)
+	}
+	if c.threshold <= 0 {
+		c.threshold = defaultThreshold
+	}
+	if c.maxDecoded <= 0 {
+		c.maxDecoded = defaultMaxDecodedSize
+	}
+
+	if c.algorithm == Zstd {
+		eopts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if c.level > 0 {
+			eopts = append(eopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.level)))
+		}
+		if c.dictionary != nil {
+			eopts = append(eopts, zstd.WithEncoderDict(c.dictionary))
+		}
+		var err error
+		if c.zstdEncoder, err = zstd.NewWriter(nil, eopts...); err != nil {
+			return nil, fmt.Errorf("compress: zstd encoder: %w", err)
+		}
+	}
+	c.zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		dopts := []zstd.DOption{zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(uint64(c.maxDecoded))}
+		if c.dictionary != nil {
+			dopts = append(dopts, zstd.WithDecoderDicts(c.dictionary))
+		}
+		return zstd.NewReader(nil, dopts...)
+	})
+	if c.algorithm == Gzip {
+		level := c.level
+		if level <= 0 {
+			level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+			return nil, fmt.Errorf("compress: gzip writer: %w", err)
+		}
+		c.gzipWriters.New = func() any {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		}
+	}
+
+	return c, nil
+}
+
+// Stats returns the counts of values and bytes marshaled so far.
+func (c *Codec) Stats() Stats {
+	return Stats{
+		Values:      c.values.Load(),
+		RawBytes:    c.raw.Load(),
+		StoredBytes: c.stored.Load(),
+	}
+}
+
+// Ratio returns the stored bytes per raw byte, 0 before any value.
+func (s Stats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 0
+	}
+	return float64(s.StoredBytes) / float64(s.RawBytes)
+}
+
+// Saved returns the raw bytes minus the stored bytes, which is negative when the
+// markers outweigh the compression.
+func (s Stats) Saved() int64 {
+	return int64(s.RawBytes) - int64(s.StoredBytes)
+}
+
+func (c *Codec) Marshal(v any) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.values.Add(1)
+	c.raw.Add(uint64(len(data)))
+	c.stored.Add(uint64(len(b)))
+	if h, ok := c.handler.(stats.CompressionHandler); ok {
+		h.IncrCompression(uint64(len(data)), uint64(len(b)))
+	}
+
+	return b, nil
+}
+
+func (c *Codec) Unmarshal(data []byte, v any) error {
+	data, err := c.decompress(data)
+	if err != nil {
+		return err
+	}
+
+	return c.codec.Unmarshal(data, v)
+}
+
+func (c *Codec) Name() string {
+	return c.name
+}
+
+// compress returns data compressed and followed by its Algorithm marker. Data below
+// the threshold, or not made smaller, is stored as is.
+func (c *Codec) compress(data []byte) ([]byte, error) {
+	if c.algorithm == None || len(data) < c.threshold {
+		return appendRaw(data), nil
+	}
+
+	var b []byte
+	switch c.algorithm {
+	case S2:
+		switch {
+		case c.level >= 3:
+			b = s2.EncodeBest(nil, data)
+		case c.level == 2:
+			b = s2.EncodeBetter(nil, data)
+		default:
+			b = s2.Encode(nil, data)
+		}
+	case Zstd:
+		b = c.zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)))
+	case Gzip:
+		var buf bytes.Buffer
+		w := c.gzipWriters.Get().(*gzip.Writer)
+		defer c.gzipWriters.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		b = buf.Bytes()
+	}
+
+	if len(b) >= len(data) {
+		return appendRaw(data), nil
+	}
+	return append(b, byte(c.algorithm)), nil
+}
+
+// decompress returns data decompressed, or errTooLarge past the maximum decoded
+// size.
+func (c *Codec) decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errEmpty
+	}
+
+	algorithm := Algorithm(data[len(data)-1])
+	data = data[:len(data)-1]
+	switch algorithm {
+	case None:
+		return data, nil
+	case S2:
+		n, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > c.maxDecoded {
+			return nil, errTooLarge
+		}
+		return s2.Decode(nil, data)
+	case Zstd:
+		d, err := c.zstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("compress: zstd decoder: %w", err)
+		}
+		b, err := d.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, fmt.Errorf("%w: %v", errTooLarge, err)
+		}
+		return b, err
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		b, err := io.ReadAll(io.LimitReader(r, int64(c.maxDecoded)+1))
+		if err == nil && len(b) > c.maxDecoded {
+			return nil, errTooLarge
+		}
+		return b, err
+	default:
+		return nil, fmt.Errorf("compress: unknown compression method: %x", byte(algorithm))
+	}
+}
+
+func appendRaw(data []byte) []byte {
+	b := make([]byte, len(data)+1)
+	copy(b, data)
+	b[len(data)] = byte(None)
+	return b
+}
@@ -0,0 +1,171 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+	"github.com/mgtv-tech/jetcache-go/encoding/json"
+	"github.com/mgtv-tech/jetcache-go/stats"
+)
+
+type testValue struct {
+	Name  string
+	Items []string
+}
+
+func newValue(n int) *testValue {
+	v := &testValue{Name: "jetcache"}
+	for i := 0; i < n; i++ {
+		v.Items = append(v.Items, fmt.Sprintf("item-%d", i%10))
+	}
+	return v
+}
+
+func TestCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"s2", nil},
+		{"s2 best", []Option{WithLevel(3)}},
+		{"zstd", []Option{WithAlgorithm(Zstd)}},
+		{"zstd level", []Option{WithAlgorithm(Zstd), WithLevel(19)}},
+		{"gzip", []Option{WithAlgorithm(Gzip), WithLevel(9)}},
+		{"none", []Option{WithAlgorithm(None)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New(encoding.GetCodec(json.Name), tc.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, "json+compress", c.Name())
+
+			for _, n := range []int{1, 100} {
+				want := newValue(n)
+				b, err := c.Marshal(want)
+				require.NoError(t, err)
+
+				var got testValue
+				require.NoError(t, c.Unmarshal(b, &got))
+				assert.Equal(t, want, &got)
+			}
+
+			s := c.Stats()
+			assert.Equal(t, uint64(2), s.Values)
+			if c.algorithm == None {
+				assert.Equal(t, int64(-2), s.Saved())
+			} else {
+				assert.Greater(t, s.Saved(), int64(0))
+				assert.Less(t, s.Ratio(), 0.5)
+			}
+		})
+	}
+}
+
+func TestCodec_Threshold(t *testing.T) {
+	c, err := New(encoding.GetCodec(json.Name), WithThreshold(1<<20))
+	require.NoError(t, err)
+
+	raw, err := encoding.GetCodec(json.Name).Marshal(newValue(100))
+	require.NoError(t, err)
+	b, err := c.Marshal(newValue(100))
+	require.NoError(t, err)
+	assert.Equal(t, append(raw, byte(None)), b)
+}
+
+func TestCodec_ReadsOtherAlgorithms(t *testing.T) {
+	gz, err := New(encoding.GetCodec(json.Name), WithAlgorithm(Gzip))
+	require.NoError(t, err)
+	s2, err := New(encoding.GetCodec(json.Name))
+	require.NoError(t, err)
+
+	b, err := gz.Marshal(newValue(100))
+	require.NoError(t, err)
+	assert.Equal(t, byte(Gzip), b[len(b)-1])
+
+	var got testValue
+	require.NoError(t, s2.Unmarshal(b, &got))
+	assert.Equal(t, newValue(100), &got)
+}
+
+func TestCodec_Dictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user-%d@example.com","status":"active"}`, i, i, i)))
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 4096, HashBytes: 6})
+	require.NoError(t, err)
+
+	withDict, err := New(encoding.GetCodec(json.Name), WithAlgorithm(Zstd), WithDictionary(d), WithThreshold(1))
+	require.NoError(t, err)
+	withoutDict, err := New(encoding.GetCodec(json.Name), WithAlgorithm(Zstd), WithThreshold(1))
+	require.NoError(t, err)
+
+	value := map[string]any{"id": 12345, "name": "user-12345", "email": "user-12345@example.com", "status": "active"}
+	small, err := withDict.Marshal(value)
+	require.NoError(t, err)
+	large, err := withoutDict.Marshal(value)
+	require.NoError(t, err)
+	assert.Less(t, len(small), len(large))
+
+	var got map[string]any
+	require.NoError(t, withDict.Unmarshal(small, &got))
+	assert.Equal(t, "user-12345", got["name"])
+
+	_, err = New(encoding.GetCodec(json.Name), WithAlgorithm(Zstd), WithDictionary([]byte("not a dictionary")))
+	assert.Error(t, err)
+}
+
+func TestCodec_Errors(t *testing.T) {
+	_, err := New(encoding.GetCodec(json.Name), WithAlgorithm(Algorithm(9)))
+	assert.Error(t, err)
+	_, err = New(encoding.GetCodec(json.Name), WithAlgorithm(Gzip), WithLevel(42))
+	assert.Error(t, err)
+
+	c, err := New(encoding.GetCodec(json.Name), WithName("my-json"))
+	require.NoError(t, err)
+	assert.Equal(t, "my-json", c.Name())
+
+	var v testValue
+	assert.ErrorIs(t, c.Unmarshal(nil, &v), errEmpty)
+	assert.ErrorContains(t, c.Unmarshal([]byte{'{', '}', 0x9}, &v), "unknown compression method: 9")
+	assert.Error(t, c.Unmarshal([]byte{'x', byte(S2)}, &v))
+}
+
+func TestCodec_StatsHandler(t *testing.T) {
+	handler := stats.NewStatsLogger("compress").(*stats.Stats)
+	c, err := New(encoding.GetCodec(json.Name), WithStatsHandler(handler))
+	require.NoError(t, err)
+
+	b, err := c.Marshal(newValue(100))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(b)), handler.CompressStored)
+	assert.Greater(t, handler.CompressRaw, handler.CompressStored)
+	assert.True(t, bytes.HasSuffix(b, []byte{byte(S2)}))
+	assert.False(t, strings.Contains(string(b), "item-9"))
+}
+
+func TestCodec_MaxDecodedSize(t *testing.T) {
+	for _, algorithm := range []Algorithm{S2, Zstd, Gzip} {
+		t.Run(fmt.Sprint(algorithm), func(t *testing.T) {
+			large, err := New(encoding.GetCodec(json.Name), WithAlgorithm(algorithm))
+			require.NoError(t, err)
+			small, err := New(encoding.GetCodec(json.Name), WithAlgorithm(algorithm), WithMaxDecodedSize(1<<10))
+			require.NoError(t, err)
+
+			b, err := large.Marshal(newValue(1000))
+			require.NoError(t, err)
+			assert.Equal(t, byte(algorithm), b[len(b)-1])
+
+			var got testValue
+			assert.ErrorIs(t, small.Unmarshal(b, &got), errTooLarge)
+			require.NoError(t, large.Unmarshal(b, &got))
+			assert.Equal(t, newValue(1000), &got)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"strings"
+	"sync"
 )
 
 // Codec defines the interface Transport uses to encode and decode messages.
@@ -18,10 +19,21 @@ type Codec interface {
 	Name() string
 }
 
-var registeredCodecs = make(map[string]Codec)
+// Resealer is implemented by a Codec whose wire format can be outdated, e.g.
+// encrypted with a retired key. The cache writes back the values it resealed.
+type Resealer interface {
+	// Reseal returns data in the current wire format, and reports whether it
+	// changed.
+	Reseal(data []byte) ([]byte, bool, error)
+}
+
+var (
+	mu               sync.RWMutex
+	registeredCodecs = make(map[string]Codec)
+)
 
 // RegisterCodec registers the provided Codec for use with all Transport clients and
-// servers.
+// servers. It is safe for concurrent use, and replaces a Codec of the same name.
 func RegisterCodec(codec Codec) {
 	if codec == nil {
 		panic("cannot register a nil Codec")
@@ -30,7 +42,9 @@ func RegisterCodec(codec Codec) {
 		panic("cannot register Codec with empty string result for Name()")
 	}
 	contentSubtype := strings.ToLower(codec.Name())
+	mu.Lock()
 	registeredCodecs[contentSubtype] = codec
+	mu.Unlock()
 }
 
 // GetCodec gets a registered Codec by content-subtype, or nil if no Codec is
@@ -38,5 +52,7 @@ func RegisterCodec(codec Codec) {
 //
 // The content-subtype is expected to be lowercase.
 func GetCodec(contentSubtype string) Codec {
+	mu.RLock()
+	defer mu.RUnlock()
 	return registeredCodecs[contentSubtype]
 }
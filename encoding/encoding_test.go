@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"runtime/debug"
+	"sync"
 	"testing"
 )
 
@@ -63,6 +64,21 @@ func TestRegisterCodec(t *testing.T) {
 	}
 }
 
+func TestRegisterCodec_concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RegisterCodec(codec2{})
+			if GetCodec("xml") == nil {
+				t.Error("GetCodec(xml) got nil")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 // PanicTestFunc defines a func that should be passed to the assert.Panics and assert.NotPanics
 // methods, and represents a simple func that takes no arguments, and returns nothing.
 type PanicTestFunc func()
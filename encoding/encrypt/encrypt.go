@@ -0,0 +1,227 @@
+// Package encrypt provides a Codec wrapper encrypting the wire format of any
+// encoding.Codec with AES-GCM, with key rotation.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+)
+
+// version is the first byte of the values encrypted by a Codec.
+const version = 0x01
+
+var (
+	_ encoding.Codec    = (*Codec)(nil)
+	_ encoding.Resealer = (*Codec)(nil)
+
+	// ErrUnknownKey is returned for a key ID the KeyProvider does not know.
+	ErrUnknownKey = errors.New("encrypt: unknown key id")
+
+	errMalformed = errors.New("encrypt: malformed data")
+)
+
+type (
+	// KeyProvider provides the keys of a Codec. A key ID must never be reused for
+	// another key. Keys must be 16, 24 or 32 bytes long, for AES-128, AES-192 or
+	// AES-256. Implementations must be thread safe.
+	KeyProvider interface {
+		// CurrentKey returns the key to encrypt with, and its ID.
+		CurrentKey() (id string, key []byte, err error)
+		// Key returns the key of id, to decrypt with, or ErrUnknownKey.
+		Key(id string) ([]byte, error)
+	}
+
+	// Codec is an encoding.Codec encrypting the wire format of another Codec with
+	// AES-GCM. A value is: version byte, key ID length byte, key ID, nonce, then the
+	// sealed wire format; the header is authenticated too.
+	Codec struct {
+		codec encoding.Codec
+		keys  KeyProvider
+		name  string
+		aeads sync.Map // key ID -> cipher.AEAD
+	}
+
+	// Option defines the method to customize a Codec.
+	Option func(o *Codec)
+
+	staticKeys struct {
+		current string
+		keys    map[string][]byte
+	}
+)
+
+// WithName sets the name the Codec is registered under. Default is the name of the
+// wrapped Codec followed by "+encrypt".
+func WithName(name string) Option {
+	return func(o *Codec) {
+		o.name = name
+	}
+}
+
+// NewStaticKeys returns a KeyProvider encrypting with the key of current and
+// decrypting with any of keys. To rotate keys, add the new key, then make it current
+// once every instance knows it, and remove the old key once its values expired.
+func NewStaticKeys(current string, keys map[string][]byte) KeyProvider {
+	return &staticKeys{current: current, keys: keys}
+}
+
+func (s *staticKeys) CurrentKey() (string, []byte, error) {
+	key, err := s.Key(s.current)
+	return s.current, key, err
+}
+
+func (s *staticKeys) Key(id string) ([]byte, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// New creates a Codec encrypting the wire format of codec with the keys of keys.
+// Register it with encoding.RegisterCodec to use it by name.
+func New(codec encoding.Codec, keys KeyProvider, opts ...Option) *Codec {
+	c := &Codec{codec: codec, keys: keys}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.name == "" {
+		c.name = codec.Name() + "+encrypt"
+	}
+
+	return c
+}
+
+func (c *Codec) Marshal(v any) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.encrypt(data)
+}
+
+func (c *Codec) Unmarshal(data []byte, v any) error {
+	_, plain, err := c.decrypt(data)
+	if err != nil {
+		return err
+	}
+
+	return c.codec.Unmarshal(plain, v)
+}
+
+func (c *Codec) Name() string {
+	return c.name
+}
+
+// Reseal encrypts data again with the current key if it was encrypted with another
+// key, and reports whether it did.
+func (c *Codec) Reseal(data []byte) ([]byte, bool, error) {
+	current, _, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, false, err
+	}
+	id, _, ok := parseHeader(data)
+	if !ok {
+		return nil, false, errMalformed
+	}
+	if id == current {
+		return data, false, nil
+	}
+
+	_, plain, err := c.decrypt(data)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := c.encrypt(plain)
+	return b, err == nil, err
+}
+
+func (c *Codec) encrypt(plain []byte) ([]byte, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 0xff {
+		return nil, fmt.Errorf("encrypt: key id %q is too long", id)
+	}
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := 2 + len(id)
+	b := make([]byte, header+aead.NonceSize(), header+aead.NonceSize()+len(plain)+aead.Overhead())
+	b[0], b[1] = version, byte(len(id))
+	copy(b[2:], id)
+	if _, err = rand.Read(b[header:]); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(b, b[header:], plain, b[:header]), nil
+}
+
+func (c *Codec) decrypt(data []byte) (string, []byte, error) {
+	id, header, ok := parseHeader(data)
+	if !ok {
+		return "", nil, errMalformed
+	}
+	aead, err := c.aead(id, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) < header+aead.NonceSize()+aead.Overhead() {
+		return "", nil, errMalformed
+	}
+
+	nonce := data[header : header+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[header+aead.NonceSize():], data[:header])
+	if err != nil {
+		return "", nil, fmt.Errorf("encrypt: key %s: %w", id, err)
+	}
+	return id, plain, nil
+}
+
+// aead returns the cipher of the key id, built from key or else from the key of the
+// KeyProvider.
+func (c *Codec) aead(id string, key []byte) (cipher.AEAD, error) {
+	if aead, ok := c.aeads.Load(id); ok {
+		return aead.(cipher.AEAD), nil
+	}
+
+	if key == nil {
+		var err error
+		if key, err = c.keys.Key(id); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: key %s: %w", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: key %s: %w", id, err)
+	}
+	c.aeads.Store(id, aead)
+
+	return aead, nil
+}
+
+// parseHeader returns the key ID of data and the length of its header.
+func parseHeader(data []byte) (id string, header int, ok bool) {
+	if len(data) < 2 || data[0] != version {
+		return "", 0, false
+	}
+	header = 2 + int(data[1])
+	if len(data) < header {
+		return "", 0, false
+	}
+	return string(data[2:header]), header, true
+}
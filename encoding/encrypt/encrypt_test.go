@@ -0,0 +1,104 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+	"github.com/mgtv-tech/jetcache-go/encoding/json"
+)
+
+type testValue struct {
+	Name  string
+	Email string
+}
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestCodec(t *testing.T) {
+	c := New(encoding.GetCodec(json.Name), NewStaticKeys("k1", map[string][]byte{"k1": key1}))
+	assert.Equal(t, "json+encrypt", c.Name())
+
+	want := &testValue{Name: "jetcache", Email: "jetcache@example.com"}
+	b, err := c.Marshal(want)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(b, []byte("jetcache")))
+	assert.Equal(t, []byte{version, 2, 'k', '1'}, b[:4])
+
+	var got testValue
+	require.NoError(t, c.Unmarshal(b, &got))
+	assert.Equal(t, want, &got)
+
+	// A fresh nonce every time.
+	b2, err := c.Marshal(want)
+	require.NoError(t, err)
+	assert.NotEqual(t, b, b2)
+}
+
+func TestCodec_Rotation(t *testing.T) {
+	old := New(encoding.GetCodec(json.Name), NewStaticKeys("k1", map[string][]byte{"k1": key1}))
+	rotated := New(encoding.GetCodec(json.Name), NewStaticKeys("k2", map[string][]byte{"k1": key1, "k2": key2}))
+
+	b, err := old.Marshal(&testValue{Name: "jetcache"})
+	require.NoError(t, err)
+
+	var got testValue
+	require.NoError(t, rotated.Unmarshal(b, &got))
+	assert.Equal(t, "jetcache", got.Name)
+
+	resealed, ok, err := rotated.Reseal(b)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	id, _, _ := parseHeader(resealed)
+	assert.Equal(t, "k2", id)
+
+	again, ok, err := rotated.Reseal(resealed)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, resealed, again)
+
+	got = testValue{}
+	require.NoError(t, rotated.Unmarshal(resealed, &got))
+	assert.Equal(t, "jetcache", got.Name)
+
+	// The old codec does not know k2.
+	assert.ErrorIs(t, old.Unmarshal(resealed, &got), ErrUnknownKey)
+}
+
+func TestCodec_Errors(t *testing.T) {
+	c := New(encoding.GetCodec(json.Name), NewStaticKeys("k1", map[string][]byte{"k1": key1}), WithName("pii"))
+	assert.Equal(t, "pii", c.Name())
+
+	b, err := c.Marshal(&testValue{Name: "jetcache"})
+	require.NoError(t, err)
+
+	var got testValue
+	tampered := append([]byte(nil), b...)
+	tampered[len(tampered)-1] ^= 0xff
+	assert.Error(t, c.Unmarshal(tampered, &got))
+
+	// The key ID is authenticated.
+	other := New(encoding.GetCodec(json.Name), NewStaticKeys("k1", map[string][]byte{"k1": key1, "k3": key1}))
+	relabeled := append([]byte(nil), b...)
+	relabeled[3] = '3'
+	assert.Error(t, other.Unmarshal(relabeled, &got))
+
+	for _, data := range [][]byte{nil, {version}, {2, 0}, {version, 4, 'k'}, {version, 2, 'k', '1', 0}} {
+		assert.Error(t, c.Unmarshal(data, &got))
+	}
+	_, _, err = c.Reseal([]byte{2})
+	assert.ErrorIs(t, err, errMalformed)
+
+	bad := New(encoding.GetCodec(json.Name), NewStaticKeys("k1", map[string][]byte{"k1": []byte("short")}))
+	_, err = bad.Marshal(&testValue{})
+	assert.Error(t, err)
+	missing := New(encoding.GetCodec(json.Name), NewStaticKeys("k9", nil))
+	_, err = missing.Marshal(&testValue{})
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
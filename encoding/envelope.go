@@ -0,0 +1,97 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// envelopeMagic starts every envelope and checksum frame. 0xc1 is never used by
+	// msgpack nor json, and 0xc1 0x00 never starts the s2 block of a compressed
+	// msgpack value, whose uvarint length has no trailing zero byte. A value of
+	// another codec may still start like an envelope: caches fall back to their
+	// codec when an envelope fails to open.
+	envelopeMagic   = "\xc1\x00jc"
+	envelopeVersion = 0x01
+	// envelopeHeaderLen is the length of the header before the codec name.
+	envelopeHeaderLen = len(envelopeMagic) + 2
+)
+
+// ErrUnknownCodec is returned by Open for an envelope naming a codec that is not
+// registered.
+var ErrUnknownCodec = errors.New("encoding: unknown codec in envelope")
+
+// Seal returns the wire format of v by codec, in an envelope naming the codec, so
+// that Open decodes it with the same codec whatever codec the reader is configured
+// with. The envelope is: the magic bytes, version byte, name length byte, codec
+// name, then the wire format.
+func Seal(codec Codec, v any) ([]byte, error) {
+	name := strings.ToLower(codec.Name())
+	if len(name) > 0xff {
+		return nil, fmt.Errorf("encoding: codec name %q is too long for an envelope", name)
+	}
+
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, envelopeHeaderLen+len(name)+len(payload))
+	b = append(b, envelopeMagic...)
+	b = append(b, envelopeVersion, byte(len(name)))
+	b = append(b, name...)
+	return append(b, payload...), nil
+}
+
+// Open parses data into v, with the codec named by its envelope, or with fallback if
+// data has no envelope. An envelope naming fallback uses fallback itself rather than
+// the registered codec of that name.
+func Open(data []byte, v any, fallback Codec) error {
+	codec, payload, err := Resolve(data, fallback)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(payload, v)
+}
+
+// Resolve returns the codec to decode data with, as Open picks it, and the wire
+// format of data.
+func Resolve(data []byte, fallback Codec) (Codec, []byte, error) {
+	name, payload, ok := Envelope(data)
+	if !ok {
+		return fallback, data, nil
+	}
+
+	codec, err := resolve(name, fallback)
+	return codec, payload, err
+}
+
+func resolve(name string, fallback Codec) (Codec, error) {
+	if strings.ToLower(fallback.Name()) == name {
+		return fallback, nil
+	}
+	if codec := GetCodec(name); codec != nil {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+}
+
+// Envelope returns the codec name and the wire format of data sealed by Seal, or
+// false if data has no envelope.
+func Envelope(data []byte) (name string, payload []byte, ok bool) {
+	if !hasMagic(data) || len(data) < envelopeHeaderLen || data[len(envelopeMagic)] != envelopeVersion {
+		return "", nil, false
+	}
+
+	n := envelopeHeaderLen + int(data[envelopeHeaderLen-1])
+	if n == envelopeHeaderLen || len(data) < n {
+		return "", nil, false
+	}
+	return string(data[envelopeHeaderLen:n]), data[n:], true
+}
+
+// hasMagic reports whether data starts with envelopeMagic.
+func hasMagic(data []byte) bool {
+	return len(data) >= len(envelopeMagic) && string(data[:len(envelopeMagic)]) == envelopeMagic
+}
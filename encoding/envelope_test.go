@@ -0,0 +1,87 @@
+package encoding
+
+import (
+	"errors"
+	"testing"
+)
+
+type envelopeValue struct {
+	Name string `xml:"name"`
+}
+
+// codec3 is a Codec implementation registered under another name than codec2.
+type codec3 struct {
+	codec2
+}
+
+func (codec3) Name() string {
+	return "XML3"
+}
+
+// codec4 is a Codec implementation that is never registered.
+type codec4 struct {
+	codec2
+}
+
+func (codec4) Name() string {
+	return "xml4"
+}
+
+func TestEnvelope(t *testing.T) {
+	RegisterCodec(codec2{})
+	RegisterCodec(codec3{})
+
+	b, err := Seal(codec3{}, &envelopeValue{Name: "jetcache"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, payload, ok := Envelope(b)
+	if !ok || name != "xml3" {
+		t.Fatalf("Envelope() got (%s, %v) want (xml3, true)", name, ok)
+	}
+	if string(payload) != "<envelopeValue><name>jetcache</name></envelopeValue>" {
+		t.Fatalf("Envelope() payload got %s", payload)
+	}
+
+	// The codec of the envelope wins over the fallback.
+	var got envelopeValue
+	if err = Open(b, &got, codec{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "jetcache" {
+		t.Fatalf("Open() got %q want jetcache", got.Name)
+	}
+
+	// Data without envelope uses the fallback.
+	got = envelopeValue{}
+	if err = Open(payload, &got, codec2{}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "jetcache" {
+		t.Fatalf("Open() got %q want jetcache", got.Name)
+	}
+
+	header := func(b ...byte) []byte {
+		return append([]byte(envelopeMagic), b...)
+	}
+	for _, data := range [][]byte{nil, {0xc1, envelopeVersion, 1, 'x'}, header(), header(envelopeVersion, 0), header(envelopeVersion, 4, 'x'), header(2, 1, 'x')} {
+		if _, _, ok = Envelope(data); ok {
+			t.Fatalf("Envelope(%v) got an envelope", data)
+		}
+	}
+
+	// An envelope naming the fallback uses it, registered or not.
+	b, err = Seal(codec4{}, &envelopeValue{Name: "jetcache"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := Resolve(b, codec4{})
+	if err != nil || c != (codec4{}) {
+		t.Fatalf("Resolve() got (%v, %v) want codec4", c, err)
+	}
+
+	b = append(header(envelopeVersion, 7), "unknown{}"...)
+	if err = Open(b, &got, codec2{}); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("Open() error got %v want %v", err, ErrUnknownCodec)
+	}
+}
@@ -0,0 +1,226 @@
+package protobuf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+)
+
+// Name is the name registered for the protobuf codec.
+const Name = "protobuf"
+
+// ErrNotMessage is returned for values that are neither a proto.Message, a pointer
+// to one, nor a Slice or a Map of messages.
+var ErrNotMessage = errors.New("protobuf: value is not a proto.Message")
+
+// emptyMarker is the wire format of the values that encode to nothing, such as a
+// message with all fields at their default, as the cache reads empty data as a
+// miss. Field number 0 is invalid, so no message encodes to it.
+var emptyMarker = []byte{0}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type (
+	// codec is a Codec implementation with protobuf.
+	codec struct{}
+
+	// Slice is a list of messages, encoded as `repeated M list = 1;`.
+	Slice[M proto.Message] []M
+
+	// Map is a map of messages, encoded as `map<string, M> map = 1;`.
+	Map[M proto.Message] map[string]M
+
+	// wrapper is implemented by Slice and Map.
+	wrapper interface {
+		marshalProto() ([]byte, error)
+	}
+
+	// unwrapper is implemented by *Slice and *Map.
+	unwrapper interface {
+		unmarshalProto(data []byte) error
+	}
+)
+
+func (codec) Marshal(v any) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	switch v := v.(type) {
+	case proto.Message:
+		b, err = proto.Marshal(v)
+	case wrapper:
+		b, err = v.marshalProto()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrNotMessage, v)
+	}
+	if err == nil && len(b) == 0 {
+		b = append(b, emptyMarker...)
+	}
+
+	return b, err
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	if bytes.Equal(data, emptyMarker) {
+		data = nil
+	}
+
+	switch v := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, v)
+	case unwrapper:
+		return v.unmarshalProto(data)
+	}
+
+	// A pointer to a message pointer, e.g. **pb.User, gets a new message.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Elem().Kind() == reflect.Pointer {
+		msg, ok := reflect.New(rv.Elem().Type().Elem()).Interface().(proto.Message)
+		if ok {
+			if err := proto.Unmarshal(data, msg); err != nil {
+				return err
+			}
+			rv.Elem().Set(reflect.ValueOf(msg))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %T", ErrNotMessage, v)
+}
+
+func (codec) Name() string {
+	return Name
+}
+
+func (s Slice[M]) marshalProto() ([]byte, error) {
+	var b []byte
+	for _, msg := range s {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, data)
+	}
+
+	return b, nil
+}
+
+func (s *Slice[M]) unmarshalProto(data []byte) error {
+	list := Slice[M]{}
+	err := consumeFields(data, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		msg := newMessage[M]()
+		if err := proto.Unmarshal(value, msg); err != nil {
+			return err
+		}
+		list = append(list, msg)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*s = list
+	return nil
+}
+
+func (m Map[M]) marshalProto() ([]byte, error) {
+	var b []byte
+	for key, msg := range m {
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, data)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	return b, nil
+}
+
+func (m *Map[M]) unmarshalProto(data []byte) error {
+	entries := Map[M]{}
+	err := consumeFields(data, func(num protowire.Number, entry []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var key string
+		msg := newMessage[M]()
+		err := consumeFields(entry, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				key = string(value)
+			case 2:
+				return proto.Unmarshal(value, msg)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		entries[key] = msg
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*m = entries
+	return nil
+}
+
+// consumeFields calls fn with the length-delimited fields of data, and skips the
+// others.
+func consumeFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newMessage returns a new empty message of type M.
+func newMessage[M proto.Message]() M {
+	var zero M
+	return zero.ProtoReflect().Type().New().Interface().(M)
+}
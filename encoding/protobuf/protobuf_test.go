@@ -0,0 +1,175 @@
+package protobuf
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/mgtv-tech/jetcache-go/encoding"
+	_ "github.com/mgtv-tech/jetcache-go/encoding/msgpack"
+	_ "github.com/mgtv-tech/jetcache-go/encoding/sonic"
+)
+
+func TestCodec(t *testing.T) {
+	c := encoding.GetCodec(Name)
+	require.NotNil(t, c)
+	assert.Equal(t, Name, c.Name())
+
+	b, err := c.Marshal(wrapperspb.String("jetcache"))
+	require.NoError(t, err)
+
+	var got wrapperspb.StringValue
+	require.NoError(t, c.Unmarshal(b, &got))
+	assert.Equal(t, "jetcache", got.GetValue())
+
+	var ptr *wrapperspb.StringValue
+	require.NoError(t, c.Unmarshal(b, &ptr))
+	assert.Equal(t, "jetcache", ptr.GetValue())
+}
+
+func TestCodec_Empty(t *testing.T) {
+	c := encoding.GetCodec(Name)
+
+	// A message with all fields at their default is not stored as empty data, a miss.
+	b, err := c.Marshal(wrapperspb.String(""))
+	require.NoError(t, err)
+	assert.NotEmpty(t, b)
+
+	got := wrapperspb.String("stale")
+	require.NoError(t, c.Unmarshal(b, got))
+	assert.Equal(t, "", got.GetValue())
+
+	var ptr *wrapperspb.StringValue
+	require.NoError(t, c.Unmarshal(b, &ptr))
+	assert.NotNil(t, ptr)
+
+	b, err = c.Marshal(Slice[*wrapperspb.StringValue]{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, b)
+	var list Slice[*wrapperspb.StringValue]
+	require.NoError(t, c.Unmarshal(b, &list))
+	assert.NotNil(t, list)
+	assert.Empty(t, list)
+}
+
+func TestCodec_Slice(t *testing.T) {
+	c := encoding.GetCodec(Name)
+	want := Slice[*wrapperspb.StringValue]{wrapperspb.String("a"), wrapperspb.String(""), wrapperspb.String("c")}
+	b, err := c.Marshal(want)
+	require.NoError(t, err)
+
+	var got Slice[*wrapperspb.StringValue]
+	require.NoError(t, c.Unmarshal(b, &got))
+	require.Len(t, got, 3)
+	for i := range want {
+		assert.True(t, proto.Equal(want[i], got[i]))
+	}
+
+	b, err = c.Marshal(&want)
+	require.NoError(t, err)
+	got = nil
+	require.NoError(t, c.Unmarshal(b, &got))
+	assert.Len(t, got, 3)
+}
+
+func TestCodec_Map(t *testing.T) {
+	c := encoding.GetCodec(Name)
+	want := Map[*wrapperspb.Int64Value]{"a": wrapperspb.Int64(1), "b": wrapperspb.Int64(2)}
+	b, err := c.Marshal(want)
+	require.NoError(t, err)
+
+	var got Map[*wrapperspb.Int64Value]
+	require.NoError(t, c.Unmarshal(b, &got))
+	require.Len(t, got, 2)
+	assert.Equal(t, int64(1), got["a"].GetValue())
+	assert.Equal(t, int64(2), got["b"].GetValue())
+}
+
+func TestCodec_Errors(t *testing.T) {
+	c := encoding.GetCodec(Name)
+
+	_, err := c.Marshal(struct{ Name string }{"jetcache"})
+	assert.ErrorIs(t, err, ErrNotMessage)
+	assert.ErrorContains(t, err, "struct { Name string }")
+
+	var s string
+	assert.ErrorIs(t, c.Unmarshal([]byte{}, &s), ErrNotMessage)
+	var sp *string
+	assert.ErrorIs(t, c.Unmarshal([]byte{}, &sp), ErrNotMessage)
+
+	var got Slice[*wrapperspb.StringValue]
+	assert.Error(t, c.Unmarshal([]byte{0x0a, 0x05, 'a'}, &got))
+	var m Map[*wrapperspb.StringValue]
+	assert.Error(t, c.Unmarshal([]byte{0xff}, &m))
+}
+
+type benchField struct {
+	Name     string
+	Number   int32
+	Label    int32
+	Type     int32
+	JsonName string
+}
+
+type benchMessage struct {
+	Name   string
+	Fields []benchField
+}
+
+func newBenchValues() (*descriptorpb.DescriptorProto, *benchMessage) {
+	msg := &descriptorpb.DescriptorProto{Name: proto.String("User")}
+	value := &benchMessage{Name: "User"}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("field_%d", i)
+		msg.Field = append(msg.Field, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			JsonName: proto.String(name),
+		})
+		value.Fields = append(value.Fields, benchField{Name: name, Number: int32(i + 1), Label: 1, Type: 9, JsonName: name})
+	}
+
+	return msg, value
+}
+
+func benchmarkCodec(b *testing.B, name string, v any, newV func() any) {
+	c := encoding.GetCodec(name)
+	data, err := c.Marshal(v)
+	require.NoError(b, err)
+
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ReportMetric(float64(len(data)), "bytes")
+		for i := 0; i < b.N; i++ {
+			_, _ = c.Marshal(v)
+		}
+	})
+	b.Run("Unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = c.Unmarshal(data, newV())
+		}
+	})
+}
+
+func BenchmarkProtobuf(b *testing.B) {
+	msg, _ := newBenchValues()
+	benchmarkCodec(b, Name, msg, func() any { return &descriptorpb.DescriptorProto{} })
+}
+
+func BenchmarkMsgpack(b *testing.B) {
+	_, value := newBenchValues()
+	benchmarkCodec(b, "msgpack", value, func() any { return &benchMessage{} })
+}
+
+func BenchmarkSonic(b *testing.B) {
+	_, value := newBenchValues()
+	benchmarkCodec(b, "sonic", value, func() any { return &benchMessage{} })
+}
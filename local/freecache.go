@@ -1,6 +1,7 @@
 package local
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"sync"
@@ -12,7 +13,10 @@ import (
 	"github.com/mgtv-tech/jetcache-go/util"
 )
 
-var _ Local = (*FreeCache)(nil)
+var (
+	_ Local    = (*FreeCache)(nil)
+	_ Extended = (*FreeCache)(nil)
+)
 
 var (
 	innerCache *freecache.Cache
@@ -21,6 +25,8 @@ var (
 
 type (
 	FreeCache struct {
+		cache          *freecache.Cache
+		isolated       bool
 		safeRand       *util.SafeRand
 		ttl            time.Duration
 		offset         time.Duration
@@ -28,8 +34,27 @@ type (
 	}
 	// Option defines the method to customize an Options.
 	Option func(o *FreeCache)
+
+	// FreeCacheStats is a snapshot of the statistics of the underlying freecache.
+	// For a shared FreeCache, it covers all the instances sharing the inner cache.
+	FreeCacheStats struct {
+		EntryCount     int64
+		EvacuateCount  int64
+		ExpiredCount   int64
+		OverwriteCount int64
+		HitCount       int64
+		MissCount      int64
+		HitRate        float64
+	}
 )
 
+// WithInnerKeyPrefix sets the prefix prepended to every key.
+func WithInnerKeyPrefix(innerKeyPrefix string) Option {
+	return func(o *FreeCache) {
+		o.innerKeyPrefix = innerKeyPrefix
+	}
+}
+
 // NewFreeCache Create a new cache instance, but the internal cache instances are shared,
 // and they will only be initialized once.
 func NewFreeCache(size Size, ttl time.Duration, innerKeyPrefix ...string) *FreeCache {
@@ -38,6 +63,28 @@ func NewFreeCache(size Size, ttl time.Duration, innerKeyPrefix ...string) *FreeC
 		prefix = innerKeyPrefix[0]
 	}
 
+	once.Do(func() {
+		innerCache = freecache.NewCache(int(normalizeFreeCacheSize(size)))
+	})
+
+	c := newFreeCache(innerCache, ttl)
+	c.innerKeyPrefix = prefix
+	return c
+}
+
+// NewIsolatedFreeCache creates a cache instance backed by its own freecache, so its
+// size is honored and other caches can not evict its entries.
+func NewIsolatedFreeCache(size Size, ttl time.Duration, opts ...Option) *FreeCache {
+	c := newFreeCache(freecache.NewCache(int(normalizeFreeCacheSize(size))), ttl)
+	c.isolated = true
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func newFreeCache(cache *freecache.Cache, ttl time.Duration) *FreeCache {
 	// avoid "expireSeconds <= 0 means no expire"
 	if ttl > 0 && ttl < time.Second {
 		ttl = time.Second
@@ -49,21 +96,21 @@ func NewFreeCache(size Size, ttl time.Duration, innerKeyPrefix ...string) *FreeC
 		offset = maxOffset
 	}
 
-	once.Do(func() {
-		if size < 512*KB || size > 8*GB {
-			size = 256 * MB
-		}
-		innerCache = freecache.NewCache(int(size))
-	})
-
 	return &FreeCache{
-		innerKeyPrefix: prefix,
-		safeRand:       util.NewSafeRand(),
-		ttl:            ttl,
-		offset:         offset,
+		cache:    cache,
+		safeRand: util.NewSafeRand(),
+		ttl:      ttl,
+		offset:   offset,
 	}
 }
 
+func normalizeFreeCacheSize(size Size) Size {
+	if size < 512*KB || size > 8*GB {
+		return 256 * MB
+	}
+	return size
+}
+
 func (c *FreeCache) UseRandomizedTTL(offset time.Duration) {
 	c.offset = offset
 }
@@ -74,13 +121,13 @@ func (c *FreeCache) Set(key string, b []byte) {
 		ttl += time.Duration(c.safeRand.Int63n(int64(c.offset)))
 	}
 
-	if err := innerCache.Set(util.Bytes(c.Key(key)), b, int(ttl.Seconds())); err != nil {
+	if err := c.cache.Set(util.Bytes(c.Key(key)), b, int(ttl.Seconds())); err != nil {
 		logger.Error("freeCache set(%s) error(%v)", key, err)
 	}
 }
 
 func (c *FreeCache) Get(key string) ([]byte, bool) {
-	b, err := innerCache.Get(util.Bytes(c.Key(key)))
+	b, err := c.cache.Get(util.Bytes(c.Key(key)))
 	if err != nil {
 		if errors.Is(err, freecache.ErrNotFound) {
 			return nil, false
@@ -93,7 +140,7 @@ func (c *FreeCache) Get(key string) ([]byte, bool) {
 }
 
 func (c *FreeCache) Del(key string) {
-	innerCache.Del(util.Bytes(c.Key(key)))
+	c.cache.Del(util.Bytes(c.Key(key)))
 }
 
 func (c *FreeCache) Key(key string) string {
@@ -103,3 +150,96 @@ func (c *FreeCache) Key(key string) string {
 
 	return fmt.Sprintf("%s:%s", c.innerKeyPrefix, key)
 }
+
+// Len returns the number of entries under the inner key prefix. A shared FreeCache
+// without a prefix reports the whole shared cache. A shared FreeCache with a prefix
+// scans every entry of the shared cache, including those of other prefixes.
+func (c *FreeCache) Len() int {
+	if c.ownsAllEntries() {
+		return int(c.cache.EntryCount())
+	}
+
+	var n int
+	c.Range(func(string, []byte, time.Time) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// SizeBytes returns the key and value bytes under the inner key prefix. It scans
+// every entry of the underlying freecache, shared with other prefixes or not.
+func (c *FreeCache) SizeBytes() int64 {
+	var size int64
+	c.Range(func(key string, value []byte, _ time.Time) bool {
+		size += int64(len(c.Key(key)) + len(value))
+		return true
+	})
+	return size
+}
+
+// Clear deletes the entries under the inner key prefix. A shared FreeCache without
+// a prefix clears the whole shared cache. A shared FreeCache with a prefix scans
+// every entry of the shared cache and deletes its own one by one.
+func (c *FreeCache) Clear() {
+	if c.ownsAllEntries() {
+		c.cache.Clear()
+		return
+	}
+
+	var keys []string
+	c.Range(func(key string, _ []byte, _ time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		c.Del(key)
+	}
+}
+
+// Range calls fn for the entries under the inner key prefix. A shared FreeCache with
+// a prefix scans every entry of the shared cache to find them.
+func (c *FreeCache) Range(fn func(key string, value []byte, expiresAt time.Time) bool) {
+	var prefix []byte
+	if c.innerKeyPrefix != "" {
+		prefix = []byte(c.Key(""))
+	}
+
+	it := c.cache.NewIterator()
+	for entry := it.Next(); entry != nil; entry = it.Next() {
+		if !bytes.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		var expiresAt time.Time
+		if entry.ExpireAt > 0 {
+			expiresAt = time.Unix(int64(entry.ExpireAt), 0)
+		}
+		if !fn(string(entry.Key[len(prefix):]), entry.Value, expiresAt) {
+			return
+		}
+	}
+}
+
+// Evictions returns the number of entries evacuated from the underlying freecache.
+// freecache does not count them per key, so a shared FreeCache reports the evictions
+// of all the instances sharing the inner cache, whatever their prefix.
+func (c *FreeCache) Evictions() uint64 {
+	return uint64(c.cache.EvacuateCount())
+}
+
+// Stats returns the statistics of the underlying freecache.
+func (c *FreeCache) Stats() FreeCacheStats {
+	return FreeCacheStats{
+		EntryCount:     c.cache.EntryCount(),
+		EvacuateCount:  c.cache.EvacuateCount(),
+		ExpiredCount:   c.cache.ExpiredCount(),
+		OverwriteCount: c.cache.OverwriteCount(),
+		HitCount:       c.cache.HitCount(),
+		MissCount:      c.cache.MissCount(),
+		HitRate:        c.cache.HitRate(),
+	}
+}
+
+func (c *FreeCache) ownsAllEntries() bool {
+	return c.isolated || c.innerKeyPrefix == ""
+}
@@ -99,3 +99,90 @@ loop:
 		}
 	}
 }
+
+func TestFreeCache_Extended(t *testing.T) {
+	cache := NewFreeCache(10*MB, time.Minute, "extended")
+	other := NewFreeCache(10*MB, time.Minute, "other")
+	cache.Set("key1", []byte("value1"))
+	cache.Set("key2", []byte("value2"))
+	other.Set("key1", []byte("value1"))
+
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(2*len("extended:key1value1")), cache.SizeBytes())
+
+	got := make(map[string]string)
+	cache.Range(func(key string, value []byte, expiresAt time.Time) bool {
+		got[key] = string(value)
+		assert.True(t, expiresAt.After(time.Now()))
+		return true
+	})
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "value2"}, got)
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+	_, ok := cache.Get("key1")
+	assert.False(t, ok)
+	_, ok = other.Get("key1")
+	assert.True(t, ok)
+}
+
+func TestFreeCache_Evictions(t *testing.T) {
+	cache := NewIsolatedFreeCache(512*KB, time.Minute)
+	// A value is at most 1/1024 of the cache size.
+	value := make([]byte, 256)
+	for i := 0; i < 4096; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), value)
+	}
+
+	assert.Greater(t, cache.Evictions(), uint64(0))
+	assert.Less(t, cache.Len(), 4096)
+}
+
+func TestNewIsolatedFreeCache(t *testing.T) {
+	t.Run("Test default", func(t *testing.T) {
+		cache := NewIsolatedFreeCache(10*MB, time.Millisecond)
+		assert.True(t, cache.isolated)
+		assert.Equal(t, time.Second, cache.ttl)
+		assert.Equal(t, time.Second/10, cache.offset)
+		assert.Equal(t, "", cache.innerKeyPrefix)
+		assert.NotSame(t, innerCache, cache.cache)
+	})
+
+	t.Run("Test with inner key prefix", func(t *testing.T) {
+		cache := NewIsolatedFreeCache(10*MB, time.Second, WithInnerKeyPrefix("any"))
+		assert.Equal(t, "any:key", cache.Key("key"))
+	})
+
+	t.Run("Test isolation", func(t *testing.T) {
+		cache1 := NewIsolatedFreeCache(10*MB, time.Minute)
+		cache2 := NewIsolatedFreeCache(10*MB, time.Minute)
+
+		cache1.Set("key1", []byte("value1"))
+		_, ok := cache2.Get("key1")
+		assert.False(t, ok)
+		val, ok := cache1.Get("key1")
+		assert.True(t, ok)
+		assert.Equal(t, []byte("value1"), val)
+
+		cache2.Set("key2", []byte("value2"))
+		cache2.Clear()
+		assert.Equal(t, 1, cache1.Len())
+		assert.Equal(t, 0, cache2.Len())
+	})
+
+	t.Run("Test stats", func(t *testing.T) {
+		cache := NewIsolatedFreeCache(10*MB, time.Minute, WithInnerKeyPrefix("stats"))
+		cache.Set("key1", []byte("value1"))
+		cache.Set("key1", []byte("value2"))
+		cache.Get("key1")
+		cache.Get("key2")
+
+		stats := cache.Stats()
+		assert.Equal(t, int64(1), stats.EntryCount)
+		assert.Equal(t, int64(1), stats.OverwriteCount)
+		assert.Equal(t, int64(1), stats.HitCount)
+		assert.Equal(t, int64(1), stats.MissCount)
+		assert.Equal(t, 0.5, stats.HitRate)
+		assert.Equal(t, 1, cache.Len())
+	})
+}
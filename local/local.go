@@ -1,5 +1,7 @@
 package local
 
+import "time"
+
 type Local interface {
 	// Set stores the given data with the specified key.
 	Set(key string, data []byte)
@@ -11,3 +13,32 @@ type Local interface {
 	// Del deletes the data associated with the specified key.
 	Del(key string)
 }
+
+// Clearer is an optional interface implemented by Local caches that can remove all
+// their entries, e.g. to resync after missed invalidations.
+type Clearer interface {
+	// Clear removes all entries from the cache.
+	Clear()
+}
+
+// Extended is an optional interface implemented by Local caches that can report
+// their contents. It is meant for admin tooling and debugging, not the hot path.
+type Extended interface {
+	Local
+
+	// Len returns the number of entries held by the cache.
+	Len() int
+
+	// SizeBytes returns the number of key and value bytes held by the cache.
+	SizeBytes() int64
+
+	// Clear removes all entries from the cache.
+	Clear()
+
+	// Range calls fn for each live entry until fn returns false. A zero expiresAt
+	// means the entry never expires. The order of the entries is not guaranteed.
+	Range(fn func(key string, value []byte, expiresAt time.Time) bool)
+
+	// Evictions returns the number of entries evicted to make room for new ones.
+	Evictions() uint64
+}
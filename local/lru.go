@@ -0,0 +1,322 @@
+package local
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const (
+	defaultLRUShards = 16
+	maxShards        = 1024
+	// minShardSize is the least capacity of a shard: smaller caches get fewer shards,
+	// down to one, so that a shard still holds entries.
+	minShardSize = 4 * KB
+)
+
+var (
+	_ Local    = (*LRU)(nil)
+	_ Extended = (*LRU)(nil)
+)
+
+const (
+	// EvictReasonCapacity means the entry was evicted to stay within the byte budget.
+	EvictReasonCapacity EvictReason = iota + 1
+	// EvictReasonExpired means the entry was removed because its ttl elapsed.
+	EvictReasonExpired
+)
+
+type (
+	// EvictReason describes why an entry was removed by the cache itself.
+	EvictReason int
+
+	// LRU is a sharded, byte-budgeted least-recently-used cache with exact per-entry expiry.
+	// Unlike TinyLFU, a Set is never dropped unless the entry is larger than a shard's budget.
+	LRU struct {
+		shards    []*lruShard
+		mask      uint64
+		rand      *util.SafeRand
+		ttl       time.Duration
+		offset    time.Duration
+		onEvict   func(key string, value []byte, reason EvictReason)
+		evictions uint64
+	}
+
+	// LRUOption defines the method to customize an LRU.
+	LRUOption func(o *lruOptions)
+
+	lruOptions struct {
+		shards  int
+		onEvict func(key string, value []byte, reason EvictReason)
+	}
+
+	lruShard struct {
+		sync.Mutex
+		capacity int64
+		size     int64
+		ll       *list.List
+		items    map[string]*list.Element
+	}
+
+	lruEntry struct {
+		key       string
+		value     []byte
+		expiresAt time.Time
+	}
+)
+
+// WithLRUShards sets the number of shards, rounded up to a power of two. Default is 16.
+// Caches below 4KB per shard get fewer shards.
+func WithLRUShards(shards int) LRUOption {
+	return func(o *lruOptions) {
+		o.shards = shards
+	}
+}
+
+// WithLRUEvictCallback sets the function called after an entry is evicted or expires.
+// It is not called for Del or Clear.
+func WithLRUEvictCallback(onEvict func(key string, value []byte, reason EvictReason)) LRUOption {
+	return func(o *lruOptions) {
+		o.onEvict = onEvict
+	}
+}
+
+// NewLRU creates a sharded LRU holding at most size bytes of keys and values.
+// A ttl <= 0 means entries never expire.
+func NewLRU(size Size, ttl time.Duration, opts ...LRUOption) *LRU {
+	var o lruOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shards <= 0 {
+		o.shards = defaultLRUShards
+	}
+	shards := shardCount(o.shards, size)
+
+	const maxOffset = 10 * time.Second
+	offset := ttl / 10
+	if offset > maxOffset {
+		offset = maxOffset
+	}
+
+	c := &LRU{
+		shards:  make([]*lruShard, shards),
+		mask:    uint64(shards - 1),
+		rand:    util.NewSafeRand(),
+		ttl:     ttl,
+		offset:  offset,
+		onEvict: o.onEvict,
+	}
+	for i := range c.shards {
+		c.shards[i] = &lruShard{
+			capacity: int64(size) / int64(shards),
+			ll:       list.New(),
+			items:    make(map[string]*list.Element),
+		}
+	}
+
+	return c
+}
+
+func (c *LRU) UseRandomizedTTL(offset time.Duration) {
+	c.offset = offset
+}
+
+func (c *LRU) Set(key string, b []byte) {
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		ttl := c.ttl
+		if c.offset > 0 {
+			ttl += time.Duration(c.rand.Int63n(int64(c.offset)))
+		}
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	s := c.shard(key)
+	s.Lock()
+	evicted, expired := s.set(&lruEntry{key: key, value: b, expiresAt: expiresAt})
+	s.Unlock()
+
+	c.evicted(evicted, EvictReasonCapacity)
+	c.evicted(expired, EvictReasonExpired)
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	s := c.shard(key)
+	s.Lock()
+	elem, ok := s.items[key]
+	if !ok {
+		s.Unlock()
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.expired(time.Now()) {
+		s.remove(elem)
+		s.Unlock()
+		c.evicted([]*lruEntry{entry}, EvictReasonExpired)
+		return nil, false
+	}
+	s.ll.MoveToFront(elem)
+	s.Unlock()
+
+	return entry.value, true
+}
+
+func (c *LRU) Del(key string) {
+	s := c.shard(key)
+	s.Lock()
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+	s.Unlock()
+}
+
+func (c *LRU) Len() (n int) {
+	c.Range(func(string, []byte, time.Time) bool {
+		n++
+		return true
+	})
+	return
+}
+
+func (c *LRU) SizeBytes() (size int64) {
+	for _, s := range c.shards {
+		s.Lock()
+		size += s.size
+		s.Unlock()
+	}
+	return
+}
+
+func (c *LRU) Clear() {
+	for _, s := range c.shards {
+		s.Lock()
+		s.ll.Init()
+		s.items = make(map[string]*list.Element)
+		s.size = 0
+		s.Unlock()
+	}
+}
+
+func (c *LRU) Range(fn func(key string, value []byte, expiresAt time.Time) bool) {
+	now := time.Now()
+	for _, s := range c.shards {
+		s.Lock()
+		entries := make([]*lruEntry, 0, len(s.items))
+		for elem := s.ll.Front(); elem != nil; elem = elem.Next() {
+			if entry := elem.Value.(*lruEntry); !entry.expired(now) {
+				entries = append(entries, entry)
+			}
+		}
+		s.Unlock()
+
+		for _, entry := range entries {
+			if !fn(entry.key, entry.value, entry.expiresAt) {
+				return
+			}
+		}
+	}
+}
+
+func (c *LRU) Evictions() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
+
+func (c *LRU) shard(key string) *lruShard {
+	return c.shards[fnv64a(key)&c.mask]
+}
+
+// evicted counts the evicted entries and reports them to the callback. It must be
+// called without holding a shard lock.
+func (c *LRU) evicted(entries []*lruEntry, reason EvictReason) {
+	if len(entries) == 0 {
+		return
+	}
+	if reason == EvictReasonCapacity {
+		atomic.AddUint64(&c.evictions, uint64(len(entries)))
+	}
+	if c.onEvict == nil {
+		return
+	}
+	for _, entry := range entries {
+		util.WithRecover(func() {
+			c.onEvict(entry.key, entry.value, reason)
+		})
+	}
+}
+
+// set stores the entry and returns the entries removed to make room for it.
+func (s *lruShard) set(entry *lruEntry) (evicted, expired []*lruEntry) {
+	if elem, ok := s.items[entry.key]; ok {
+		s.remove(elem)
+	}
+
+	size := entry.size()
+	if size > s.capacity {
+		return
+	}
+
+	s.items[entry.key] = s.ll.PushFront(entry)
+	s.size += size
+
+	now := time.Now()
+	for s.size > s.capacity {
+		elem := s.ll.Back()
+		victim := elem.Value.(*lruEntry)
+		s.remove(elem)
+		if victim.expired(now) {
+			expired = append(expired, victim)
+		} else {
+			evicted = append(evicted, victim)
+		}
+	}
+
+	return
+}
+
+func (s *lruShard) remove(elem *list.Element) {
+	entry := s.ll.Remove(elem).(*lruEntry)
+	delete(s.items, entry.key)
+	s.size -= entry.size()
+}
+
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *lruEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// shardCount rounds n up to a power of two, capped at maxShards and so that every
+// shard of a cache of size gets at least minShardSize.
+func shardCount(n int, size Size) int {
+	if n > maxShards {
+		n = maxShards
+	}
+	shards := 1
+	for shards < n {
+		shards <<= 1
+	}
+	for shards > 1 && size/Size(shards) < minShardSize {
+		shards >>= 1
+	}
+	return shards
+}
+
+// fnv64a is an inline FNV-1a hash, avoiding the allocation of hash/fnv.
+func fnv64a(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
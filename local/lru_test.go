@@ -0,0 +1,164 @@
+package local
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLRU(t *testing.T) {
+	t.Run("Test default", func(t *testing.T) {
+		cache := NewLRU(MB, time.Second)
+		assert.Equal(t, defaultLRUShards, len(cache.shards))
+		assert.Equal(t, time.Second/10, cache.offset)
+		cache.UseRandomizedTTL(time.Millisecond)
+		assert.Equal(t, time.Millisecond, cache.offset)
+	})
+
+	t.Run("Test shards", func(t *testing.T) {
+		assert.Equal(t, 8, len(NewLRU(MB, time.Second, WithLRUShards(5)).shards))
+		assert.Equal(t, 1, len(NewLRU(MB, time.Second, WithLRUShards(1)).shards))
+		assert.Equal(t, maxShards, len(NewLRU(4*MB, time.Second, WithLRUShards(1e6)).shards))
+	})
+
+	t.Run("Test small size", func(t *testing.T) {
+		assert.Equal(t, 2, len(NewLRU(8*KB, time.Second).shards))
+		cache := NewLRU(100*Byte, time.Second)
+		assert.Equal(t, 1, len(cache.shards))
+		cache.Set("key1", []byte("value1"))
+		val, ok := cache.Get("key1")
+		assert.True(t, ok)
+		assert.Equal(t, "value1", string(val))
+	})
+
+	t.Run("Test limited offset", func(t *testing.T) {
+		cache := NewLRU(MB, time.Hour)
+		assert.Equal(t, 10*time.Second, cache.offset)
+	})
+}
+
+func TestLRU_SetAndGet(t *testing.T) {
+	cache := NewLRU(MB, time.Second)
+	key1 := "key1"
+	val, exists := cache.Get(key1)
+	assert.False(t, exists)
+	assert.Equal(t, []byte(nil), val)
+
+	cache.Set(key1, []byte("a"))
+	cache.Set(key1, []byte("b"))
+	cache.Set(key1, []byte("value1"))
+	val, exists = cache.Get(key1)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("value1"), val)
+	assert.Equal(t, int64(len("key1value1")), cache.SizeBytes())
+
+	cache.Del(key1)
+	val, exists = cache.Get(key1)
+	assert.False(t, exists)
+	assert.Equal(t, []byte(nil), val)
+	assert.Equal(t, int64(0), cache.SizeBytes())
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reasons = make(map[string]EvictReason)
+	)
+	cache := NewLRU(MB, 0, WithLRUEvictCallback(func(key string, value []byte, reason EvictReason) {
+		mu.Lock()
+		reasons[key] = reason
+		mu.Unlock()
+	}))
+	cache.ttl = 50 * time.Millisecond
+	cache.UseRandomizedTTL(0)
+
+	cache.Set("key1", []byte("value1"))
+	_, exists := cache.Get("key1")
+	assert.True(t, exists)
+
+	time.Sleep(60 * time.Millisecond)
+	_, exists = cache.Get("key1")
+	assert.False(t, exists)
+	assert.Equal(t, map[string]EvictReason{"key1": EvictReasonExpired}, reasons)
+	assert.Equal(t, uint64(0), cache.Evictions())
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	var evicted []string
+	cache := NewLRU(30*Byte, time.Minute, WithLRUShards(1),
+		WithLRUEvictCallback(func(key string, value []byte, reason EvictReason) {
+			assert.Equal(t, EvictReasonCapacity, reason)
+			evicted = append(evicted, key)
+		}))
+
+	cache.Set("key1", []byte("value1"))
+	cache.Set("key2", []byte("value2"))
+	cache.Set("key3", []byte("value3"))
+	// key1 becomes the most recently used
+	_, exists := cache.Get("key1")
+	assert.True(t, exists)
+	cache.Set("key4", []byte("value4"))
+
+	assert.Equal(t, []string{"key2"}, evicted)
+	assert.Equal(t, uint64(1), cache.Evictions())
+	assert.Equal(t, 3, cache.Len())
+	assert.Equal(t, int64(30), cache.SizeBytes())
+
+	// larger than the budget, never stored
+	cache.Set("key5", make([]byte, 64))
+	_, exists = cache.Get("key5")
+	assert.False(t, exists)
+}
+
+func TestLRU_Extended(t *testing.T) {
+	cache := NewLRU(MB, time.Minute)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("value"))
+	}
+	assert.Equal(t, 100, cache.Len())
+
+	got := make(map[string]string)
+	cache.Range(func(key string, value []byte, expiresAt time.Time) bool {
+		got[key] = string(value)
+		assert.True(t, expiresAt.After(time.Now()))
+		return true
+	})
+	assert.Equal(t, 100, len(got))
+
+	var n int
+	cache.Range(func(string, []byte, time.Time) bool {
+		n++
+		return n < 10
+	})
+	assert.Equal(t, 10, n)
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.SizeBytes())
+}
+
+func TestLRU_Concurrency(t *testing.T) {
+	cache := NewLRU(64*KB, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("key-%d-%d", i, j%100)
+				cache.Set(key, []byte(key))
+				if b, ok := cache.Get(key); ok {
+					assert.Equal(t, key, string(b))
+				}
+				if j%10 == 0 {
+					cache.Del(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.SizeBytes(), int64(64*KB))
+}
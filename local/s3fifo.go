@@ -0,0 +1,349 @@
+package local
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const (
+	defaultS3FIFOShards = 16
+	s3fifoMaxFreq       = 3
+	s3fifoSmallRatio    = 10 // percent of the budget given to the small queue.
+)
+
+var (
+	_ Local    = (*S3FIFO)(nil)
+	_ Extended = (*S3FIFO)(nil)
+)
+
+type (
+	// S3FIFO is a sharded, byte-budgeted cache using the S3-FIFO eviction policy:
+	// new entries go through a small probationary FIFO, entries read again are
+	// promoted to a main FIFO, and the keys of recently evicted one-hit entries are
+	// remembered in a ghost queue so they skip probation on their next insert.
+	// Hits only bump an atomic counter under a read lock.
+	//
+	// See https://blog.jasony.me/system/cache/2023/08/01/s3fifo.
+	S3FIFO struct {
+		shards    []*s3fifoShard
+		mask      uint64
+		rand      *util.SafeRand
+		ttl       time.Duration
+		offset    time.Duration
+		evictions uint64
+	}
+
+	// S3FIFOOption defines the method to customize an S3FIFO.
+	S3FIFOOption func(o *s3fifoOptions)
+
+	s3fifoOptions struct {
+		shards int
+	}
+
+	s3fifoShard struct {
+		sync.RWMutex
+		capacity  int64
+		smallCap  int64
+		smallSize int64
+		mainSize  int64
+		small     *list.List
+		main      *list.List
+		items     map[string]*s3fifoEntry
+		ghost     *list.List
+		ghostKeys map[string]*list.Element
+	}
+
+	s3fifoEntry struct {
+		key       string
+		value     []byte
+		expiresAt time.Time
+		freq      int32
+		inMain    bool
+		elem      *list.Element
+	}
+)
+
+// WithS3FIFOShards sets the number of shards, rounded up to a power of two. Default is 16.
+// Caches below 4KB per shard get fewer shards.
+func WithS3FIFOShards(shards int) S3FIFOOption {
+	return func(o *s3fifoOptions) {
+		o.shards = shards
+	}
+}
+
+// NewS3FIFO creates an S3-FIFO cache holding at most size bytes of keys and values.
+// A ttl <= 0 means entries never expire.
+func NewS3FIFO(size Size, ttl time.Duration, opts ...S3FIFOOption) *S3FIFO {
+	var o s3fifoOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shards <= 0 {
+		o.shards = defaultS3FIFOShards
+	}
+	shards := shardCount(o.shards, size)
+
+	const maxOffset = 10 * time.Second
+	offset := ttl / 10
+	if offset > maxOffset {
+		offset = maxOffset
+	}
+
+	c := &S3FIFO{
+		shards: make([]*s3fifoShard, shards),
+		mask:   uint64(shards - 1),
+		rand:   util.NewSafeRand(),
+		ttl:    ttl,
+		offset: offset,
+	}
+	for i := range c.shards {
+		capacity := int64(size) / int64(shards)
+		c.shards[i] = &s3fifoShard{
+			capacity:  capacity,
+			smallCap:  capacity * s3fifoSmallRatio / 100,
+			small:     list.New(),
+			main:      list.New(),
+			items:     make(map[string]*s3fifoEntry),
+			ghost:     list.New(),
+			ghostKeys: make(map[string]*list.Element),
+		}
+	}
+
+	return c
+}
+
+func (c *S3FIFO) UseRandomizedTTL(offset time.Duration) {
+	c.offset = offset
+}
+
+func (c *S3FIFO) Set(key string, b []byte) {
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		ttl := c.ttl
+		if c.offset > 0 {
+			ttl += time.Duration(c.rand.Int63n(int64(c.offset)))
+		}
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	s := c.shard(key)
+	s.Lock()
+	evicted := s.set(&s3fifoEntry{key: key, value: b, expiresAt: expiresAt})
+	s.Unlock()
+
+	if evicted > 0 {
+		atomic.AddUint64(&c.evictions, uint64(evicted))
+	}
+}
+
+func (c *S3FIFO) Get(key string) ([]byte, bool) {
+	s := c.shard(key)
+	s.RLock()
+	entry, ok := s.items[key]
+	if !ok {
+		s.RUnlock()
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		s.RUnlock()
+		s.Lock()
+		if e, ok := s.items[key]; ok && e == entry {
+			s.remove(entry)
+		}
+		s.Unlock()
+		return nil, false
+	}
+	if atomic.LoadInt32(&entry.freq) < s3fifoMaxFreq {
+		atomic.AddInt32(&entry.freq, 1)
+	}
+	s.RUnlock()
+
+	return entry.value, true
+}
+
+func (c *S3FIFO) Del(key string) {
+	s := c.shard(key)
+	s.Lock()
+	if entry, ok := s.items[key]; ok {
+		s.remove(entry)
+	}
+	s.Unlock()
+}
+
+func (c *S3FIFO) Len() (n int) {
+	c.Range(func(string, []byte, time.Time) bool {
+		n++
+		return true
+	})
+	return
+}
+
+func (c *S3FIFO) SizeBytes() (size int64) {
+	for _, s := range c.shards {
+		s.RLock()
+		size += s.smallSize + s.mainSize
+		s.RUnlock()
+	}
+	return
+}
+
+func (c *S3FIFO) Clear() {
+	for _, s := range c.shards {
+		s.Lock()
+		s.small.Init()
+		s.main.Init()
+		s.ghost.Init()
+		s.items = make(map[string]*s3fifoEntry)
+		s.ghostKeys = make(map[string]*list.Element)
+		s.smallSize, s.mainSize = 0, 0
+		s.Unlock()
+	}
+}
+
+func (c *S3FIFO) Range(fn func(key string, value []byte, expiresAt time.Time) bool) {
+	now := time.Now()
+	for _, s := range c.shards {
+		s.RLock()
+		entries := make([]*s3fifoEntry, 0, len(s.items))
+		for _, entry := range s.items {
+			if !entry.expired(now) {
+				entries = append(entries, entry)
+			}
+		}
+		s.RUnlock()
+
+		for _, entry := range entries {
+			if !fn(entry.key, entry.value, entry.expiresAt) {
+				return
+			}
+		}
+	}
+}
+
+func (c *S3FIFO) Evictions() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
+
+func (c *S3FIFO) shard(key string) *s3fifoShard {
+	return c.shards[fnv64a(key)&c.mask]
+}
+
+// set stores the entry and returns the number of entries evicted to make room for it.
+func (s *s3fifoShard) set(entry *s3fifoEntry) (evicted int) {
+	if old, ok := s.items[entry.key]; ok {
+		// Keep the position and frequency of an overwritten entry.
+		entry.freq = atomic.LoadInt32(&old.freq)
+		entry.inMain = old.inMain
+		entry.elem = old.elem
+		entry.elem.Value = entry
+		s.items[entry.key] = entry
+		s.addSize(entry, entry.size()-old.size())
+	} else {
+		size := entry.size()
+		if size > s.capacity {
+			return
+		}
+		if elem, ok := s.ghostKeys[entry.key]; ok {
+			s.ghost.Remove(elem)
+			delete(s.ghostKeys, entry.key)
+			entry.inMain = true
+			entry.elem = s.main.PushFront(entry)
+		} else {
+			entry.elem = s.small.PushFront(entry)
+		}
+		s.items[entry.key] = entry
+		s.addSize(entry, size)
+	}
+
+	now := time.Now()
+	for s.smallSize+s.mainSize > s.capacity {
+		if s.smallSize > s.smallCap || s.main.Len() == 0 {
+			evicted += s.evictSmall(now)
+		} else {
+			evicted += s.evictMain(now)
+		}
+	}
+
+	return
+}
+
+// evictSmall evicts the tail of the small queue, or promotes it to the main queue
+// if it was read since its insert.
+func (s *s3fifoShard) evictSmall(now time.Time) int {
+	entry := s.small.Back().Value.(*s3fifoEntry)
+	if atomic.LoadInt32(&entry.freq) > 0 && !entry.expired(now) {
+		s.small.Remove(entry.elem)
+		s.smallSize -= entry.size()
+		atomic.StoreInt32(&entry.freq, 0)
+		entry.inMain = true
+		entry.elem = s.main.PushFront(entry)
+		s.mainSize += entry.size()
+		return 0
+	}
+
+	s.remove(entry)
+	if entry.expired(now) {
+		return 0
+	}
+	s.addGhost(entry.key)
+	return 1
+}
+
+// evictMain evicts the tail of the main queue, or reinserts it with a decremented
+// frequency if it was read since it was last examined.
+func (s *s3fifoShard) evictMain(now time.Time) int {
+	entry := s.main.Back().Value.(*s3fifoEntry)
+	if freq := atomic.LoadInt32(&entry.freq); freq > 0 && !entry.expired(now) {
+		atomic.StoreInt32(&entry.freq, freq-1)
+		s.main.MoveToFront(entry.elem)
+		return 0
+	}
+
+	s.remove(entry)
+	if entry.expired(now) {
+		return 0
+	}
+	return 1
+}
+
+// addGhost remembers an evicted key. The ghost queue holds at most as many keys as
+// there are entries in the shard.
+func (s *s3fifoShard) addGhost(key string) {
+	if _, ok := s.ghostKeys[key]; ok {
+		return
+	}
+	s.ghostKeys[key] = s.ghost.PushFront(key)
+	for s.ghost.Len() > len(s.items) && s.ghost.Len() > 0 {
+		delete(s.ghostKeys, s.ghost.Remove(s.ghost.Back()).(string))
+	}
+}
+
+func (s *s3fifoShard) remove(entry *s3fifoEntry) {
+	if entry.inMain {
+		s.main.Remove(entry.elem)
+	} else {
+		s.small.Remove(entry.elem)
+	}
+	delete(s.items, entry.key)
+	s.addSize(entry, -entry.size())
+}
+
+func (s *s3fifoShard) addSize(entry *s3fifoEntry, delta int64) {
+	if entry.inMain {
+		s.mainSize += delta
+	} else {
+		s.smallSize += delta
+	}
+}
+
+func (e *s3fifoEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *s3fifoEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
@@ -0,0 +1,124 @@
+package local
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewS3FIFO(t *testing.T) {
+	cache := NewS3FIFO(MB, time.Second)
+	assert.Equal(t, defaultS3FIFOShards, len(cache.shards))
+	assert.Equal(t, time.Second/10, cache.offset)
+	cache.UseRandomizedTTL(time.Millisecond)
+	assert.Equal(t, time.Millisecond, cache.offset)
+	assert.Equal(t, 4, len(NewS3FIFO(MB, time.Second, WithS3FIFOShards(3)).shards))
+
+	key1 := "key1"
+	val, exists := cache.Get(key1)
+	assert.False(t, exists)
+	assert.Equal(t, []byte(nil), val)
+
+	cache.Set(key1, []byte("a"))
+	cache.Set(key1, []byte("value1"))
+	val, exists = cache.Get(key1)
+	assert.True(t, exists)
+	assert.Equal(t, []byte("value1"), val)
+	assert.Equal(t, int64(len("key1value1")), cache.SizeBytes())
+
+	cache.Del(key1)
+	val, exists = cache.Get(key1)
+	assert.False(t, exists)
+	assert.Equal(t, []byte(nil), val)
+	assert.Equal(t, int64(0), cache.SizeBytes())
+}
+
+func TestS3FIFO_Expiry(t *testing.T) {
+	cache := NewS3FIFO(MB, 50*time.Millisecond)
+	cache.UseRandomizedTTL(0)
+
+	cache.Set("key1", []byte("value1"))
+	_, exists := cache.Get("key1")
+	assert.True(t, exists)
+
+	time.Sleep(60 * time.Millisecond)
+	_, exists = cache.Get("key1")
+	assert.False(t, exists)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestS3FIFO_Eviction(t *testing.T) {
+	// Every entry is 10 bytes, the shard holds 10 of them and 1 in the small queue.
+	cache := NewS3FIFO(100*Byte, time.Minute, WithS3FIFOShards(1))
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key-%04d", i), []byte("vv"))
+	}
+	// key-0000 was read, so it survives the one-hit wonders.
+	_, exists := cache.Get("key-0000")
+	assert.True(t, exists)
+	for i := 10; i < 20; i++ {
+		cache.Set(fmt.Sprintf("key-%04d", i), []byte("vv"))
+	}
+
+	_, exists = cache.Get("key-0000")
+	assert.True(t, exists)
+	_, exists = cache.Get("key-0001")
+	assert.False(t, exists)
+	assert.Equal(t, uint64(10), cache.Evictions())
+	assert.LessOrEqual(t, cache.SizeBytes(), int64(100))
+
+	// evicted key-0001 is remembered by the ghost queue and goes straight to main.
+	cache.Set("key-0001", []byte("vv"))
+	assert.True(t, cache.shards[0].items["key-0001"].inMain)
+
+	// larger than the budget, never stored
+	cache.Set("key-large", make([]byte, 128))
+	_, exists = cache.Get("key-large")
+	assert.False(t, exists)
+}
+
+func TestS3FIFO_Extended(t *testing.T) {
+	cache := NewS3FIFO(MB, time.Minute)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("value"))
+	}
+	assert.Equal(t, 100, cache.Len())
+
+	got := make(map[string]string)
+	cache.Range(func(key string, value []byte, expiresAt time.Time) bool {
+		got[key] = string(value)
+		assert.True(t, expiresAt.After(time.Now()))
+		return true
+	})
+	assert.Equal(t, 100, len(got))
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.SizeBytes())
+}
+
+func TestS3FIFO_Concurrency(t *testing.T) {
+	cache := NewS3FIFO(64*KB, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("key-%d-%d", i, j%100)
+				cache.Set(key, []byte(key))
+				if b, ok := cache.Get(key); ok {
+					assert.Equal(t, key, string(b))
+				}
+				if j%10 == 0 {
+					cache.Del(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.SizeBytes(), int64(64*KB))
+}
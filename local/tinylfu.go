@@ -1,27 +1,126 @@
 package local
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/ristretto/v2"
+	"github.com/dgraph-io/ristretto/v2/z"
+
 	"github.com/mgtv-tech/jetcache-go/util"
 )
 
 const (
-	numCounters = 1e7 // number of keys to track frequency of (10M).
-	bufferItems = 64  // number of keys per Get buffer.
+	defaultNumCounters = 1e7 // number of keys to track frequency of (10M).
+	defaultBufferItems = 64  // number of keys per Get buffer.
+)
+
+var (
+	_ Local    = (*TinyLFU)(nil)
+	_ Clearer  = (*TinyLFU)(nil)
+	_ Extended = (*IndexedTinyLFU)(nil)
 )
 
-var _ Local = (*TinyLFU)(nil)
+type (
+	TinyLFU struct {
+		rand     *util.SafeRand
+		cache    *ristretto.Cache[string, []byte]
+		ttl      time.Duration
+		offset   time.Duration
+		byteCost bool
+		async    bool
+
+		// ristretto can not be iterated, so an IndexedTinyLFU indexes the keys by their
+		// hash to support Extended. The index is kept in sync by the eviction
+		// callbacks, and is nil for a TinyLFU.
+		mu        sync.Mutex
+		entries   map[uint64]*tinyLFUEntry
+		clearing  atomic.Bool
+		evictions uint64
+	}
+
+	// IndexedTinyLFU is a TinyLFU implementing Extended, for admin tooling. Every Set
+	// takes a cache-wide lock and allocates an index entry.
+	IndexedTinyLFU struct {
+		*TinyLFU
+	}
+
+	// TinyLFUOption defines the method to customize a TinyLFU.
+	TinyLFUOption func(o *tinyLFUOptions)
+
+	tinyLFUOptions struct {
+		numCounters int64
+		bufferItems int64
+		byteCost    bool
+		async       bool
+	}
 
-type TinyLFU struct {
-	rand   *util.SafeRand
-	cache  *ristretto.Cache[string, []byte]
-	ttl    time.Duration
-	offset time.Duration
+	tinyLFUEntry struct {
+		key       string
+		conflict  uint64
+		value     []byte // tells the entry apart from the entries of former values of key.
+		size      int64
+		expiresAt time.Time
+	}
+)
+
+// WithTinyLFUNumCounters sets the number of keys to track frequency of. It should be
+// about 10x the number of entries expected when the cache is full. Default is 1e7.
+func WithTinyLFUNumCounters(numCounters int64) TinyLFUOption {
+	return func(o *tinyLFUOptions) {
+		o.numCounters = numCounters
+	}
 }
 
-func NewTinyLFU(size int, ttl time.Duration) *TinyLFU {
+// WithTinyLFUBufferItems sets the number of keys per Get buffer. Default is 64.
+func WithTinyLFUBufferItems(bufferItems int64) TinyLFUOption {
+	return func(o *tinyLFUOptions) {
+		o.bufferItems = bufferItems
+	}
+}
+
+// WithTinyLFUByteCost makes size a byte budget: an entry costs the length of its key
+// and value, plus ristretto's internal per-entry overhead. By default every entry
+// costs 1, so size bounds the number of entries.
+func WithTinyLFUByteCost(byteCost bool) TinyLFUOption {
+	return func(o *tinyLFUOptions) {
+		o.byteCost = byteCost
+	}
+}
+
+// WithTinyLFUAsync makes Set return without waiting for the value to pass through
+// ristretto's buffers. Writers no longer serialize on the buffers, but a Get right
+// after a Set may miss.
+func WithTinyLFUAsync(async bool) TinyLFUOption {
+	return func(o *tinyLFUOptions) {
+		o.async = async
+	}
+}
+
+// NewTinyLFU creates a TinyLFU. It supports Clear and Evictions, but can not report
+// its contents: use NewIndexedTinyLFU for Extended.
+func NewTinyLFU(size int, ttl time.Duration, opts ...TinyLFUOption) *TinyLFU {
+	return newTinyLFU(size, ttl, false, opts...)
+}
+
+// NewIndexedTinyLFU creates a TinyLFU indexing its keys to implement Extended.
+func NewIndexedTinyLFU(size int, ttl time.Duration, opts ...TinyLFUOption) *IndexedTinyLFU {
+	return &IndexedTinyLFU{TinyLFU: newTinyLFU(size, ttl, true, opts...)}
+}
+
+func newTinyLFU(size int, ttl time.Duration, index bool, opts ...TinyLFUOption) *TinyLFU {
+	var o tinyLFUOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.numCounters <= 0 {
+		o.numCounters = defaultNumCounters
+	}
+	if o.bufferItems <= 0 {
+		o.bufferItems = defaultBufferItems
+	}
+
 	const maxOffset = 10 * time.Second
 
 	offset := ttl / 10
@@ -29,21 +128,30 @@ func NewTinyLFU(size int, ttl time.Duration) *TinyLFU {
 		offset = maxOffset
 	}
 
+	c := &TinyLFU{
+		rand:     util.NewSafeRand(),
+		ttl:      ttl,
+		offset:   offset,
+		byteCost: o.byteCost,
+		async:    o.async,
+	}
+	if index {
+		c.entries = make(map[uint64]*tinyLFUEntry)
+	}
+
 	cache, err := ristretto.NewCache[string, []byte](&ristretto.Config[string, []byte]{
-		NumCounters: numCounters,
+		NumCounters: o.numCounters,
 		MaxCost:     int64(size),
-		BufferItems: bufferItems,
+		BufferItems: o.bufferItems,
+		OnEvict:     c.onEvict,
+		OnReject:    c.onReject,
 	})
 	if err != nil {
 		panic(err)
 	}
+	c.cache = cache
 
-	return &TinyLFU{
-		rand:   util.NewSafeRand(),
-		cache:  cache,
-		ttl:    ttl,
-		offset: offset,
-	}
+	return c
 }
 
 func (c *TinyLFU) UseRandomizedTTL(offset time.Duration) {
@@ -56,10 +164,32 @@ func (c *TinyLFU) Set(key string, b []byte) {
 		ttl += time.Duration(c.rand.Int63n(int64(c.offset)))
 	}
 
-	c.cache.SetWithTTL(key, b, 1, ttl)
+	cost := int64(1)
+	if c.byteCost {
+		cost = int64(len(key) + len(b))
+	}
+
+	if c.entries == nil {
+		c.cache.SetWithTTL(key, b, cost, ttl)
+	} else {
+		hash, conflict := z.KeyToHash(key)
+		entry := &tinyLFUEntry{key: key, conflict: conflict, value: b, size: int64(len(key) + len(b))}
+		if ttl > 0 {
+			entry.expiresAt = time.Now().Add(ttl)
+		}
+		c.mu.Lock()
+		c.entries[hash] = entry
+		c.mu.Unlock()
 
-	// wait for value to pass through buffers
-	c.cache.Wait()
+		if !c.cache.SetWithTTL(key, b, cost, ttl) {
+			c.removeEntry(hash, conflict, b)
+		}
+	}
+
+	if !c.async {
+		// wait for value to pass through buffers
+		c.cache.Wait()
+	}
 }
 
 func (c *TinyLFU) Get(key string) ([]byte, bool) {
@@ -73,4 +203,107 @@ func (c *TinyLFU) Get(key string) ([]byte, bool) {
 
 func (c *TinyLFU) Del(key string) {
 	c.cache.Del(key)
+	if c.entries != nil {
+		hash, conflict := z.KeyToHash(key)
+		c.mu.Lock()
+		if e, ok := c.entries[hash]; ok && e.conflict == conflict {
+			delete(c.entries, hash)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *IndexedTinyLFU) Len() (n int) {
+	c.rangeEntries(func(*tinyLFUEntry) bool {
+		n++
+		return true
+	})
+	return
+}
+
+func (c *IndexedTinyLFU) SizeBytes() (size int64) {
+	c.rangeEntries(func(e *tinyLFUEntry) bool {
+		size += e.size
+		return true
+	})
+	return
+}
+
+func (c *TinyLFU) Clear() {
+	c.clearing.Store(true)
+	c.cache.Clear()
+	if c.entries != nil {
+		c.mu.Lock()
+		c.entries = make(map[uint64]*tinyLFUEntry)
+		c.mu.Unlock()
+	}
+	c.clearing.Store(false)
+}
+
+func (c *IndexedTinyLFU) Range(fn func(key string, value []byte, expiresAt time.Time) bool) {
+	c.rangeEntries(func(e *tinyLFUEntry) bool {
+		val, ok := c.cache.Get(e.key)
+		if !ok {
+			return true
+		}
+		return fn(e.key, val, e.expiresAt)
+	})
+}
+
+func (c *TinyLFU) Evictions() uint64 {
+	return atomic.LoadUint64(&c.evictions)
+}
+
+// rangeEntries calls fn for a snapshot of the unexpired index entries, so fn may
+// call back into the cache.
+func (c *TinyLFU) rangeEntries(fn func(e *tinyLFUEntry) bool) {
+	now := time.Now()
+	c.mu.Lock()
+	entries := make([]*tinyLFUEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		if e.expiresAt.IsZero() || e.expiresAt.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, e := range entries {
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+// removeEntry removes the index entry of hash if it holds value, so that the eviction
+// of a former value does not remove the entry of a key set again.
+func (c *TinyLFU) removeEntry(hash, conflict uint64, value []byte) {
+	if c.entries == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[hash]; ok && e.conflict == conflict && sameValue(e.value, value) {
+		delete(c.entries, hash)
+	}
+	c.mu.Unlock()
+}
+
+func (c *TinyLFU) onEvict(item *ristretto.Item[[]byte]) {
+	if c.clearing.Load() {
+		return
+	}
+	// Expired items carry their expiration, victims of the policy do not.
+	if item.Expiration.IsZero() {
+		atomic.AddUint64(&c.evictions, 1)
+	}
+	c.removeEntry(item.Key, item.Conflict, item.Value)
+}
+
+func (c *TinyLFU) onReject(item *ristretto.Item[[]byte]) {
+	c.removeEntry(item.Key, item.Conflict, item.Value)
+}
+
+// sameValue reports whether a and b are the same slice.
+func sameValue(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
 }
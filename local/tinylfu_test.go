@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/ristretto/v2/z"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -92,3 +94,138 @@ loop:
 		}
 	}
 }
+
+func TestTinyLFU_Extended(t *testing.T) {
+	cache := NewIndexedTinyLFU(1000, time.Minute)
+	cache.Set("key1", []byte("value1"))
+	cache.Set("key2", []byte("value2"))
+
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(2*len("key1value1")), cache.SizeBytes())
+
+	got := make(map[string]string)
+	cache.Range(func(key string, value []byte, expiresAt time.Time) bool {
+		got[key] = string(value)
+		assert.True(t, expiresAt.After(time.Now()))
+		return true
+	})
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "value2"}, got)
+
+	var n int
+	cache.Range(func(string, []byte, time.Time) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+
+	cache.Del("key1")
+	assert.Equal(t, 1, cache.Len())
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.SizeBytes())
+	_, ok := cache.Get("key2")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(0), cache.Evictions())
+}
+
+func TestTinyLFU_Index(t *testing.T) {
+	var lfu Local = NewTinyLFU(1000, time.Minute)
+	_, ok := lfu.(Extended)
+	assert.False(t, ok)
+	_, ok = lfu.(Clearer)
+	assert.True(t, ok)
+	assert.Nil(t, lfu.(*TinyLFU).entries)
+	lfu.Set("key1", []byte("value1"))
+	val, ok := lfu.Get("key1")
+	assert.True(t, ok)
+	assert.Equal(t, "value1", string(val))
+
+	// The eviction of a former value keeps the entry of the key set again.
+	cache := NewIndexedTinyLFU(1000, time.Minute)
+	old := []byte("value1")
+	cache.Set("key1", old)
+	cache.Set("key1", []byte("value2"))
+	hash, conflict := z.KeyToHash("key1")
+	cache.removeEntry(hash, conflict, old)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestTinyLFU_Evictions(t *testing.T) {
+	cache := NewIndexedTinyLFU(1000, time.Minute)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), []byte("value"))
+	}
+
+	assert.Less(t, cache.Len(), 1000)
+	assert.Greater(t, cache.Evictions(), uint64(0))
+}
+
+func TestTinyLFU_Options(t *testing.T) {
+	cache := NewTinyLFU(1000, time.Second, WithTinyLFUNumCounters(1000), WithTinyLFUBufferItems(32),
+		WithTinyLFUByteCost(true), WithTinyLFUAsync(true))
+	assert.True(t, cache.byteCost)
+	assert.True(t, cache.async)
+
+	cache.Set("key1", []byte("value1"))
+	assert.Eventually(t, func() bool {
+		val, ok := cache.Get("key1")
+		return ok && string(val) == "value1"
+	}, time.Second, time.Millisecond)
+}
+
+func TestTinyLFU_ByteCost(t *testing.T) {
+	const size = 64 * 1024
+	cache := NewIndexedTinyLFU(size, time.Minute, WithTinyLFUByteCost(true))
+	value := make([]byte, 1024)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key-%d", i), value)
+	}
+
+	// 1000 entries cost about 1MB, far above the 64KB budget.
+	assert.Less(t, cache.Len(), size/len(value))
+	assert.LessOrEqual(t, cache.SizeBytes(), int64(size))
+	assert.Less(t, hits(cache.TinyLFU, 1000), size/len(value))
+
+	// Without byte cost, the same budget holds every entry.
+	count := NewTinyLFU(size, time.Minute)
+	for i := 0; i < 1000; i++ {
+		count.Set(fmt.Sprintf("key-%d", i), value)
+	}
+	assert.Greater(t, hits(count, 1000), size/len(value))
+}
+
+// hits returns the number of the keys key-0 to key-n held by cache.
+func hits(cache *TinyLFU, n int) (hits int) {
+	for i := 0; i < n; i++ {
+		if _, ok := cache.Get(fmt.Sprintf("key-%d", i)); ok {
+			hits++
+		}
+	}
+	return
+}
+
+func BenchmarkTinyLFU_Set(b *testing.B) {
+	value := make([]byte, 256)
+	for _, bm := range []struct {
+		name string
+		opts []TinyLFUOption
+	}{
+		{"Sync", nil},
+		{"Async", []TinyLFUOption{WithTinyLFUAsync(true)}},
+		{"AsyncByteCost", []TinyLFUOption{WithTinyLFUAsync(true), WithTinyLFUByteCost(true)}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			cache := NewTinyLFU(int(64*MB), time.Minute, bm.opts...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					cache.Set("key-"+strconv.Itoa(i&0xffff), value)
+					i++
+				}
+			})
+		})
+	}
+}
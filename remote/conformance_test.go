@@ -0,0 +1,77 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/remote/remotetest"
+)
+
+func TestMemory_Conformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		return remote.NewMemory(), nil
+	})
+}
+
+func TestHedged_Conformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		return remote.NewHedged(remote.NewMemory(), remote.WithHedgedDelay(time.Microsecond), remote.WithHedgedMaxRatio(1)), nil
+	})
+}
+
+func TestGoRedisV9Adapter_Conformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		s := miniredis.RunT(t)
+		return remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s.Addr()})), s.FastForward
+	})
+}
+
+func TestGoRedisV9Adapter_ClusterConformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		s1, s2 := miniredis.RunT(t), miniredis.RunT(t)
+		rdb := redis.NewClusterClient(&redis.ClusterOptions{
+			ClusterSlots: func(context.Context) ([]redis.ClusterSlot, error) {
+				return []redis.ClusterSlot{
+					{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: s1.Addr()}}},
+					{Start: 8192, End: 16383, Nodes: []redis.ClusterNode{{Addr: s2.Addr()}}},
+				}, nil
+			},
+		})
+		return remote.NewGoRedisV9Adapter(rdb), func(d time.Duration) {
+			s1.FastForward(d)
+			s2.FastForward(d)
+		}
+	})
+}
+
+func TestGoRedisV9Adapter_ReplicaConformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		s := miniredis.RunT(t)
+		primary := redis.NewClient(&redis.Options{Addr: s.Addr()})
+		replica := redis.NewClient(&redis.Options{Addr: s.Addr()})
+		return remote.NewGoRedisV9Adapter(primary, remote.WithGoRedisV9Replicas(replica)), s.FastForward
+	})
+}
+
+func TestSharded_Conformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		s1, s2 := miniredis.RunT(t), miniredis.RunT(t)
+		m := runFakeMemcached(t)
+		mc := remote.NewMemcached(m.Addr())
+		t.Cleanup(func() { _ = mc.Close() })
+		return remote.NewSharded([]remote.Shard{
+				{Name: "redis1", Remote: remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s1.Addr()}))},
+				{Name: "redis2", Remote: remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s2.Addr()}))},
+				{Name: "memcached", Remote: mc},
+			}), func(d time.Duration) {
+				s1.FastForward(d)
+				s2.FastForward(d)
+				m.FastForward(d)
+			}
+	})
+}
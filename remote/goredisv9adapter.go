@@ -3,82 +3,773 @@ package remote
 import (
 	"context"
 	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const (
+	defaultBatchSize            = 100
+	defaultMaxConcurrency       = 8
+	defaultReadYourWritesWindow = time.Second
+	// replicaDownDuration is how long a replica is skipped after a failed read.
+	replicaDownDuration = 5 * time.Second
+	// maxRecentWrites bounds the keys a generation of recentWrites holds.
+	maxRecentWrites = 1 << 16
+	// hSetScriptFields bounds the fields per hSetScript call, as unpack is limited
+	// by the Lua stack.
+	hSetScriptFields = 1000
+	// expireFieldPrefix starts the name of the field holding the deadline, in unix
+	// milliseconds, of a field written without HPEXPIRE.
+	expireFieldPrefix = "\x00expire:"
+)
+
+var (
+	_ Remote        = (*GoRedisV9Adapter)(nil)
+	_ EntriesSetter = (*GoRedisV9Adapter)(nil)
+	_ HashRemote    = (*GoRedisV9Adapter)(nil)
+	_ TTLKeeper     = (*GoRedisV9Adapter)(nil)
+
+	errBatchPanic = errors.New("remote: batch panicked")
+
+	// hSetScript sets the fields of a hash, then extends the ttl of the hash to
+	// ARGV[1] milliseconds if it is shorter, so no field expires early. The fields
+	// carry their own deadline in an expire field, checked by HMGet.
+	//
+	// As a hash that keeps being written never expires, each call also scans the
+	// next part of the hash, twice as many fields as it writes, and deletes the
+	// fields past their deadline at ARGV[2] together with their expire fields. The
+	// scan cursor is kept in the sweep field.
+	hSetScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+local ttl = tonumber(ARGV[1])
+if ttl > 0 and redis.call('PTTL', KEYS[1]) < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+local now = tonumber(ARGV[2])
+local prefix = '\0expire:'
+local cursor = redis.call('HGET', KEYS[1], '\0sweep') or '0'
+local scan = redis.call('HSCAN', KEYS[1], cursor, 'COUNT', #ARGV - 2)
+local entries = scan[2]
+for i = 1, #entries, 2 do
+	local field, deadline = entries[i], entries[i + 1]
+	if string.sub(field, 1, #prefix) == prefix and deadline ~= '' and tonumber(deadline) <= now then
+		redis.call('HDEL', KEYS[1], string.sub(field, #prefix + 1), field)
+	end
+end
+redis.call('HSET', KEYS[1], '\0sweep', scan[1])
+return 1
+`)
+)
+
+const (
+	// batchModeGet sends one GET per key, for clients that route each command
+	// on their own, such as redis.Ring.
+	batchModeGet batchMode = iota
+	// batchModeMGet sends one MGET per batch to a single node.
+	batchModeMGet
+	// batchModeCluster groups keys by hash slot and node, and sends one MGET per slot.
+	batchModeCluster
+)
+
+const (
+	fieldTTLUnknown int32 = iota
+	fieldTTLSupported
+	fieldTTLUnsupported
+)
+
+type (
+	GoRedisV9Adapter struct {
+		client         redis.Cmdable
+		primary        *redisNode
+		replicas       []*redisNode
+		next           atomic.Uint64
+		recent         *recentWrites
+		batchSize      int
+		maxConcurrency int
+		fieldTTL       atomic.Int32 // whether the server supports HPEXPIRE (Redis 7.4+).
+
+		replicaClients       []redis.Cmdable
+		readYourWritesWindow time.Duration
+	}
+
+	// GoRedisV9Option defines the method to customize a GoRedisV9Adapter.
+	GoRedisV9Option func(o *GoRedisV9Adapter)
+
+	batchMode int
+
+	// redisNode is the primary or a replica.
+	redisNode struct {
+		client    redis.Cmdable
+		mode      batchMode
+		downUntil atomic.Int64 // unix nanoseconds until which a replica is skipped.
+	}
+
+	// recentWrites remembers the keys written in the last window, whose reads go to
+	// the primary so they see their own writes despite replication lag. The keys are
+	// held in two generations of one window each: the older one is dropped as a whole
+	// when a new one starts, so nothing is swept key by key.
+	recentWrites struct {
+		window  time.Duration
+		maxKeys int
+		mu      sync.Mutex
+		current recentGeneration
+		prev    recentGeneration
+	}
+
+	// recentGeneration holds the keys written since start. Past maxKeys, it stops
+	// holding keys and sends every read to the primary until overflowUntil.
+	recentGeneration struct {
+		start         time.Time
+		keys          map[string]time.Time
+		overflowUntil time.Time
+	}
+
+	// batch is a set of keys sent to one node in one round trip. Each group is sent
+	// as one MGET; all its keys belong to the same hash slot in cluster mode.
+	batch struct {
+		groups [][]string
+	}
 )
 
-var _ Remote = (*GoRedisV9Adapter)(nil)
+// WithGoRedisV9BatchSize sets the maximum number of keys sent in one pipeline by
+// MGet and MSet. Default is 100.
+func WithGoRedisV9BatchSize(batchSize int) GoRedisV9Option {
+	return func(o *GoRedisV9Adapter) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithGoRedisV9MaxConcurrency sets the maximum number of pipelines MGet and MSet
+// run concurrently. Default is 8.
+func WithGoRedisV9MaxConcurrency(maxConcurrency int) GoRedisV9Option {
+	return func(o *GoRedisV9Adapter) {
+		o.maxConcurrency = maxConcurrency
+	}
+}
 
-type GoRedisV9Adapter struct {
-	client redis.Cmdable
+// WithGoRedisV9Replicas sends Get, MGet and HMGet to the replicas, in turn, while
+// writes go to the primary client. A replica failing a read is skipped for 5s and the
+// read is retried on the primary; reads go to the primary when no replica is healthy.
+func WithGoRedisV9Replicas(replicas ...redis.Cmdable) GoRedisV9Option {
+	return func(o *GoRedisV9Adapter) {
+		o.replicaClients = replicas
+	}
+}
+
+// WithGoRedisV9ReadYourWritesWindow sets how long the reads of a key go to the primary
+// after the adapter wrote it, so they are not served stale by a lagging replica.
+// Default is 1s; a negative window disables it. Only used with replicas.
+func WithGoRedisV9ReadYourWritesWindow(window time.Duration) GoRedisV9Option {
+	return func(o *GoRedisV9Adapter) {
+		o.readYourWritesWindow = window
+	}
 }
 
 // NewGoRedisV9Adapter is
-func NewGoRedisV9Adapter(client redis.Cmdable) Remote {
-	return &GoRedisV9Adapter{
+func NewGoRedisV9Adapter(client redis.Cmdable, opts ...GoRedisV9Option) Remote {
+	r := &GoRedisV9Adapter{
 		client: client,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.maxConcurrency <= 0 {
+		r.maxConcurrency = defaultMaxConcurrency
+	}
+	if r.readYourWritesWindow == 0 {
+		r.readYourWritesWindow = defaultReadYourWritesWindow
+	}
+
+	r.primary = newRedisNode(client)
+	for _, replica := range r.replicaClients {
+		r.replicas = append(r.replicas, newRedisNode(replica))
+	}
+	if len(r.replicas) > 0 && r.readYourWritesWindow > 0 {
+		r.recent = newRecentWrites(r.readYourWritesWindow, maxRecentWrites)
+	}
+
+	return r
+}
+
+func newRedisNode(client redis.Cmdable) *redisNode {
+	n := &redisNode{client: client}
+	switch client.(type) {
+	case *redis.ClusterClient:
+		n.mode = batchModeCluster
+	case *redis.Client:
+		n.mode = batchModeMGet
+	default:
+		n.mode = batchModeGet
+	}
+	return n
 }
 
 func (r *GoRedisV9Adapter) SetEX(ctx context.Context, key string, value any, expire time.Duration) error {
+	r.recent.add(key)
 	return r.client.SetEx(ctx, key, value, expire).Err()
 }
 
 func (r *GoRedisV9Adapter) SetNX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	r.recent.add(key)
 	return r.client.SetNX(ctx, key, value, expire).Result()
 }
 
 func (r *GoRedisV9Adapter) SetXX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	r.recent.add(key)
 	return r.client.SetXX(ctx, key, value, expire).Result()
 }
 
+// SetXXKeepTTL is like SetXX with KEEPTTL, which needs Redis 6.0+.
+func (r *GoRedisV9Adapter) SetXXKeepTTL(ctx context.Context, key string, value any) (val bool, err error) {
+	r.recent.add(key)
+	err = r.client.SetArgs(ctx, key, value, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 func (r *GoRedisV9Adapter) Get(ctx context.Context, key string) (val string, err error) {
-	return r.client.Get(ctx, key).Result()
+	n := r.reader(key)
+	val, err = n.client.Get(ctx, key).Result()
+	if r.replicaFailed(ctx, n, err) {
+		return r.client.Get(ctx, key).Result()
+	}
+	return
 }
 
 func (r *GoRedisV9Adapter) Del(ctx context.Context, key string) (val int64, err error) {
+	r.recent.add(key)
 	return r.client.Del(ctx, key).Result()
 }
 
+// MGet splits keys into batches, by hash slot and node for a cluster client, and
+// fetches the batches concurrently. If some batches fail, it returns the values
+// of the others along with a *BatchError.
 func (r *GoRedisV9Adapter) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
-	pipeline := r.client.Pipeline()
-	keyIdxMap := make(map[int]string, len(keys))
-	ret := make(map[string]any, len(keys))
+	replica := r.replica()
+	if replica == nil {
+		return r.mGet(ctx, r.primary, keys)
+	}
 
-	for idx, key := range keys {
-		keyIdxMap[idx] = key
-		pipeline.Get(ctx, key)
+	primaryKeys, replicaKeys := r.recent.split(keys)
+	ret, err := r.mGet(ctx, replica, replicaKeys)
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) && r.replicaFailed(ctx, replica, err) {
+		primaryKeys = append(primaryKeys, batchErr.Keys...)
+		err = nil
+	}
+	if len(primaryKeys) > 0 {
+		vals, primaryErr := r.mGet(ctx, r.primary, primaryKeys)
+		for key, val := range vals {
+			ret[key] = val
+		}
+		err = joinBatchErrors(err, primaryErr)
 	}
 
-	cmder, err := pipeline.Exec(ctx)
-	if err != nil && !errors.Is(err, r.Nil()) {
-		return nil, err
+	return ret, err
+}
+
+func (r *GoRedisV9Adapter) mGet(ctx context.Context, n *redisNode, keys []string) (map[string]any, error) {
+	var (
+		mu  sync.Mutex
+		ret = make(map[string]any, len(keys))
+	)
+	err := r.runBatches(ctx, n, keys, func(ctx context.Context, b batch) error {
+		vals, err := r.mGetBatch(ctx, n, b)
+		mu.Lock()
+		for key, val := range vals {
+			ret[key] = val
+		}
+		mu.Unlock()
+		return err
+	})
+
+	return ret, err
+}
+
+// MSet splits value into batches like MGet and writes them concurrently. If some
+// batches fail, the others are still written and a *BatchError is returned.
+func (r *GoRedisV9Adapter) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+	entries := make(map[string]Entry, len(value))
+	for key, val := range value {
+		entries[key] = Entry{Value: val, Expire: expire}
 	}
 
-	for idx, cmd := range cmder {
-		if strCmd, ok := cmd.(*redis.StringCmd); ok {
-			key := keyIdxMap[idx]
-			if val, _ := strCmd.Result(); len(val) > 0 {
-				ret[key] = val
+	return r.MSetEntries(ctx, entries)
+}
+
+// MSetEntries is like MSet, with an expiration per key.
+func (r *GoRedisV9Adapter) MSetEntries(ctx context.Context, entries map[string]Entry) error {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	r.recent.add(keys...)
+
+	return r.runBatches(ctx, r.primary, keys, func(ctx context.Context, b batch) error {
+		pipeline := r.client.Pipeline()
+		for _, group := range b.groups {
+			for _, key := range group {
+				pipeline.SetEx(ctx, key, entries[key].Value, entries[key].Expire)
 			}
 		}
+		_, err := pipeline.Exec(ctx)
+		return err
+	})
+}
+
+// HMGet pipelines one HMGET per hash.
+func (r *GoRedisV9Adapter) HMGet(ctx context.Context, fields map[string][]string) (map[string]map[string]any, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
 	}
 
-	return ret, nil
+	n := r.reader(keys...)
+	ret, err := r.hMGet(ctx, n, fields)
+	if r.replicaFailed(ctx, n, err) {
+		return r.hMGet(ctx, r.primary, fields)
+	}
+	return ret, err
 }
 
-func (r *GoRedisV9Adapter) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+func (r *GoRedisV9Adapter) hMGet(ctx context.Context, n *redisNode, fields map[string][]string) (map[string]map[string]any, error) {
+	pipeline := n.client.Pipeline()
+	cmds := make(map[string]*redis.SliceCmd, len(fields))
+	for key, keyFields := range fields {
+		// The expire fields follow the fields.
+		args := make([]string, 0, 2*len(keyFields))
+		args = append(args, keyFields...)
+		for _, field := range keyFields {
+			args = append(args, expireFieldPrefix+field)
+		}
+		cmds[key] = pipeline.HMGet(ctx, key, args...)
+	}
+	_, err := pipeline.Exec(ctx)
+
+	now := time.Now().UnixMilli()
+	ret := make(map[string]map[string]any, len(fields))
+	for key, cmd := range cmds {
+		vals, cmdErr := cmd.Result()
+		if cmdErr != nil {
+			continue
+		}
+		n := len(fields[key])
+		for i, val := range vals[:n] {
+			if deadline, ok := vals[n+i].(string); ok {
+				if ms, e := strconv.ParseInt(deadline, 10, 64); e == nil && ms <= now {
+					continue
+				}
+			}
+			if s, ok := val.(string); ok && len(s) > 0 {
+				if ret[key] == nil {
+					ret[key] = make(map[string]any)
+				}
+				ret[key][fields[key][i]] = s
+			}
+		}
+	}
+
+	return ret, err
+}
+
+// HSet expires each field on its own with HPEXPIRE. If the server does not support
+// it (before Redis 7.4), each field is written with its deadline in an expire field,
+// and HMGet omits the fields past their deadline until later writes delete them;
+// each hash then expires with its longest-lived field.
+func (r *GoRedisV9Adapter) HSet(ctx context.Context, values map[string]map[string]Entry) error {
+	for key := range values {
+		r.recent.add(key)
+	}
+
+	if r.fieldTTL.Load() != fieldTTLUnsupported {
+		err := r.hSetFieldTTL(ctx, values)
+		if err == nil {
+			r.fieldTTL.CompareAndSwap(fieldTTLUnknown, fieldTTLSupported)
+			return nil
+		}
+		if r.fieldTTL.Load() == fieldTTLSupported || !strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+			return err
+		}
+		r.fieldTTL.Store(fieldTTLUnsupported)
+	}
+
+	return r.hSetBucketTTL(ctx, values)
+}
+
+func (r *GoRedisV9Adapter) HDel(ctx context.Context, key string, fields ...string) (val int64, err error) {
+	r.recent.add(key)
+	if r.fieldTTL.Load() != fieldTTLUnsupported {
+		return r.client.HDel(ctx, key, fields...).Result()
+	}
+
 	pipeline := r.client.Pipeline()
+	cmd := pipeline.HDel(ctx, key, fields...)
+	expireFields := make([]string, 0, len(fields))
+	for _, field := range fields {
+		expireFields = append(expireFields, expireFieldPrefix+field)
+	}
+	pipeline.HDel(ctx, key, expireFields...)
+	_, err = pipeline.Exec(ctx)
+	return cmd.Val(), err
+}
 
-	for key, val := range value {
-		pipeline.SetEx(ctx, key, val, expire)
+func (r *GoRedisV9Adapter) hSetFieldTTL(ctx context.Context, values map[string]map[string]Entry) error {
+	pipeline := r.client.Pipeline()
+	for key, entries := range values {
+		args := make([]any, 0, 2*len(entries))
+		expires := make(map[time.Duration][]string)
+		for field, entry := range entries {
+			args = append(args, field, entry.Value)
+			expire := entry.Expire
+			if expire < 0 {
+				expire = 0
+			}
+			expires[expire] = append(expires[expire], field)
+		}
+		pipeline.HSet(ctx, key, args...)
+		for expire, fields := range expires {
+			if expire == 0 {
+				pipeline.HPersist(ctx, key, fields...)
+			} else {
+				pipeline.HPExpire(ctx, key, expire, fields...)
+			}
+		}
 	}
 	_, err := pipeline.Exec(ctx)
+	return err
+}
 
+func (r *GoRedisV9Adapter) hSetBucketTTL(ctx context.Context, values map[string]map[string]Entry) error {
+	now := time.Now()
+	pipeline := r.client.Pipeline()
+	for key, entries := range values {
+		args := make([]any, 2, 2+4*min(len(entries), hSetScriptFields))
+		var expire time.Duration
+		eval := func() {
+			args[0], args[1] = expire.Milliseconds(), now.UnixMilli()
+			hSetScript.Eval(ctx, pipeline, []string{key}, args...)
+			args, expire = make([]any, 2, cap(args)), 0
+		}
+		for field, entry := range entries {
+			// A field without expiration gets an empty deadline.
+			var deadline string
+			if entry.Expire > 0 {
+				deadline = strconv.FormatInt(now.Add(entry.Expire).UnixMilli(), 10)
+			}
+			args = append(args, field, entry.Value, expireFieldPrefix+field, deadline)
+			if entry.Expire > expire {
+				expire = entry.Expire
+			}
+			if len(args) >= 2+4*hSetScriptFields {
+				eval()
+			}
+		}
+		if len(args) > 2 {
+			eval()
+		}
+	}
+	_, err := pipeline.Exec(ctx)
 	return err
 }
 
 func (r *GoRedisV9Adapter) Nil() error {
 	return redis.Nil
 }
+
+// reader returns the node to read keys from: a healthy replica, unless one of the
+// keys was written recently.
+func (r *GoRedisV9Adapter) reader(keys ...string) *redisNode {
+	if r.recent.contains(keys...) {
+		return r.primary
+	}
+	if replica := r.replica(); replica != nil {
+		return replica
+	}
+	return r.primary
+}
+
+// replica returns the next healthy replica, or nil.
+func (r *GoRedisV9Adapter) replica() *redisNode {
+	if len(r.replicas) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		n := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if n.downUntil.Load() <= now {
+			return n
+		}
+	}
+	return nil
+}
+
+// replicaFailed reports whether the read from n failed because n is a replica in
+// trouble, in which case it is skipped for a while and the read should be retried
+// on the primary.
+func (r *GoRedisV9Adapter) replicaFailed(ctx context.Context, n *redisNode, err error) bool {
+	if n == r.primary || err == nil || errors.Is(err, redis.Nil) || ctx.Err() != nil {
+		return false
+	}
+	n.downUntil.Store(time.Now().Add(replicaDownDuration).UnixNano())
+	return true
+}
+
+func (r *GoRedisV9Adapter) mGetBatch(ctx context.Context, n *redisNode, b batch) (map[string]any, error) {
+	pipeline := n.client.Pipeline()
+	for _, group := range b.groups {
+		if n.mode == batchModeGet {
+			for _, key := range group {
+				pipeline.Get(ctx, key)
+			}
+		} else {
+			pipeline.MGet(ctx, group...)
+		}
+	}
+
+	cmder, err := pipeline.Exec(ctx)
+	if errors.Is(err, r.Nil()) {
+		err = nil
+	}
+
+	ret := make(map[string]any)
+	if n.mode == batchModeGet {
+		for i, key := range b.keys() {
+			if val, _ := cmder[i].(*redis.StringCmd).Result(); len(val) > 0 {
+				ret[key] = val
+			}
+		}
+		return ret, err
+	}
+
+	for i, cmd := range cmder {
+		vals, cmdErr := cmd.(*redis.SliceCmd).Result()
+		if cmdErr != nil {
+			continue
+		}
+		for j, val := range vals {
+			if s, ok := val.(string); ok && len(s) > 0 {
+				ret[b.groups[i][j]] = s
+			}
+		}
+	}
+
+	return ret, err
+}
+
+// runBatches runs fn for every batch of keys, at most maxConcurrency at a time.
+func (r *GoRedisV9Adapter) runBatches(ctx context.Context, n *redisNode, keys []string, fn func(context.Context, batch) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	batches := r.batches(ctx, n, keys)
+	if len(batches) == 1 {
+		if err := fn(ctx, batches[0]); err != nil {
+			return newBatchError(batches[0].keys(), err)
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		batchErr *BatchError
+		sem      = make(chan struct{}, r.maxConcurrency)
+	)
+	for _, b := range batches {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(b batch) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			err := errBatchPanic
+			util.WithRecover(func() {
+				err = fn(ctx, b)
+			})
+			if err != nil {
+				mu.Lock()
+				batchErr = batchErr.add(b.keys(), err)
+				mu.Unlock()
+			}
+		}(b)
+	}
+	wg.Wait()
+
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// batches splits keys into batches of at most batchSize keys. With a cluster client,
+// a batch only holds keys of one node, grouped by hash slot.
+func (r *GoRedisV9Adapter) batches(ctx context.Context, n *redisNode, keys []string) []batch {
+	if n.mode != batchModeCluster {
+		var batches []batch
+		for _, chunk := range chunk(keys, r.batchSize) {
+			batches = append(batches, batch{groups: [][]string{chunk}})
+		}
+		return batches
+	}
+
+	slots := make(map[int][]string)
+	for _, key := range keys {
+		slot := hashSlot(key)
+		slots[slot] = append(slots[slot], key)
+	}
+
+	// Group the slots by the node serving them. If the node is unknown, the
+	// cluster client still routes the commands, just not in a single round trip.
+	cluster := n.client.(*redis.ClusterClient)
+	nodes := make(map[string][]int)
+	for slot, slotKeys := range slots {
+		var addr string
+		if node, err := cluster.MasterForKey(ctx, slotKeys[0]); err == nil {
+			addr = node.Options().Addr
+		}
+		nodes[addr] = append(nodes[addr], slot)
+	}
+
+	var batches []batch
+	for _, nodeSlots := range nodes {
+		sort.Ints(nodeSlots)
+		var (
+			cur  batch
+			size int
+		)
+		for _, slot := range nodeSlots {
+			for _, group := range chunk(slots[slot], r.batchSize) {
+				if size+len(group) > r.batchSize {
+					batches = append(batches, cur)
+					cur, size = batch{}, 0
+				}
+				cur.groups = append(cur.groups, group)
+				size += len(group)
+			}
+		}
+		batches = append(batches, cur)
+	}
+
+	return batches
+}
+
+func (b batch) keys() []string {
+	var keys []string
+	for _, group := range b.groups {
+		keys = append(keys, group...)
+	}
+	return keys
+}
+
+func chunk(keys []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(keys)+size-1)/size)
+	for size < len(keys) {
+		keys, chunks = keys[size:], append(chunks, keys[:size:size])
+	}
+	return append(chunks, keys)
+}
+
+func newRecentWrites(window time.Duration, maxKeys int) *recentWrites {
+	return &recentWrites{window: window, maxKeys: maxKeys}
+}
+
+// add records that keys were just written. It is a no-op on a nil recentWrites.
+func (w *recentWrites) add(keys ...string) {
+	if w == nil {
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(w.window)
+	w.mu.Lock()
+	w.rotate(now)
+	for _, key := range keys {
+		if len(w.current.keys) >= w.maxKeys {
+			w.current.overflowUntil = until
+			break
+		}
+		w.current.keys[key] = until
+	}
+	w.mu.Unlock()
+}
+
+// contains reports whether one of keys was written recently.
+func (w *recentWrites) contains(keys ...string) bool {
+	if w == nil {
+		return false
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		if w.recent(key, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// split splits keys into the recently written ones and the others.
+func (w *recentWrites) split(keys []string) (recent, others []string) {
+	if w == nil {
+		return nil, keys
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		if w.recent(key, now) {
+			recent = append(recent, key)
+		} else {
+			others = append(others, key)
+		}
+	}
+	return
+}
+
+// rotate starts a new generation once the current one is a window old. The previous
+// generation is dropped, and so is the current one if it is two windows old.
+func (w *recentWrites) rotate(now time.Time) {
+	if w.current.keys != nil && now.Sub(w.current.start) < w.window {
+		return
+	}
+
+	w.prev = recentGeneration{}
+	if w.current.keys != nil && now.Sub(w.current.start) < 2*w.window {
+		w.prev = w.current
+	}
+	w.current = recentGeneration{start: now, keys: make(map[string]time.Time)}
+}
+
+// recent reports whether key was written in the last window.
+func (w *recentWrites) recent(key string, now time.Time) bool {
+	for _, g := range [...]*recentGeneration{&w.current, &w.prev} {
+		if now.Before(g.overflowUntil) {
+			return true
+		}
+		if until, ok := g.keys[key]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
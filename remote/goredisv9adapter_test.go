@@ -2,6 +2,9 @@ package remote
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
@@ -88,3 +91,326 @@ func newRdb() *redis.Client {
 		Addr: s.Addr(),
 	})
 }
+
+func TestGoRedisV9Adaptor_Cluster(t *testing.T) {
+	s1, s2 := miniredis.RunT(t), miniredis.RunT(t)
+	client := NewGoRedisV9Adapter(newClusterRdb(s1, s2), WithGoRedisV9BatchSize(3))
+
+	value := make(map[string]any)
+	keys := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value[key] = fmt.Sprintf("value%d", i)
+		keys = append(keys, key)
+	}
+	assert.Nil(t, client.MSet(context.Background(), value, time.Minute))
+
+	// Every key is stored on the node serving its slot.
+	for key := range value {
+		s := s1
+		if hashSlot(key) >= clusterSlots/2 {
+			s = s2
+		}
+		assert.True(t, s.Exists(key), key)
+	}
+
+	result, err := client.MGet(context.Background(), append(keys, "missing")...)
+	assert.Nil(t, err)
+	assert.Equal(t, value, result)
+
+	// The keys of a failed node are reported, the others are still returned.
+	s2.Close()
+	result, err = client.MGet(context.Background(), keys...)
+	var batchErr *BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	for _, key := range keys {
+		if hashSlot(key) >= clusterSlots/2 {
+			assert.Contains(t, batchErr.Keys, key)
+			assert.NotContains(t, result, key)
+		} else {
+			assert.NotContains(t, batchErr.Keys, key)
+			assert.Equal(t, value[key], result[key])
+		}
+	}
+}
+
+func TestGoRedisV9Adaptor_Batches(t *testing.T) {
+	s1, s2 := miniredis.RunT(t), miniredis.RunT(t)
+	rdb := newClusterRdb(s1, s2)
+	client := NewGoRedisV9Adapter(rdb, WithGoRedisV9BatchSize(4)).(*GoRedisV9Adapter)
+
+	keys := []string{"{a}1", "{a}2", "{a}3", "{a}4", "{a}5", "{b}1", "{c}1", "{c}2", "d", "e", "f"}
+	seen := make(map[string]bool)
+	for _, b := range client.batches(context.Background(), client.primary, keys) {
+		assert.LessOrEqual(t, len(b.keys()), 4)
+		var addr string
+		for _, group := range b.groups {
+			for _, key := range group {
+				assert.Equal(t, hashSlot(group[0]), hashSlot(key))
+				node, err := rdb.MasterForKey(context.Background(), key)
+				assert.Nil(t, err)
+				if addr == "" {
+					addr = node.Options().Addr
+				}
+				assert.Equal(t, addr, node.Options().Addr)
+				seen[key] = true
+			}
+		}
+	}
+	assert.Equal(t, len(keys), len(seen))
+
+	single := NewGoRedisV9Adapter(newRdb(), WithGoRedisV9BatchSize(4)).(*GoRedisV9Adapter)
+	batches := single.batches(context.Background(), single.primary, keys)
+	assert.Equal(t, 3, len(batches))
+	assert.Equal(t, [][]string{{"d", "e", "f"}}, batches[2].groups)
+}
+
+func TestGoRedisV9Adaptor_Ring(t *testing.T) {
+	s1, s2 := miniredis.RunT(t), miniredis.RunT(t)
+	ring := redis.NewRing(&redis.RingOptions{
+		Addrs: map[string]string{"s1": s1.Addr(), "s2": s2.Addr()},
+	})
+	client := NewGoRedisV9Adapter(ring, WithGoRedisV9BatchSize(2), WithGoRedisV9MaxConcurrency(1))
+
+	value := map[string]any{"key1": "value1", "key2": "value2", "key3": "value3"}
+	assert.Nil(t, client.MSet(context.Background(), value, time.Minute))
+
+	result, err := client.MGet(context.Background(), "key1", "key2", "key3", "key4")
+	assert.Nil(t, err)
+	assert.Equal(t, value, result)
+}
+
+func newClusterRdb(s1, s2 *miniredis.Miniredis) *redis.ClusterClient {
+	return redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: clusterSlots/2 - 1, Nodes: []redis.ClusterNode{{Addr: s1.Addr()}}},
+				{Start: clusterSlots / 2, End: clusterSlots - 1, Nodes: []redis.ClusterNode{{Addr: s2.Addr()}}},
+			}, nil
+		},
+		MaxRedirects: -1,
+	})
+}
+
+func TestGoRedisV9Adaptor_Hash(t *testing.T) {
+	ctx := context.Background()
+	rdb := newRdb()
+	client := NewGoRedisV9Adapter(rdb).(*GoRedisV9Adapter)
+
+	err := client.HSet(ctx, map[string]map[string]Entry{
+		"hash1": {"f1": {Value: "v1", Expire: time.Minute}, "f2": {Value: []byte("v2"), Expire: time.Hour}},
+		"hash2": {"f1": {Value: "v3", Expire: time.Minute}},
+	})
+	assert.Nil(t, err)
+	// miniredis has no HPEXPIRE: each hash expires with its longest-lived field.
+	assert.Equal(t, fieldTTLUnsupported, client.fieldTTL.Load())
+	assert.Equal(t, time.Hour, rdb.PTTL(ctx, "hash1").Val())
+	assert.Equal(t, time.Minute, rdb.PTTL(ctx, "hash2").Val())
+
+	// A shorter-lived field does not shorten the ttl of its hash.
+	assert.Nil(t, client.HSet(ctx, map[string]map[string]Entry{"hash1": {"f3": {Value: "v4", Expire: time.Second}}}))
+	assert.Equal(t, time.Hour, rdb.PTTL(ctx, "hash1").Val())
+
+	ret, err := client.HMGet(ctx, map[string][]string{"hash1": {"f1", "f2", "f4"}, "hash2": {"f1"}, "hash3": {"f1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]any{"hash1": {"f1": "v1", "f2": "v2"}, "hash2": {"f1": "v3"}}, ret)
+
+	n, err := client.HDel(ctx, "hash1", "f1", "f4")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	ret, err = client.HMGet(ctx, map[string][]string{"hash1": {"f1", "f2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]any{"hash1": {"f2": "v2"}}, ret)
+	assert.False(t, rdb.HExists(ctx, "hash1", expireFieldPrefix+"f1").Val())
+
+	// A field past its deadline is omitted, though its hash lives on.
+	assert.Nil(t, client.HSet(ctx, map[string]map[string]Entry{"hash1": {"f5": {Value: "v5", Expire: time.Millisecond}}}))
+	time.Sleep(5 * time.Millisecond)
+	ret, err = client.HMGet(ctx, map[string][]string{"hash1": {"f2", "f5"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]any{"hash1": {"f2": "v2"}}, ret)
+}
+
+func TestGoRedisV9Adaptor_HashLargeBatch(t *testing.T) {
+	ctx := context.Background()
+	rdb := newRdb()
+	client := NewGoRedisV9Adapter(rdb).(*GoRedisV9Adapter)
+
+	entries := make(map[string]Entry, 3*hSetScriptFields)
+	fields := make([]string, 0, 3*hSetScriptFields)
+	for i := 0; i < 3*hSetScriptFields; i++ {
+		field := strconv.Itoa(i)
+		entries[field] = Entry{Value: "v" + field, Expire: time.Minute}
+		fields = append(fields, field)
+	}
+	assert.Nil(t, client.HSet(ctx, map[string]map[string]Entry{"hash1": entries}))
+
+	ret, err := client.HMGet(ctx, map[string][]string{"hash1": fields})
+	assert.Nil(t, err)
+	assert.Len(t, ret["hash1"], 3*hSetScriptFields)
+	assert.Equal(t, time.Minute, rdb.PTTL(ctx, "hash1").Val())
+}
+
+func TestGoRedisV9Adaptor_HashSweep(t *testing.T) {
+	ctx := context.Background()
+	rdb := newRdb()
+	client := NewGoRedisV9Adapter(rdb).(*GoRedisV9Adapter)
+
+	entries := make(map[string]Entry, 100)
+	for i := 0; i < 100; i++ {
+		entries[strconv.Itoa(i)] = Entry{Value: "v", Expire: time.Millisecond}
+	}
+	assert.Nil(t, client.HSet(ctx, map[string]map[string]Entry{"hash1": entries}))
+	size := rdb.HLen(ctx, "hash1").Val()
+	time.Sleep(5 * time.Millisecond)
+
+	// Later writes delete the expired fields and their expire fields.
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, client.HSet(ctx, map[string]map[string]Entry{"hash1": {"f1": {Value: "v", Expire: time.Minute}}}))
+	}
+	assert.Less(t, rdb.HLen(ctx, "hash1").Val(), size)
+	assert.False(t, rdb.HExists(ctx, "hash1", "0").Val())
+	assert.False(t, rdb.HExists(ctx, "hash1", expireFieldPrefix+"0").Val())
+	assert.Equal(t, "v", rdb.HGet(ctx, "hash1", "f1").Val())
+}
+
+func TestGoRedisV9Adaptor_HashFieldTTL(t *testing.T) {
+	ctx := context.Background()
+	rdb := newRdb()
+	hook := &fieldTTLHook{}
+	rdb.AddHook(hook)
+	client := NewGoRedisV9Adapter(rdb).(*GoRedisV9Adapter)
+
+	err := client.HSet(ctx, map[string]map[string]Entry{
+		"hash1": {"f1": {Value: "v1", Expire: time.Minute}, "f2": {Value: "v2"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, fieldTTLSupported, client.fieldTTL.Load())
+	assert.ElementsMatch(t, [][]any{
+		{"HPEXPIRE", "hash1", int64(60000), "FIELDS", 1, "f1"},
+		{"HPERSIST", "hash1", "FIELDS", 1, "f2"},
+	}, hook.args)
+	assert.Equal(t, time.Duration(-1), rdb.PTTL(ctx, "hash1").Val())
+	assert.Equal(t, "v1", rdb.HGet(ctx, "hash1", "f1").Val())
+}
+
+// fieldTTLHook answers the hash field expiration commands miniredis does not support.
+type fieldTTLHook struct {
+	args [][]any
+}
+
+func (h *fieldTTLHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *fieldTTLHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *fieldTTLHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		rest := make([]redis.Cmder, 0, len(cmds))
+		for _, cmd := range cmds {
+			switch cmd.Name() {
+			case "hpexpire", "hpersist":
+				h.args = append(h.args, cmd.Args())
+				cmd.(*redis.IntSliceCmd).SetVal([]int64{1})
+			default:
+				rest = append(rest, cmd)
+			}
+		}
+		return next(ctx, rest)
+	}
+}
+
+func TestGoRedisV9Adaptor_Replicas(t *testing.T) {
+	ctx := context.Background()
+	p, r1, r2 := miniredis.RunT(t), miniredis.RunT(t), miniredis.RunT(t)
+	client := NewGoRedisV9Adapter(newClient(p),
+		WithGoRedisV9Replicas(newClient(r1), newClient(r2)),
+		WithGoRedisV9ReadYourWritesWindow(100*time.Millisecond)).(*GoRedisV9Adapter)
+
+	// Reads go to the replicas.
+	for _, s := range []*miniredis.Miniredis{r1, r2} {
+		assert.Nil(t, s.Set("replicated", "replica"))
+	}
+	for i := 0; i < 4; i++ {
+		val, err := client.Get(ctx, "replicated")
+		assert.Nil(t, err)
+		assert.Equal(t, "replica", val)
+	}
+
+	// Writes go to the primary, and the writer reads its own writes for a while.
+	assert.Nil(t, client.SetEX(ctx, "replicated", "primary", time.Minute))
+	assert.True(t, p.Exists("replicated"))
+	val, err := client.Get(ctx, "replicated")
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", val)
+
+	assert.Nil(t, r1.Set("other", "replica"))
+	assert.Nil(t, r2.Set("other", "replica"))
+	ret, err := client.MGet(ctx, "replicated", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"replicated": "primary", "other": "replica"}, ret)
+
+	time.Sleep(150 * time.Millisecond)
+	val, err = client.Get(ctx, "replicated")
+	assert.Nil(t, err)
+	assert.Equal(t, "replica", val)
+
+	// A failed replica is skipped, and its reads are retried on the primary.
+	r1.Close()
+	for i := 0; i < 4; i++ {
+		val, err = client.Get(ctx, "replicated")
+		assert.Nil(t, err)
+		assert.Contains(t, []string{"primary", "replica"}, val)
+	}
+	assert.Greater(t, client.replicas[0].downUntil.Load(), time.Now().UnixNano())
+	assert.Zero(t, client.replicas[1].downUntil.Load())
+
+	// With no healthy replica left, reads go to the primary.
+	r2.Close()
+	ret, err = client.MGet(ctx, "replicated", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"replicated": "primary"}, ret)
+	assert.Nil(t, client.replica())
+	val, err = client.Get(ctx, "replicated")
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", val)
+}
+
+func TestRecentWrites(t *testing.T) {
+	w := newRecentWrites(50*time.Millisecond, 3)
+	w.add("key1", "key2")
+	assert.True(t, w.contains("key0", "key1"))
+	recent, others := w.split([]string{"key1", "key3", "key2"})
+	assert.Equal(t, []string{"key1", "key2"}, recent)
+	assert.Equal(t, []string{"key3"}, others)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, w.contains("key1"))
+	w.add("key3")
+	assert.Equal(t, 1, len(w.current.keys))
+	assert.Equal(t, 2, len(w.prev.keys))
+
+	// Past maxKeys, every key is sent to the primary for a window.
+	w.add("key4", "key5", "key6")
+	assert.Equal(t, 3, len(w.current.keys))
+	assert.True(t, w.contains("key7"))
+
+	time.Sleep(110 * time.Millisecond)
+	assert.False(t, w.contains("key7"))
+	w.add("key8")
+	assert.Nil(t, w.prev.keys)
+
+	var disabled *recentWrites
+	disabled.add("key1")
+	assert.False(t, disabled.contains("key1"))
+	recent, others = disabled.split([]string{"key1"})
+	assert.Empty(t, recent)
+	assert.Equal(t, []string{"key1"}, others)
+}
+
+func newClient(s *miniredis.Miniredis) *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+}
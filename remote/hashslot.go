@@ -0,0 +1,42 @@
+package remote
+
+import "strings"
+
+// clusterSlots is the number of hash slots in Redis Cluster.
+const clusterSlots = 16384
+
+// hashSlot returns the Redis Cluster hash slot of key, honoring {hash tags}.
+func hashSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s > -1 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+e+1]
+		}
+	}
+
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM), as used by Redis Cluster.
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+var crc16Table = func() (table [256]uint16) {
+	const poly = 0x1021
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
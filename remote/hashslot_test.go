@@ -0,0 +1,16 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashSlot(t *testing.T) {
+	// Values from CLUSTER KEYSLOT.
+	assert.Equal(t, 12182, hashSlot("foo"))
+	assert.Equal(t, 5061, hashSlot("bar"))
+	assert.Equal(t, hashSlot("user"), hashSlot("{user}.name"))
+	assert.Equal(t, hashSlot("{}.name"), hashSlot("{}.name"))
+	assert.NotEqual(t, hashSlot("name"), hashSlot("{}.name"))
+}
@@ -0,0 +1,316 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/stats"
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const (
+	defaultHedgedDelay    = 10 * time.Millisecond
+	defaultHedgedMaxRatio = 0.05
+
+	// hedgedWindow is the number of latencies the percentile delay is computed over,
+	// and hedgedMinSamples the number needed before it replaces the fixed delay.
+	hedgedWindow     = 1024
+	hedgedMinSamples = 100
+	// hedgedRecompute is the number of latencies between two computations.
+	hedgedRecompute = 64
+	// hedgedBurst is the maximum number of hedges saved up by the ratio cap.
+	hedgedBurst = 10
+)
+
+var (
+	_ Remote        = (*Hedged)(nil)
+	_ EntriesSetter = (*Hedged)(nil)
+	_ TTLKeeper     = (*Hedged)(nil)
+	_ HashRemote    = (*Hedged)(nil)
+
+	errHedgePanic = errors.New("remote: hedged read panicked")
+)
+
+type (
+	// Hedged is a Remote cutting the tail latency of Get and MGet: when a read has
+	// not returned after a delay, it sends the same read again, to the backup remote
+	// if any, and returns whichever answers first. Writes are not hedged.
+	Hedged struct {
+		Remote
+		backup     Remote
+		delay      time.Duration
+		percentile float64
+		maxRatio   float64
+		handler    stats.Handler
+
+		mu        sync.Mutex // guards tokens and latencies.
+		tokens    float64
+		latencies []time.Duration
+		observed  int
+		estimate  atomic.Int64 // the percentile delay, 0 until computed.
+
+		requests atomic.Uint64
+		hedges   atomic.Uint64
+		wins     atomic.Uint64
+	}
+
+	// HedgedOption defines the method to customize a Hedged.
+	HedgedOption func(o *Hedged)
+
+	// HedgedStats counts the reads of a Hedged.
+	HedgedStats struct {
+		// Requests is the number of reads.
+		Requests uint64
+		// Hedges is the number of reads sent a second time.
+		Hedges uint64
+		// Wins is the number of hedges that answered first.
+		Wins uint64
+	}
+
+	hedgeResult[T any] struct {
+		val    T
+		err    error
+		backup bool
+	}
+)
+
+// WithHedgedDelay sets the fixed delay before a read is hedged. Default is 10ms.
+func WithHedgedDelay(delay time.Duration) HedgedOption {
+	return func(o *Hedged) {
+		o.delay = delay
+	}
+}
+
+// WithHedgedPercentile hedges reads slower than the given percentile (e.g. 0.95) of
+// the recent read latencies, instead of the fixed delay. The fixed delay is used
+// until enough reads are observed.
+func WithHedgedPercentile(percentile float64) HedgedOption {
+	return func(o *Hedged) {
+		o.percentile = percentile
+	}
+}
+
+// WithHedgedMaxRatio caps the hedges to the given ratio of the reads, so that a slow
+// remote is not sent twice the load. Default is 0.05.
+func WithHedgedMaxRatio(maxRatio float64) HedgedOption {
+	return func(o *Hedged) {
+		o.maxRatio = maxRatio
+	}
+}
+
+// WithHedgedBackup sends the hedges to backup, e.g. a remote on a replica. By
+// default they go to the hedged remote itself, which spreads them over its replicas
+// when it is a GoRedisV9Adapter configured with some.
+func WithHedgedBackup(backup Remote) HedgedOption {
+	return func(o *Hedged) {
+		o.backup = backup
+	}
+}
+
+// WithHedgedStatsHandler reports the hedges and the hedges won to handler, if it
+// implements stats.HedgeHandler, e.g. the stats handler of the cache.
+func WithHedgedStatsHandler(handler stats.Handler) HedgedOption {
+	return func(o *Hedged) {
+		o.handler = handler
+	}
+}
+
+// NewHedged creates a Remote hedging the reads of r.
+func NewHedged(r Remote, opts ...HedgedOption) *Hedged {
+	h := &Hedged{Remote: r}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.backup == nil {
+		h.backup = r
+	}
+	if h.delay <= 0 {
+		h.delay = defaultHedgedDelay
+	}
+	if h.maxRatio <= 0 {
+		h.maxRatio = defaultHedgedMaxRatio
+	}
+	if h.percentile >= 1 {
+		h.percentile = 0
+	}
+
+	return h
+}
+
+// Stats returns the counts of reads, hedges and hedges won so far.
+func (h *Hedged) Stats() HedgedStats {
+	return HedgedStats{
+		Requests: h.requests.Load(),
+		Hedges:   h.hedges.Load(),
+		Wins:     h.wins.Load(),
+	}
+}
+
+func (h *Hedged) Get(ctx context.Context, key string) (val string, err error) {
+	return hedge(ctx, h, func(ctx context.Context, r Remote) (string, error) {
+		val, err := r.Get(ctx, key)
+		if err != nil && r != h.Remote && errors.Is(err, r.Nil()) {
+			err = h.Remote.Nil()
+		}
+		return val, err
+	})
+}
+
+func (h *Hedged) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	return hedge(ctx, h, func(ctx context.Context, r Remote) (map[string]any, error) {
+		return r.MGet(ctx, keys...)
+	})
+}
+
+func (h *Hedged) SetXXKeepTTL(ctx context.Context, key string, value any) (val bool, err error) {
+	return SetXXKeepTTL(ctx, h.Remote, key, value)
+}
+
+func (h *Hedged) MSetEntries(ctx context.Context, entries map[string]Entry) error {
+	return MSetEntries(ctx, h.Remote, entries)
+}
+
+// HMGet hedges the reads like MGet. It returns ErrHashUnsupported if the hedged
+// remote is not a HashRemote.
+func (h *Hedged) HMGet(ctx context.Context, fields map[string][]string) (map[string]map[string]any, error) {
+	if _, err := asHashRemote(h.Remote); err != nil {
+		return nil, err
+	}
+	return hedge(ctx, h, func(ctx context.Context, r Remote) (map[string]map[string]any, error) {
+		hash, err := asHashRemote(r)
+		if err != nil {
+			return nil, err
+		}
+		return hash.HMGet(ctx, fields)
+	})
+}
+
+func (h *Hedged) HSet(ctx context.Context, values map[string]map[string]Entry) error {
+	hash, err := asHashRemote(h.Remote)
+	if err != nil {
+		return err
+	}
+	return hash.HSet(ctx, values)
+}
+
+func (h *Hedged) HDel(ctx context.Context, key string, fields ...string) (val int64, err error) {
+	hash, err := asHashRemote(h.Remote)
+	if err != nil {
+		return 0, err
+	}
+	return hash.HDel(ctx, key, fields...)
+}
+
+func (h *Hedged) supportsHash() bool {
+	return SupportsHash(h.Remote)
+}
+
+// hedge runs call on the hedged remote and, if it is slower than the delay and the
+// ratio cap allows it, on the backup too. It returns the first answer, a miss being
+// an answer; an error only if both calls fail.
+func hedge[T any](ctx context.Context, h *Hedged, call func(ctx context.Context, r Remote) (T, error)) (T, error) {
+	h.requests.Add(1)
+	h.mu.Lock()
+	h.tokens = min(h.tokens+h.maxRatio, hedgedBurst)
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan hedgeResult[T], 2)
+	run := func(r Remote, backup bool) {
+		res := hedgeResult[T]{err: errHedgePanic, backup: backup}
+		util.WithRecover(func() {
+			res.val, res.err = call(ctx, r)
+		})
+		results <- res
+	}
+	go run(h.Remote, false)
+
+	timer := time.NewTimer(h.hedgeDelay())
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		h.observe(time.Since(start))
+		return res.val, res.err
+	case <-timer.C:
+	}
+
+	if !h.takeToken() {
+		res := <-results
+		h.observe(time.Since(start))
+		return res.val, res.err
+	}
+	h.hedges.Add(1)
+	if hh, ok := h.handler.(stats.HedgeHandler); ok {
+		hh.IncrHedge()
+	}
+	go run(h.backup, true)
+
+	// The latency of a primary call cut short by a winning hedge is only known to be
+	// at least the time waited.
+	res := <-results
+	if res.err != nil && !errors.Is(res.err, h.Remote.Nil()) {
+		if second := <-results; second.err == nil || errors.Is(second.err, h.Remote.Nil()) {
+			res = second
+		}
+	}
+	h.observe(time.Since(start))
+	if res.backup {
+		h.wins.Add(1)
+		if hh, ok := h.handler.(stats.HedgeHandler); ok {
+			hh.IncrHedgeWin()
+		}
+	}
+	return res.val, res.err
+}
+
+// hedgeDelay returns the time to wait for an answer before hedging.
+func (h *Hedged) hedgeDelay() time.Duration {
+	if estimate := h.estimate.Load(); h.percentile > 0 && estimate > 0 {
+		return time.Duration(estimate)
+	}
+	return h.delay
+}
+
+// takeToken reports whether the ratio cap allows one more hedge, and counts it.
+func (h *Hedged) takeToken() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// observe records the latency of a read, and recomputes the percentile delay every
+// hedgedRecompute reads.
+func (h *Hedged) observe(latency time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < hedgedWindow {
+		h.latencies = append(h.latencies, latency)
+	} else {
+		h.latencies[h.observed%hedgedWindow] = latency
+	}
+	h.observed++
+	if len(h.latencies) < hedgedMinSamples || h.observed%hedgedRecompute != 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	h.estimate.Store(int64(sorted[int(h.percentile*float64(len(sorted)))]))
+}
@@ -0,0 +1,158 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/stats"
+)
+
+// slowRemote is a Remote whose reads take delay, then fail with err if set.
+type slowRemote struct {
+	remote.Remote
+	delay time.Duration
+	err   error
+}
+
+func (r slowRemote) Get(ctx context.Context, key string) (string, error) {
+	if err := r.wait(ctx); err != nil {
+		return "", err
+	}
+	return r.Remote.Get(ctx, key)
+}
+
+func (r slowRemote) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.Remote.MGet(ctx, keys...)
+}
+
+func (r slowRemote) wait(ctx context.Context) error {
+	select {
+	case <-time.After(r.delay):
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestHedged(t *testing.T) {
+	ctx := context.Background()
+	primary, backup := remote.NewMemory(), remote.NewMemory()
+	for _, m := range []*remote.Memory{primary, backup} {
+		assert.Nil(t, m.SetEX(ctx, "key1", "value1", time.Minute))
+	}
+
+	// A fast read is not hedged.
+	h := remote.NewHedged(slowRemote{Remote: primary}, remote.WithHedgedBackup(backup), remote.WithHedgedMaxRatio(1))
+	val, err := h.Get(ctx, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Equal(t, remote.HedgedStats{Requests: 1}, h.Stats())
+
+	// A slow read is hedged, and the hedge wins.
+	var s stats.Stats
+	h = remote.NewHedged(slowRemote{Remote: primary, delay: time.Second}, remote.WithHedgedBackup(backup),
+		remote.WithHedgedDelay(10*time.Millisecond), remote.WithHedgedMaxRatio(1), remote.WithHedgedStatsHandler(&s))
+	start := time.Now()
+	val, err = h.Get(ctx, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", val)
+	ret, err := h.MGet(ctx, "key1", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"key1": "value1"}, ret)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, remote.HedgedStats{Requests: 2, Hedges: 2, Wins: 2}, h.Stats())
+	assert.Equal(t, uint64(2), s.Hedges)
+	assert.Equal(t, uint64(2), s.HedgeWins)
+
+	// A failing hedge does not hide the answer of the primary.
+	h = remote.NewHedged(slowRemote{Remote: primary, delay: 50 * time.Millisecond},
+		remote.WithHedgedBackup(slowRemote{Remote: backup, err: errFailing}),
+		remote.WithHedgedDelay(10*time.Millisecond), remote.WithHedgedMaxRatio(1))
+	val, err = h.Get(ctx, "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "value1", val)
+	assert.Equal(t, remote.HedgedStats{Requests: 1, Hedges: 1}, h.Stats())
+
+	// A primary failing before the delay is not hedged.
+	h = remote.NewHedged(slowRemote{Remote: primary, err: errFailing}, remote.WithHedgedBackup(backup), remote.WithHedgedMaxRatio(1))
+	_, err = h.Get(ctx, "key1")
+	assert.ErrorIs(t, err, errFailing)
+	assert.Equal(t, remote.HedgedStats{Requests: 1}, h.Stats())
+}
+
+func TestHedged_Nil(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	primary := remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s.Addr()}))
+
+	// A miss on the backup is a miss of the hedged remote.
+	h := remote.NewHedged(slowRemote{Remote: primary, delay: time.Second}, remote.WithHedgedBackup(remote.NewMemory()),
+		remote.WithHedgedDelay(time.Millisecond), remote.WithHedgedMaxRatio(1))
+	_, err := h.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, redis.Nil))
+	assert.Equal(t, remote.HedgedStats{Requests: 1, Hedges: 1, Wins: 1}, h.Stats())
+}
+
+func TestHedged_MaxRatio(t *testing.T) {
+	ctx := context.Background()
+	h := remote.NewHedged(slowRemote{Remote: remote.NewMemory(), delay: 5 * time.Millisecond},
+		remote.WithHedgedBackup(remote.NewMemory()), remote.WithHedgedDelay(time.Millisecond), remote.WithHedgedMaxRatio(0.25))
+	for i := 0; i < 20; i++ {
+		_, _ = h.Get(ctx, "key1")
+	}
+	assert.Equal(t, uint64(20), h.Stats().Requests)
+	assert.Equal(t, uint64(5), h.Stats().Hedges)
+}
+
+func TestHedged_Percentile(t *testing.T) {
+	ctx := context.Background()
+	slow := &slowRemote{Remote: remote.NewMemory()}
+	h := remote.NewHedged(slow, remote.WithHedgedBackup(remote.NewMemory()),
+		remote.WithHedgedDelay(time.Hour), remote.WithHedgedPercentile(0.9), remote.WithHedgedMaxRatio(1))
+
+	// Fast reads set the percentile delay, far below the fixed delay.
+	for i := 0; i < 128; i++ {
+		_, _ = h.Get(ctx, "key1")
+	}
+	assert.Equal(t, uint64(0), h.Stats().Hedges)
+
+	slow.delay = time.Second
+	start := time.Now()
+	_, _ = h.Get(ctx, "key1")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, remote.HedgedStats{Requests: 129, Hedges: 1, Wins: 1}, h.Stats())
+}
+
+func TestHedged_Hash(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	h := remote.NewHedged(remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: s.Addr()})))
+	assert.True(t, remote.SupportsHash(h))
+
+	assert.Nil(t, h.HSet(ctx, map[string]map[string]remote.Entry{"hash1": {"f1": {Value: "v1", Expire: time.Minute}}}))
+	ret, err := h.HMGet(ctx, map[string][]string{"hash1": {"f1", "f2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]map[string]any{"hash1": {"f1": "v1"}}, ret)
+	n, err := h.HDel(ctx, "hash1", "f1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// The hash calls fail on a remote without hashes.
+	h = remote.NewHedged(remote.NewMemory())
+	assert.False(t, remote.SupportsHash(h))
+	_, err = h.HMGet(ctx, map[string][]string{"hash1": {"f1"}})
+	assert.ErrorIs(t, err, remote.ErrHashUnsupported)
+	assert.ErrorIs(t, h.HSet(ctx, map[string]map[string]remote.Entry{"hash1": {"f1": {Value: "v1"}}}), remote.ErrHashUnsupported)
+	_, err = h.HDel(ctx, "hash1", "f1")
+	assert.ErrorIs(t, err, remote.ErrHashUnsupported)
+}
@@ -0,0 +1,467 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMemcachedTimeout      = 500 * time.Millisecond
+	defaultMemcachedMaxIdleConns = 16
+	defaultMemcachedMaxItemSize  = 1024 * 1024 // memcached's default item size limit (-I).
+	memcachedMaxKeyLen           = 250
+	memcachedBatchSize           = 100
+	// memcachedMaxRelativeExpire is the longest exptime memcached reads as relative
+	// seconds; a larger one is read as a unix timestamp.
+	memcachedMaxRelativeExpire = 30 * 24 * time.Hour
+)
+
+var (
+	_ Remote        = (*Memcached)(nil)
+	_ EntriesSetter = (*Memcached)(nil)
+
+	// ErrMemcachedValueTooLarge is returned when a value exceeds the item size limit.
+	ErrMemcachedValueTooLarge = errors.New("memcached: value too large")
+	// ErrMemcachedMalformedKey is returned for keys memcached can not store: empty,
+	// longer than 250 bytes, or holding spaces or control characters.
+	ErrMemcachedMalformedKey = errors.New("memcached: malformed key")
+
+	errMemcachedNil = errors.New("memcached: cache miss")
+)
+
+type (
+	// Memcached is a Remote backed by a memcached server, speaking the text protocol.
+	// SetNX maps to add, SetXX to replace and MGet to a multi-key get.
+	Memcached struct {
+		addr         string
+		timeout      time.Duration
+		maxIdleConns int
+		maxItemSize  int
+		idle         chan *memcachedConn
+	}
+
+	// MemcachedOption defines the method to customize a Memcached.
+	MemcachedOption func(o *Memcached)
+
+	memcachedConn struct {
+		nc     net.Conn
+		rw     *bufio.ReadWriter
+		broken bool
+	}
+
+	memcachedItem struct {
+		key     string
+		value   string
+		exptime int64
+	}
+)
+
+// WithMemcachedTimeout sets the timeout of dialing and of each request. Default is 500ms.
+func WithMemcachedTimeout(timeout time.Duration) MemcachedOption {
+	return func(o *Memcached) {
+		o.timeout = timeout
+	}
+}
+
+// WithMemcachedMaxIdleConns sets the maximum number of idle connections kept. Default is 16.
+func WithMemcachedMaxIdleConns(maxIdleConns int) MemcachedOption {
+	return func(o *Memcached) {
+		o.maxIdleConns = maxIdleConns
+	}
+}
+
+// WithMemcachedMaxItemSize sets the item size limit of the server, in bytes. Larger
+// values fail with ErrMemcachedValueTooLarge before being sent. Default is 1MB.
+func WithMemcachedMaxItemSize(maxItemSize int) MemcachedOption {
+	return func(o *Memcached) {
+		o.maxItemSize = maxItemSize
+	}
+}
+
+// NewMemcached creates a Remote for the memcached server at addr.
+func NewMemcached(addr string, opts ...MemcachedOption) *Memcached {
+	m := &Memcached{
+		addr: addr,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultMemcachedTimeout
+	}
+	if m.maxIdleConns <= 0 {
+		m.maxIdleConns = defaultMemcachedMaxIdleConns
+	}
+	if m.maxItemSize <= 0 {
+		m.maxItemSize = defaultMemcachedMaxItemSize
+	}
+	m.idle = make(chan *memcachedConn, m.maxIdleConns)
+
+	return m
+}
+
+func (m *Memcached) SetEX(ctx context.Context, key string, value any, expire time.Duration) error {
+	_, err := m.store(ctx, "set", key, value, expire)
+	return err
+}
+
+func (m *Memcached) SetNX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	return m.store(ctx, "add", key, value, expire)
+}
+
+func (m *Memcached) SetXX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	return m.store(ctx, "replace", key, value, expire)
+}
+
+func (m *Memcached) Get(ctx context.Context, key string) (val string, err error) {
+	if err = checkMemcachedKey(key); err != nil {
+		return "", err
+	}
+
+	ret := make(map[string]any, 1)
+	if err = m.withConn(ctx, func(c *memcachedConn) error {
+		return c.get(ret, key)
+	}); err != nil {
+		return "", err
+	}
+	if v, ok := ret[key]; ok {
+		return v.(string), nil
+	}
+	return "", errMemcachedNil
+}
+
+func (m *Memcached) Del(ctx context.Context, key string) (val int64, err error) {
+	if err = checkMemcachedKey(key); err != nil {
+		return 0, err
+	}
+
+	err = m.withConn(ctx, func(c *memcachedConn) error {
+		if _, err := fmt.Fprintf(c.rw, "delete %s\r\n", key); err != nil {
+			return c.fail(err)
+		}
+		line, err := c.roundTrip()
+		if err != nil {
+			return err
+		}
+		switch line {
+		case "DELETED":
+			val = 1
+		case "NOT_FOUND":
+		default:
+			return c.replyError(line)
+		}
+		return nil
+	})
+	return
+}
+
+// MGet fetches keys with multi-key gets of up to 100 keys. Malformed keys are
+// reported as misses.
+func (m *Memcached) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	valid := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if checkMemcachedKey(key) == nil {
+			valid = append(valid, key)
+		}
+	}
+
+	ret := make(map[string]any, len(valid))
+	if len(valid) == 0 {
+		return ret, nil
+	}
+	err := m.withConn(ctx, func(c *memcachedConn) error {
+		for _, keys := range chunk(valid, memcachedBatchSize) {
+			if err := c.get(ret, keys...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return ret, err
+}
+
+func (m *Memcached) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+	entries := make(map[string]Entry, len(value))
+	for key, val := range value {
+		entries[key] = Entry{Value: val, Expire: expire}
+	}
+
+	return m.MSetEntries(ctx, entries)
+}
+
+// MSetEntries is like MSet, with an expiration per key. The sets are pipelined,
+// up to 100 per round trip. Keys that can not be stored, such as values over the
+// item size limit, are reported in a *BatchError; the others are still written.
+func (m *Memcached) MSetEntries(ctx context.Context, entries map[string]Entry) error {
+	var (
+		batchErr *BatchError
+		items    = make([]memcachedItem, 0, len(entries))
+	)
+	for key, entry := range entries {
+		item, err := m.newItem(key, entry.Value, entry.Expire)
+		if err != nil {
+			batchErr = batchErr.add([]string{key}, err)
+			continue
+		}
+		items = append(items, item)
+	}
+
+	for len(items) > 0 {
+		batch := items
+		if len(batch) > memcachedBatchSize {
+			batch = items[:memcachedBatchSize]
+		}
+		items = items[len(batch):]
+
+		var done int
+		err := m.withConn(ctx, func(c *memcachedConn) error {
+			for _, item := range batch {
+				c.writeStore("set", item)
+			}
+			if err := c.flush(); err != nil {
+				return err
+			}
+			for ; done < len(batch); done++ {
+				if _, err := c.readStoreReply(); err != nil {
+					if c.broken {
+						return err
+					}
+					batchErr = batchErr.add([]string{batch[done].key}, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			// The connection failed: the remaining keys are not written.
+			keys := make([]string, 0, len(batch)-done+len(items))
+			for _, item := range batch[done:] {
+				keys = append(keys, item.key)
+			}
+			for _, item := range items {
+				keys = append(keys, item.key)
+			}
+			batchErr = batchErr.add(keys, err)
+			break
+		}
+	}
+
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+func (m *Memcached) Nil() error {
+	return errMemcachedNil
+}
+
+// Close closes the idle connections.
+func (m *Memcached) Close() error {
+	for {
+		select {
+		case c := <-m.idle:
+			_ = c.nc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (m *Memcached) store(ctx context.Context, verb, key string, value any, expire time.Duration) (stored bool, err error) {
+	item, err := m.newItem(key, value, expire)
+	if err != nil {
+		return false, err
+	}
+
+	err = m.withConn(ctx, func(c *memcachedConn) error {
+		c.writeStore(verb, item)
+		if err := c.flush(); err != nil {
+			return err
+		}
+		stored, err = c.readStoreReply()
+		return err
+	})
+	return
+}
+
+func (m *Memcached) newItem(key string, value any, expire time.Duration) (memcachedItem, error) {
+	if err := checkMemcachedKey(key); err != nil {
+		return memcachedItem{}, err
+	}
+	s, err := valueString(value)
+	if err != nil {
+		return memcachedItem{}, err
+	}
+	if len(s) > m.maxItemSize {
+		return memcachedItem{}, fmt.Errorf("%w: key %q has %d bytes, limit is %d", ErrMemcachedValueTooLarge, key, len(s), m.maxItemSize)
+	}
+
+	return memcachedItem{key: key, value: s, exptime: memcachedExptime(expire)}, nil
+}
+
+// withConn runs fn on a pooled connection, within the timeout and the deadline of ctx.
+// The connection is closed instead of pooled if fn broke it.
+func (m *Memcached) withConn(ctx context.Context, fn func(c *memcachedConn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var c *memcachedConn
+	select {
+	case c = <-m.idle:
+	default:
+		dialer := net.Dialer{Timeout: m.timeout}
+		nc, err := dialer.DialContext(ctx, "tcp", m.addr)
+		if err != nil {
+			return err
+		}
+		c = &memcachedConn{nc: nc, rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}
+	}
+
+	deadline := time.Now().Add(m.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.nc.SetDeadline(deadline); err != nil {
+		_ = c.nc.Close()
+		return err
+	}
+
+	err := fn(c)
+	if c.broken {
+		_ = c.nc.Close()
+		return err
+	}
+	select {
+	case m.idle <- c:
+	default:
+		_ = c.nc.Close()
+	}
+	return err
+}
+
+// get reads the values of keys into ret.
+func (c *memcachedConn) get(ret map[string]any, keys ...string) error {
+	if _, err := fmt.Fprintf(c.rw, "get %s\r\n", strings.Join(keys, " ")); err != nil {
+		return c.fail(err)
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return nil
+		}
+
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "VALUE" {
+			return c.replyError(line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return c.replyError(line)
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(c.rw, data); err != nil {
+			return c.fail(err)
+		}
+		ret[fields[1]] = string(data[:size])
+	}
+}
+
+func (c *memcachedConn) writeStore(verb string, item memcachedItem) {
+	// <verb> <key> <flags> <exptime> <bytes>\r\n<data>\r\n
+	_, _ = fmt.Fprintf(c.rw, "%s %s 0 %d %d\r\n", verb, item.key, item.exptime, len(item.value))
+	_, _ = c.rw.WriteString(item.value)
+	_, _ = c.rw.WriteString("\r\n")
+}
+
+func (c *memcachedConn) readStoreReply() (bool, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return false, err
+	}
+	switch line {
+	case "STORED":
+		return true, nil
+	case "NOT_STORED":
+		return false, nil
+	default:
+		return false, c.replyError(line)
+	}
+}
+
+func (c *memcachedConn) roundTrip() (string, error) {
+	if err := c.flush(); err != nil {
+		return "", err
+	}
+	return c.readLine()
+}
+
+func (c *memcachedConn) flush() error {
+	if err := c.rw.Flush(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+func (c *memcachedConn) readLine() (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", c.fail(err)
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// replyError converts an unexpected reply to an error. Only a value rejected for
+// its size leaves the connection usable.
+func (c *memcachedConn) replyError(line string) error {
+	if strings.HasPrefix(line, "SERVER_ERROR") && strings.Contains(line, "too large") {
+		return fmt.Errorf("%w: %s", ErrMemcachedValueTooLarge, line)
+	}
+	return c.fail(fmt.Errorf("memcached: unexpected reply %q", line))
+}
+
+// fail marks the connection as broken, so it is not reused.
+func (c *memcachedConn) fail(err error) error {
+	c.broken = true
+	return err
+}
+
+func checkMemcachedKey(key string) error {
+	if len(key) == 0 || len(key) > memcachedMaxKeyLen {
+		return fmt.Errorf("%w: %q", ErrMemcachedMalformedKey, key)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return fmt.Errorf("%w: %q", ErrMemcachedMalformedKey, key)
+		}
+	}
+	return nil
+}
+
+// memcachedExptime converts expire to an exptime: relative seconds, rounded up, or
+// a unix timestamp beyond 30 days. A non-positive expire means never.
+func memcachedExptime(expire time.Duration) int64 {
+	if expire <= 0 {
+		return 0
+	}
+	if expire > memcachedMaxRelativeExpire {
+		return time.Now().Add(expire).Unix()
+	}
+	return int64((expire + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,258 @@
+package remote_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+	"github.com/mgtv-tech/jetcache-go/remote/remotetest"
+)
+
+const fakeMemcachedItemSize = 1024
+
+type (
+	// fakeMemcached is an in-process memcached server speaking the subset of the
+	// text protocol used by remote.Memcached. Its clock only moves by FastForward.
+	fakeMemcached struct {
+		ln    net.Listener
+		mu    sync.Mutex
+		items map[string]fakeMemcachedItem
+		skew  time.Duration
+	}
+
+	fakeMemcachedItem struct {
+		value     []byte
+		expiresAt time.Time
+	}
+)
+
+func TestMemcached_Conformance(t *testing.T) {
+	remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+		s := runFakeMemcached(t)
+		m := remote.NewMemcached(s.Addr())
+		t.Cleanup(func() { _ = m.Close() })
+		return m, s.FastForward
+	})
+}
+
+func TestMemcached_ValueTooLarge(t *testing.T) {
+	ctx := context.Background()
+	s := runFakeMemcached(t)
+
+	// Rejected by the client.
+	m := remote.NewMemcached(s.Addr(), remote.WithMemcachedMaxItemSize(fakeMemcachedItemSize))
+	err := m.SetEX(ctx, "key1", strings.Repeat("v", fakeMemcachedItemSize+1), time.Minute)
+	assert.ErrorIs(t, err, remote.ErrMemcachedValueTooLarge)
+
+	// Rejected by the server, the connection is still usable.
+	m = remote.NewMemcached(s.Addr(), remote.WithMemcachedMaxIdleConns(1))
+	err = m.SetEX(ctx, "key1", strings.Repeat("v", fakeMemcachedItemSize+1), time.Minute)
+	assert.ErrorIs(t, err, remote.ErrMemcachedValueTooLarge)
+	_, err = m.SetNX(ctx, "key1", strings.Repeat("v", fakeMemcachedItemSize+1), time.Minute)
+	assert.ErrorIs(t, err, remote.ErrMemcachedValueTooLarge)
+	assert.Nil(t, m.SetEX(ctx, "key1", "value1", time.Minute))
+
+	// The other values of a batch are still written.
+	err = m.MSet(ctx, map[string]any{
+		"key2": "value2",
+		"key3": strings.Repeat("v", fakeMemcachedItemSize+1),
+		"key4": "value4",
+	}, time.Minute)
+	var batchErr *remote.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, []string{"key3"}, batchErr.Keys)
+	assert.ErrorIs(t, err, remote.ErrMemcachedValueTooLarge)
+
+	ret, err := m.MGet(ctx, "key1", "key2", "key3", "key4")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"key1": "value1", "key2": "value2", "key4": "value4"}, ret)
+}
+
+func TestMemcached_MalformedKey(t *testing.T) {
+	ctx := context.Background()
+	m := remote.NewMemcached(runFakeMemcached(t).Addr())
+
+	for _, key := range []string{"", "with space", "new\nline", strings.Repeat("k", 251)} {
+		assert.ErrorIs(t, m.SetEX(ctx, key, "value", time.Minute), remote.ErrMemcachedMalformedKey)
+		_, err := m.Get(ctx, key)
+		assert.ErrorIs(t, err, remote.ErrMemcachedMalformedKey)
+		_, err = m.Del(ctx, key)
+		assert.ErrorIs(t, err, remote.ErrMemcachedMalformedKey)
+	}
+
+	ret, err := m.MGet(ctx, "with space")
+	assert.Nil(t, err)
+	assert.Empty(t, ret)
+}
+
+func TestMemcached_Batches(t *testing.T) {
+	ctx := context.Background()
+	m := remote.NewMemcached(runFakeMemcached(t).Addr())
+
+	value := make(map[string]any)
+	keys := make([]string, 0, 250)
+	for i := 0; i < 250; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value[key] = fmt.Sprintf("value%d", i)
+		keys = append(keys, key)
+	}
+	assert.Nil(t, m.MSet(ctx, value, time.Minute))
+
+	ret, err := m.MGet(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, value, ret)
+}
+
+func TestMemcached_ServerDown(t *testing.T) {
+	ctx := context.Background()
+	s := runFakeMemcached(t)
+	m := remote.NewMemcached(s.Addr())
+	assert.Nil(t, m.SetEX(ctx, "key1", "value1", time.Minute))
+
+	_ = s.ln.Close()
+	s.mu.Lock()
+	s.items = nil
+	s.mu.Unlock()
+
+	_, err := m.Get(ctx, "key1")
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, m.Nil())
+
+	err = m.MSet(ctx, map[string]any{"key1": "value1", "key2": "value2"}, time.Minute)
+	var batchErr *remote.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.ElementsMatch(t, []string{"key1", "key2"}, batchErr.Keys)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.Get(canceled, "key1")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func runFakeMemcached(t *testing.T) *fakeMemcached {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeMemcached{ln: ln, items: make(map[string]fakeMemcachedItem)}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeMemcached) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeMemcached) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.skew += d
+	s.mu.Unlock()
+}
+
+func (s *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			fmt.Fprint(w, "ERROR\r\n")
+			_ = w.Flush()
+			continue
+		}
+
+		s.mu.Lock()
+		if s.items == nil {
+			s.mu.Unlock()
+			return
+		}
+		now := time.Now().Add(s.skew)
+		switch fields[0] {
+		case "get":
+			for _, key := range fields[1:] {
+				if item, ok := s.get(key, now); ok {
+					fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", key, len(item.value), item.value)
+				}
+			}
+			fmt.Fprint(w, "END\r\n")
+		case "set", "add", "replace":
+			// <verb> <key> <flags> <exptime> <bytes>
+			exptime, _ := strconv.ParseInt(fields[3], 10, 64)
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(r, data); err != nil {
+				s.mu.Unlock()
+				return
+			}
+			_, exists := s.get(fields[1], now)
+			switch {
+			case size > fakeMemcachedItemSize:
+				fmt.Fprint(w, "SERVER_ERROR object too large for cache\r\n")
+			case fields[0] == "add" && exists, fields[0] == "replace" && !exists:
+				fmt.Fprint(w, "NOT_STORED\r\n")
+			default:
+				item := fakeMemcachedItem{value: data[:size]}
+				switch {
+				case exptime > 30*24*3600:
+					item.expiresAt = time.Unix(exptime, 0).Add(s.skew)
+				case exptime > 0:
+					item.expiresAt = now.Add(time.Duration(exptime) * time.Second)
+				}
+				s.items[fields[1]] = item
+				fmt.Fprint(w, "STORED\r\n")
+			}
+		case "delete":
+			if _, ok := s.get(fields[1], now); ok {
+				delete(s.items, fields[1])
+				fmt.Fprint(w, "DELETED\r\n")
+			} else {
+				fmt.Fprint(w, "NOT_FOUND\r\n")
+			}
+		default:
+			fmt.Fprint(w, "ERROR\r\n")
+		}
+		s.mu.Unlock()
+
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// get returns the unexpired item of key. s.mu must be held.
+func (s *fakeMemcached) get(key string, now time.Time) (fakeMemcachedItem, bool) {
+	item, ok := s.items[key]
+	if !ok || (!item.expiresAt.IsZero() && !now.Before(item.expiresAt)) {
+		delete(s.items, key)
+		return fakeMemcachedItem{}, false
+	}
+	return item, true
+}
@@ -0,0 +1,207 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is the minimum interval between two sweeps of expired keys.
+const memorySweepInterval = time.Minute
+
+var (
+	_ Remote        = (*Memory)(nil)
+	_ EntriesSetter = (*Memory)(nil)
+	_ TTLKeeper     = (*Memory)(nil)
+
+	errMemoryNil = errors.New("remote: key does not exist")
+)
+
+type (
+	// Memory is an in-process Remote, for tests and single-process deployments.
+	// Values are stored as strings, converted like go-redis does, so code written
+	// against Redis behaves the same. Expired keys are removed when read, and swept
+	// at most once per minute on writes.
+	Memory struct {
+		mu        sync.RWMutex
+		items     map[string]memoryItem
+		lastSweep time.Time
+	}
+
+	memoryItem struct {
+		value     string
+		expiresAt time.Time
+	}
+)
+
+// NewMemory creates an empty in-process Remote.
+func NewMemory() *Memory {
+	return &Memory{
+		items:     make(map[string]memoryItem),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) SetEX(ctx context.Context, key string, value any, expire time.Duration) error {
+	s, err := valueString(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.set(key, s, expire, time.Now())
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) SetNX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	return m.setIf(key, value, expire, false)
+}
+
+func (m *Memory) SetXX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	return m.setIf(key, value, expire, true)
+}
+
+func (m *Memory) SetXXKeepTTL(ctx context.Context, key string, value any) (val bool, err error) {
+	s, err := valueString(value)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok || item.expired(time.Now()) {
+		return false, nil
+	}
+	item.value = s
+	m.items[key] = item
+	return true, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (val string, err error) {
+	now := time.Now()
+	m.mu.RLock()
+	item, ok := m.items[key]
+	m.mu.RUnlock()
+	if !ok {
+		return "", errMemoryNil
+	}
+	if item.expired(now) {
+		m.mu.Lock()
+		if item, ok := m.items[key]; ok && item.expired(now) {
+			delete(m.items, key)
+		}
+		m.mu.Unlock()
+		return "", errMemoryNil
+	}
+
+	return item.value, nil
+}
+
+func (m *Memory) Del(ctx context.Context, key string) (val int64, err error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if !ok {
+		return 0, nil
+	}
+	delete(m.items, key)
+	if item.expired(now) {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (m *Memory) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	now := time.Now()
+	ret := make(map[string]any, len(keys))
+	m.mu.RLock()
+	for _, key := range keys {
+		if item, ok := m.items[key]; ok && !item.expired(now) {
+			ret[key] = item.value
+		}
+	}
+	m.mu.RUnlock()
+
+	return ret, nil
+}
+
+func (m *Memory) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+	entries := make(map[string]Entry, len(value))
+	for key, val := range value {
+		entries[key] = Entry{Value: val, Expire: expire}
+	}
+
+	return m.MSetEntries(ctx, entries)
+}
+
+// MSetEntries is like MSet, with an expiration per key. Either all entries are
+// written or, if a value can not be converted, none.
+func (m *Memory) MSetEntries(ctx context.Context, entries map[string]Entry) error {
+	values := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		s, err := valueString(entry.Value)
+		if err != nil {
+			return err
+		}
+		values[key] = s
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	for key, s := range values {
+		m.set(key, s, entries[key].Expire, now)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Nil() error {
+	return errMemoryNil
+}
+
+func (m *Memory) setIf(key string, value any, expire time.Duration, exists bool) (bool, error) {
+	s, err := valueString(value)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[key]
+	if (ok && !item.expired(now)) != exists {
+		return false, nil
+	}
+	m.set(key, s, expire, now)
+	return true, nil
+}
+
+// set stores the value, and sweeps the expired keys if the last sweep is old enough.
+// m.mu must be held. A non-positive expire means the key never expires.
+func (m *Memory) set(key, value string, expire time.Duration, now time.Time) {
+	item := memoryItem{value: value}
+	if expire > 0 {
+		item.expiresAt = now.Add(expire)
+	}
+	m.items[key] = item
+
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		m.lastSweep = now
+		for key, item := range m.items {
+			if item.expired(now) {
+				delete(m.items, key)
+			}
+		}
+	}
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
@@ -0,0 +1,68 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryValue struct {
+	err error
+}
+
+func (v binaryValue) MarshalBinary() ([]byte, error) {
+	return []byte("binary"), v.err
+}
+
+func TestMemory_Values(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	for value, want := range map[any]string{
+		nil:                          "",
+		uint8(8):                     "8",
+		1.5:                          "1.5",
+		true:                         "1",
+		false:                        "0",
+		time.Second:                  "1000000000",
+		binaryValue{}:                "binary",
+		float32(0.25):                "0.25",
+		int64(-1):                    "-1",
+		"string":                     "string",
+		time.Unix(0, 0).UTC():        "1970-01-01T00:00:00Z",
+		uint64(18446744073709551615): "18446744073709551615",
+	} {
+		assert.Nil(t, m.SetEX(ctx, "key", value, time.Minute))
+		val, err := m.Get(ctx, "key")
+		assert.Nil(t, err)
+		assert.Equal(t, want, val, "%T", value)
+	}
+
+	errMarshal := errors.New("marshal")
+	assert.ErrorIs(t, m.SetEX(ctx, "key", binaryValue{err: errMarshal}, time.Minute), errMarshal)
+	assert.NotNil(t, m.SetEX(ctx, "key", struct{}{}, time.Minute))
+	_, err := m.SetNX(ctx, "key", struct{}{}, time.Minute)
+	assert.NotNil(t, err)
+
+	// A failed conversion writes nothing.
+	assert.NotNil(t, m.MSet(ctx, map[string]any{"key1": "value1", "key2": struct{}{}}, time.Minute))
+	_, err = m.Get(ctx, "key1")
+	assert.Equal(t, m.Nil(), err)
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	assert.Nil(t, m.SetEX(ctx, "expired", "value", time.Nanosecond))
+	assert.Nil(t, m.SetEX(ctx, "key", "value", 0))
+	time.Sleep(time.Millisecond)
+
+	m.lastSweep = time.Now().Add(-memorySweepInterval)
+	assert.Nil(t, m.SetEX(ctx, "other", "value", time.Minute))
+	assert.Equal(t, 2, len(m.items))
+	assert.NotContains(t, m.items, "expired")
+}
@@ -2,6 +2,10 @@ package remote
 
 import (
 	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 )
 
@@ -30,3 +34,214 @@ type Remote interface {
 	// Nil returns an error indicating that the key does not exist.
 	Nil() error
 }
+
+// Entry is a value written by MSetEntries with its own expiration.
+type Entry struct {
+	Value  any
+	Expire time.Duration
+}
+
+// EntriesSetter is implemented by a Remote that can write a batch of values with a
+// TTL per key, so that values written together do not expire together. A Remote
+// without it costs one MSet round trip per distinct whole-second expiration, run one
+// after another, e.g. up to 10 round trips per batch with a 10s WithRemoteOffset.
+type EntriesSetter interface {
+	// MSetEntries sets multiple key-value pairs, each with its own expiration.
+	MSetEntries(ctx context.Context, entries map[string]Entry) error
+}
+
+// MSetEntries writes entries with r.MSetEntries if r implements EntriesSetter.
+// Otherwise, it groups the entries by expiration rounded to whole seconds, and calls
+// r.MSet once per group.
+func MSetEntries(ctx context.Context, r Remote, entries map[string]Entry) error {
+	if setter, ok := r.(EntriesSetter); ok {
+		return setter.MSetEntries(ctx, entries)
+	}
+
+	groups := make(map[time.Duration]map[string]any)
+	for key, entry := range entries {
+		expire := entry.Expire.Round(time.Second)
+		if expire == 0 && entry.Expire > 0 {
+			expire = time.Second
+		}
+		group, ok := groups[expire]
+		if !ok {
+			group = make(map[string]any)
+			groups[expire] = group
+		}
+		group[key] = entry.Value
+	}
+
+	var errs error
+	for expire, group := range groups {
+		errs = errors.Join(errs, r.MSet(ctx, group, expire))
+	}
+	return errs
+}
+
+// TTLKeeper is implemented by a Remote that can overwrite a value without changing
+// its expiration.
+type TTLKeeper interface {
+	// SetXXKeepTTL sets the value of a key if it already exists, keeping its TTL.
+	SetXXKeepTTL(ctx context.Context, key string, value any) (val bool, err error)
+}
+
+// ErrKeepTTLUnsupported is returned by SetXXKeepTTL for a Remote without TTLKeeper.
+var ErrKeepTTLUnsupported = errors.New("remote: keeping the TTL is not supported")
+
+// SetXXKeepTTL writes value with r.SetXXKeepTTL if r implements TTLKeeper, or returns
+// ErrKeepTTLUnsupported.
+func SetXXKeepTTL(ctx context.Context, r Remote, key string, value any) (bool, error) {
+	if keeper, ok := r.(TTLKeeper); ok {
+		return keeper.SetXXKeepTTL(ctx, key, value)
+	}
+	return false, ErrKeepTTLUnsupported
+}
+
+// HashRemote is implemented by a Remote that can store values as fields of hashes,
+// which costs far less memory than a key per value for small values.
+type HashRemote interface {
+	// HMGet retrieves fields of hashes, by hash key. Missing fields are omitted.
+	HMGet(ctx context.Context, fields map[string][]string) (map[string]map[string]any, error)
+
+	// HSet sets fields of hashes, each with its own expiration. Where fields can not
+	// expire on their own, HMGet must still omit the fields past their expiration.
+	HSet(ctx context.Context, values map[string]map[string]Entry) error
+
+	// HDel deletes fields of a hash.
+	HDel(ctx context.Context, key string, fields ...string) (val int64, err error)
+}
+
+// ErrHashUnsupported is returned by the HashRemote methods of a Remote wrapping
+// remotes that are not HashRemotes, such as a Hedged or a Sharded.
+var ErrHashUnsupported = errors.New("remote: hash storage is not supported")
+
+// hashWrapper is implemented by a HashRemote that forwards the hash calls to the
+// remotes it wraps, and so supports them only if they do.
+type hashWrapper interface {
+	supportsHash() bool
+}
+
+// SupportsHash reports whether values can be stored in hashes of r: r implements
+// HashRemote and, if it wraps other remotes, so do they.
+func SupportsHash(r Remote) bool {
+	if _, ok := r.(HashRemote); !ok {
+		return false
+	}
+	if w, ok := r.(hashWrapper); ok {
+		return w.supportsHash()
+	}
+	return true
+}
+
+// asHashRemote returns r as a HashRemote, or ErrHashUnsupported.
+func asHashRemote(r Remote) (HashRemote, error) {
+	if hash, ok := r.(HashRemote); ok && SupportsHash(r) {
+		return hash, nil
+	}
+	return nil, ErrHashUnsupported
+}
+
+// BatchError is returned by MGet and MSet when some of the batches they are split
+// into fail. The values of the other batches are still returned or written.
+type BatchError struct {
+	// Keys are the keys of the failed batches.
+	Keys []string
+	// Errs are the errors of the failed batches.
+	Errs []error
+}
+
+func newBatchError(keys []string, err error) *BatchError {
+	return (*BatchError)(nil).add(keys, err)
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("remote: %d keys failed: %v", len(e.Keys), errors.Join(e.Errs...))
+}
+
+func (e *BatchError) Unwrap() []error {
+	return e.Errs
+}
+
+// add records a failed batch, allocating e if it is nil.
+func (e *BatchError) add(keys []string, err error) *BatchError {
+	if e == nil {
+		e = &BatchError{}
+	}
+	e.Keys = append(e.Keys, keys...)
+	e.Errs = append(e.Errs, err)
+	return e
+}
+
+// joinBatchErrors returns the errors of a and b, merged into one *BatchError when
+// both are one.
+func joinBatchErrors(a, b error) error {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	var ae, be *BatchError
+	if errors.As(a, &ae) && errors.As(b, &be) {
+		return &BatchError{
+			Keys: append(append([]string(nil), ae.Keys...), be.Keys...),
+			Errs: append(append([]error(nil), ae.Errs...), be.Errs...),
+		}
+	}
+	return errors.Join(a, b)
+}
+
+// valueString converts value to the string Redis would store, following go-redis.
+func valueString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.FormatInt(v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("remote: can't marshal %T (implement encoding.BinaryMarshaler)", value)
+	}
+}
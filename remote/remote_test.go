@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMSetEntries(t *testing.T) {
+	rdb := newRdb()
+	entries := map[string]Entry{
+		"key1": {Value: "value1", Expire: time.Minute},
+		"key2": {Value: "value2", Expire: time.Hour},
+		"key3": {Value: "value3", Expire: time.Hour},
+	}
+
+	for name, r := range map[string]Remote{
+		"EntriesSetter": NewGoRedisV9Adapter(rdb),
+		"fallback":      struct{ Remote }{NewGoRedisV9Adapter(rdb)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, rdb.FlushAll(context.Background()).Err())
+			assert.Nil(t, MSetEntries(context.Background(), r, entries))
+
+			for key, entry := range entries {
+				val, err := r.Get(context.Background(), key)
+				assert.Nil(t, err)
+				assert.Equal(t, entry.Value, val)
+				assert.Equal(t, entry.Expire, rdb.TTL(context.Background(), key).Val())
+			}
+		})
+	}
+}
+
+// countingRemote counts the calls of MSet.
+type countingRemote struct {
+	Remote
+	msets int
+}
+
+func (r *countingRemote) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+	r.msets++
+	return r.Remote.MSet(ctx, value, expire)
+}
+
+func TestMSetEntries_Jitter(t *testing.T) {
+	rdb := newRdb()
+	r := &countingRemote{Remote: NewGoRedisV9Adapter(rdb)}
+	entries := make(map[string]Entry)
+	for i := 0; i < 100; i++ {
+		entries[fmt.Sprintf("key%d", i)] = Entry{Value: "value", Expire: time.Minute + time.Duration(i)*10*time.Millisecond}
+	}
+
+	assert.Nil(t, MSetEntries(context.Background(), r, entries))
+	assert.Equal(t, 2, r.msets)
+	assert.Equal(t, time.Minute+time.Second, rdb.TTL(context.Background(), "key99").Val())
+}
+
+func TestJoinBatchErrors(t *testing.T) {
+	replicaErr := newBatchError([]string{"key1"}, errors.New("replica"))
+	primaryErr := newBatchError([]string{"key2"}, errors.New("primary"))
+
+	assert.Nil(t, joinBatchErrors(nil, nil))
+	assert.Equal(t, replicaErr, joinBatchErrors(replicaErr, nil))
+	assert.Equal(t, primaryErr, joinBatchErrors(nil, primaryErr))
+
+	var batchErr *BatchError
+	err := joinBatchErrors(replicaErr, primaryErr)
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []string{"key1", "key2"}, batchErr.Keys)
+	assert.Equal(t, []string{"key1"}, replicaErr.Keys)
+
+	other := errors.New("other")
+	err = joinBatchErrors(replicaErr, other)
+	assert.ErrorIs(t, err, other)
+	assert.ErrorAs(t, err, &batchErr)
+}
@@ -0,0 +1,253 @@
+// Package remotetest provides a conformance suite for remote.Remote implementations.
+//
+// An adapter proves it honors the remote.Remote contract by running the suite from
+// its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		remotetest.Run(t, func(t *testing.T) (remote.Remote, func(time.Duration)) {
+//			return myadapter.New(...), nil
+//		})
+//	}
+package remotetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+)
+
+// ttl is the shortest expiration the suite uses. Redis stores SETEX expirations
+// in seconds, so it can not be shorter.
+const ttl = time.Second
+
+// Factory returns an empty Remote for every test of the suite, and a function that
+// moves the clock of the Remote forward by d. The function may be nil, in which case
+// the suite sleeps for d. Remotes whose clock does not pass on its own, such as
+// miniredis, must return it.
+type Factory func(t *testing.T) (r remote.Remote, fastForward func(d time.Duration))
+
+// Run runs the conformance suite against the remotes returned by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r remote.Remote, fastForward func(time.Duration))
+	}{
+		{"SetEXAndGet", testSetEXAndGet},
+		{"GetMissing", testGetMissing},
+		{"Expire", testExpire},
+		{"SetNX", testSetNX},
+		{"SetXX", testSetXX},
+		{"SetXXKeepTTL", testSetXXKeepTTL},
+		{"Del", testDel},
+		{"MGet", testMGet},
+		{"MSet", testMSet},
+		{"MSetEntries", testMSetEntries},
+		{"Values", testValues},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fastForward := factory(t)
+			if fastForward == nil {
+				fastForward = time.Sleep
+			}
+			tt.fn(t, r, fastForward)
+		})
+	}
+}
+
+func testSetEXAndGet(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value1", time.Minute))
+	val, err := r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value2", time.Minute))
+	val, err = r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+}
+
+func testGetMissing(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	_, err := r.Get(context.Background(), "missing")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, r.Nil()), "Get of a missing key must return Nil(), got %v", err)
+}
+
+func testExpire(t *testing.T, r remote.Remote, fastForward func(time.Duration)) {
+	ctx := context.Background()
+
+	require.NoError(t, r.SetEX(ctx, "short", "value", ttl))
+	require.NoError(t, r.SetEX(ctx, "long", "value", time.Minute))
+	ok, err := r.SetNX(ctx, "nx", "value", ttl)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	fastForward(ttl + 100*time.Millisecond)
+
+	for _, key := range []string{"short", "nx"} {
+		_, err = r.Get(ctx, key)
+		assert.True(t, errors.Is(err, r.Nil()), "%s must be expired, got %v", key, err)
+	}
+	val, err := r.Get(ctx, "long")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	// An expired key does not exist for SetNX and SetXX.
+	ok, err = r.SetXX(ctx, "short", "value", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = r.SetNX(ctx, "short", "value", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func testSetNX(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	ok, err := r.SetNX(ctx, "key1", "value1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = r.SetNX(ctx, "key1", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	val, err := r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", val)
+}
+
+func testSetXX(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	ok, err := r.SetXX(ctx, "key1", "value1", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, err = r.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, r.Nil()), "SetXX must not create a key, got %v", err)
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value1", time.Minute))
+	ok, err = r.SetXX(ctx, "key1", "value2", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	val, err := r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+}
+
+func testSetXXKeepTTL(t *testing.T, r remote.Remote, fastForward func(time.Duration)) {
+	ctx := context.Background()
+
+	ok, err := remote.SetXXKeepTTL(ctx, r, "key1", "value1")
+	if errors.Is(err, remote.ErrKeepTTLUnsupported) {
+		t.Skip("the remote does not keep TTLs")
+	}
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value1", ttl))
+	ok, err = remote.SetXXKeepTTL(ctx, r, "key1", "value2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	val, err := r.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "value2", val)
+
+	fastForward(ttl + 100*time.Millisecond)
+	_, err = r.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, r.Nil()), "SetXXKeepTTL must keep the TTL, got %v", err)
+}
+
+func testDel(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value1", time.Minute))
+	n, err := r.Del(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = r.Get(ctx, "key1")
+	assert.True(t, errors.Is(err, r.Nil()), "Get of a deleted key must return Nil(), got %v", err)
+
+	n, err = r.Del(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func testMGet(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	ret, err := r.MGet(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, ret)
+
+	require.NoError(t, r.SetEX(ctx, "key1", "value1", time.Minute))
+	require.NoError(t, r.SetEX(ctx, "key2", "value2", time.Minute))
+
+	ret, err = r.MGet(ctx, "key1", "key2", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "value1", "key2": "value2"}, ret)
+}
+
+func testMSet(t *testing.T, r remote.Remote, fastForward func(time.Duration)) {
+	ctx := context.Background()
+
+	require.NoError(t, r.MSet(ctx, map[string]any{}, ttl))
+	require.NoError(t, r.MSet(ctx, map[string]any{"key1": "value1", "key2": []byte("value2"), "key3": 3}, ttl))
+
+	ret, err := r.MGet(ctx, "key1", "key2", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "value1", "key2": "value2", "key3": "3"}, ret)
+
+	fastForward(ttl + 100*time.Millisecond)
+
+	ret, err = r.MGet(ctx, "key1", "key2", "key3")
+	require.NoError(t, err)
+	assert.Empty(t, ret)
+}
+
+func testMSetEntries(t *testing.T, r remote.Remote, fastForward func(time.Duration)) {
+	ctx := context.Background()
+
+	err := remote.MSetEntries(ctx, r, map[string]remote.Entry{
+		"short": {Value: "value1", Expire: ttl},
+		"long":  {Value: "value2", Expire: time.Minute},
+	})
+	require.NoError(t, err)
+
+	fastForward(ttl + 100*time.Millisecond)
+
+	ret, err := r.MGet(ctx, "short", "long")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"long": "value2"}, ret)
+}
+
+func testValues(t *testing.T, r remote.Remote, _ func(time.Duration)) {
+	ctx := context.Background()
+
+	// Encoded values are arbitrary bytes.
+	binary := string([]byte{0, 1, 2, 0xff, '\r', '\n', 0})
+	require.NoError(t, r.SetEX(ctx, "binary", []byte(binary), time.Minute))
+	val, err := r.Get(ctx, "binary")
+	require.NoError(t, err)
+	assert.Equal(t, binary, val)
+
+	ret, err := r.MGet(ctx, "binary")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"binary": binary}, ret)
+
+	require.NoError(t, r.SetEX(ctx, "int", 42, time.Minute))
+	val, err = r.Get(ctx, "int")
+	require.NoError(t, err)
+	assert.Equal(t, "42", val)
+}
@@ -0,0 +1,450 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const defaultVirtualNodes = 160
+
+var (
+	_ Remote        = (*Sharded)(nil)
+	_ EntriesSetter = (*Sharded)(nil)
+	_ TTLKeeper     = (*Sharded)(nil)
+	_ HashRemote    = (*Sharded)(nil)
+
+	errShardedNil = errors.New("remote: key does not exist")
+	errNoShards   = errors.New("remote: sharded has no shards")
+)
+
+type (
+	// Sharded is a Remote spreading keys over several independent backends with a
+	// consistent hashing ring, so that adding or removing a backend only moves the
+	// keys it gains or loses.
+	Sharded struct {
+		mu           sync.Mutex // serializes ring changes.
+		ring         atomic.Pointer[shardRing]
+		virtualNodes int
+		onRebalance  func(old, new []string)
+	}
+
+	// Shard is a backend of a Sharded. A shard with Weight 2 gets twice the keys of a
+	// shard with Weight 1. A Weight <= 0 counts as 1.
+	Shard struct {
+		Name   string
+		Remote Remote
+		Weight int
+	}
+
+	// ShardedOption defines the method to customize a Sharded.
+	ShardedOption func(o *Sharded)
+
+	// shardRing is an immutable hash ring.
+	shardRing struct {
+		shards []Shard
+		points []uint64
+		owners []int // owners[i] is the index in shards of the owner of points[i].
+	}
+)
+
+// WithShardedVirtualNodes sets the number of points each unit of weight puts on the
+// ring. More points spread keys more evenly. Default is 160.
+func WithShardedVirtualNodes(virtualNodes int) ShardedOption {
+	return func(o *Sharded) {
+		o.virtualNodes = virtualNodes
+	}
+}
+
+// WithShardedOnRebalance sets a callback run, with the shard names before and after,
+// every time AddShard or RemoveShard changes the ring.
+func WithShardedOnRebalance(fn func(old, new []string)) ShardedOption {
+	return func(o *Sharded) {
+		o.onRebalance = fn
+	}
+}
+
+// NewSharded creates a Remote spreading keys over shards. Shard names must be unique,
+// as they place the shards on the ring: a shard keeps its keys across restarts as
+// long as its name does not change.
+func NewSharded(shards []Shard, opts ...ShardedOption) *Sharded {
+	s := &Sharded{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.virtualNodes <= 0 {
+		s.virtualNodes = defaultVirtualNodes
+	}
+	s.ring.Store(s.newRing(shards))
+
+	return s
+}
+
+// AddShard adds a shard to the ring, or replaces the shard of the same name.
+func (s *Sharded) AddShard(shard Shard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.ring.Load()
+	shards := make([]Shard, 0, len(old.shards)+1)
+	for _, sh := range old.shards {
+		if sh.Name != shard.Name {
+			shards = append(shards, sh)
+		}
+	}
+	s.rebalance(old, append(shards, shard))
+}
+
+// RemoveShard removes the shard of the given name from the ring.
+func (s *Sharded) RemoveShard(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.ring.Load()
+	shards := make([]Shard, 0, len(old.shards))
+	for _, sh := range old.shards {
+		if sh.Name != name {
+			shards = append(shards, sh)
+		}
+	}
+	if len(shards) == len(old.shards) {
+		return
+	}
+	s.rebalance(old, shards)
+}
+
+// ShardFor returns the name of the shard owning key, or "" if there is no shard.
+func (s *Sharded) ShardFor(key string) string {
+	if shard, ok := s.ring.Load().lookup(key); ok {
+		return shard.Name
+	}
+	return ""
+}
+
+func (s *Sharded) SetEX(ctx context.Context, key string, value any, expire time.Duration) error {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return errNoShards
+	}
+	return shard.Remote.SetEX(ctx, key, value, expire)
+}
+
+func (s *Sharded) SetNX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return false, errNoShards
+	}
+	return shard.Remote.SetNX(ctx, key, value, expire)
+}
+
+func (s *Sharded) SetXX(ctx context.Context, key string, value any, expire time.Duration) (val bool, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return false, errNoShards
+	}
+	return shard.Remote.SetXX(ctx, key, value, expire)
+}
+
+func (s *Sharded) SetXXKeepTTL(ctx context.Context, key string, value any) (val bool, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return false, errNoShards
+	}
+	return SetXXKeepTTL(ctx, shard.Remote, key, value)
+}
+
+// Get returns Nil() for a missing key, whatever the Nil() of the backend is.
+func (s *Sharded) Get(ctx context.Context, key string) (val string, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return "", errNoShards
+	}
+	val, err = shard.Remote.Get(ctx, key)
+	if err != nil && errors.Is(err, shard.Remote.Nil()) {
+		return "", errShardedNil
+	}
+	return
+}
+
+func (s *Sharded) Del(ctx context.Context, key string) (val int64, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return 0, errNoShards
+	}
+	return shard.Remote.Del(ctx, key)
+}
+
+// MGet splits keys by shard and fetches the shards in parallel. If some shards fail,
+// it returns the values of the others along with a *BatchError.
+func (s *Sharded) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	var (
+		mu  sync.Mutex
+		ret = make(map[string]any, len(keys))
+	)
+	ring := s.ring.Load()
+	if len(keys) > 0 && len(ring.shards) == 0 {
+		return ret, errNoShards
+	}
+
+	groups := make(map[*Shard][]string)
+	for _, key := range keys {
+		shard, _ := ring.lookup(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	err := runShards(groups, func(shard *Shard, keys []string) error {
+		vals, err := shard.Remote.MGet(ctx, keys...)
+		mu.Lock()
+		for key, val := range vals {
+			ret[key] = val
+		}
+		mu.Unlock()
+		return err
+	})
+
+	return ret, err
+}
+
+func (s *Sharded) MSet(ctx context.Context, value map[string]any, expire time.Duration) error {
+	entries := make(map[string]Entry, len(value))
+	for key, val := range value {
+		entries[key] = Entry{Value: val, Expire: expire}
+	}
+
+	return s.MSetEntries(ctx, entries)
+}
+
+// MSetEntries splits entries by shard and writes the shards in parallel. If some
+// shards fail, the others are still written and a *BatchError is returned.
+func (s *Sharded) MSetEntries(ctx context.Context, entries map[string]Entry) error {
+	ring := s.ring.Load()
+	if len(entries) > 0 && len(ring.shards) == 0 {
+		return errNoShards
+	}
+
+	groups := make(map[*Shard][]string)
+	for key := range entries {
+		shard, _ := ring.lookup(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	return runShards(groups, func(shard *Shard, keys []string) error {
+		shardEntries := make(map[string]Entry, len(keys))
+		for _, key := range keys {
+			shardEntries[key] = entries[key]
+		}
+		return MSetEntries(ctx, shard.Remote, shardEntries)
+	})
+}
+
+// HMGet splits the hashes by shard, like MGet. A shard that is not a HashRemote
+// fails its hashes with ErrHashUnsupported.
+func (s *Sharded) HMGet(ctx context.Context, fields map[string][]string) (map[string]map[string]any, error) {
+	var (
+		mu  sync.Mutex
+		ret = make(map[string]map[string]any, len(fields))
+	)
+	ring := s.ring.Load()
+	if len(fields) > 0 && len(ring.shards) == 0 {
+		return ret, errNoShards
+	}
+
+	groups := make(map[*Shard][]string)
+	for key := range fields {
+		shard, _ := ring.lookup(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	err := runShards(groups, func(shard *Shard, keys []string) error {
+		hash, err := asHashRemote(shard.Remote)
+		if err != nil {
+			return err
+		}
+		shardFields := make(map[string][]string, len(keys))
+		for _, key := range keys {
+			shardFields[key] = fields[key]
+		}
+		vals, err := hash.HMGet(ctx, shardFields)
+		mu.Lock()
+		for key, val := range vals {
+			ret[key] = val
+		}
+		mu.Unlock()
+		return err
+	})
+
+	return ret, err
+}
+
+// HSet splits the hashes by shard, like MSetEntries.
+func (s *Sharded) HSet(ctx context.Context, values map[string]map[string]Entry) error {
+	ring := s.ring.Load()
+	if len(values) > 0 && len(ring.shards) == 0 {
+		return errNoShards
+	}
+
+	groups := make(map[*Shard][]string)
+	for key := range values {
+		shard, _ := ring.lookup(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	return runShards(groups, func(shard *Shard, keys []string) error {
+		hash, err := asHashRemote(shard.Remote)
+		if err != nil {
+			return err
+		}
+		shardValues := make(map[string]map[string]Entry, len(keys))
+		for _, key := range keys {
+			shardValues[key] = values[key]
+		}
+		return hash.HSet(ctx, shardValues)
+	})
+}
+
+func (s *Sharded) HDel(ctx context.Context, key string, fields ...string) (val int64, err error) {
+	shard, ok := s.ring.Load().lookup(key)
+	if !ok {
+		return 0, errNoShards
+	}
+	hash, err := asHashRemote(shard.Remote)
+	if err != nil {
+		return 0, err
+	}
+	return hash.HDel(ctx, key, fields...)
+}
+
+// supportsHash reports whether every shard is a HashRemote. Shards added later
+// are not checked.
+func (s *Sharded) supportsHash() bool {
+	for _, shard := range s.ring.Load().shards {
+		if !SupportsHash(shard.Remote) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Sharded) Nil() error {
+	return errShardedNil
+}
+
+// rebalance swaps the ring for one of shards and runs the rebalance callback. s.mu
+// must be held.
+func (s *Sharded) rebalance(old *shardRing, shards []Shard) {
+	ring := s.newRing(shards)
+	s.ring.Store(ring)
+
+	if s.onRebalance != nil {
+		util.WithRecover(func() {
+			s.onRebalance(old.names(), ring.names())
+		})
+	}
+}
+
+func (s *Sharded) newRing(shards []Shard) *shardRing {
+	ring := &shardRing{shards: append([]Shard(nil), shards...)}
+	for i, shard := range ring.shards {
+		weight := shard.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		for v := 0; v < weight*s.virtualNodes; v++ {
+			ring.points = append(ring.points, ringHash(shard.Name+"#"+strconv.Itoa(v)))
+			ring.owners = append(ring.owners, i)
+		}
+	}
+	sort.Sort(ring)
+
+	return ring
+}
+
+// lookup returns the shard owning key: the owner of the first point at or after the
+// hash of key, wrapping around.
+func (r *shardRing) lookup(key string) (*Shard, bool) {
+	if len(r.points) == 0 {
+		return nil, false
+	}
+
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return &r.shards[r.owners[i]], true
+}
+
+func (r *shardRing) names() []string {
+	names := make([]string, 0, len(r.shards))
+	for _, shard := range r.shards {
+		names = append(names, shard.Name)
+	}
+	return names
+}
+
+func (r *shardRing) Len() int           { return len(r.points) }
+func (r *shardRing) Less(i, j int) bool { return r.points[i] < r.points[j] }
+func (r *shardRing) Swap(i, j int) {
+	r.points[i], r.points[j] = r.points[j], r.points[i]
+	r.owners[i], r.owners[j] = r.owners[j], r.owners[i]
+}
+
+// runShards runs fn for every shard in parallel, and collects the failed keys.
+func runShards(groups map[*Shard][]string, fn func(shard *Shard, keys []string) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		batchErr *BatchError
+	)
+	for shard, keys := range groups {
+		wg.Add(1)
+		go func(shard *Shard, keys []string) {
+			defer wg.Done()
+
+			err := errBatchPanic
+			util.WithRecover(func() {
+				err = fn(shard, keys)
+			})
+			if err == nil {
+				return
+			}
+
+			// Only the failed keys of a backend reporting a *BatchError failed.
+			var shardErr *BatchError
+			if errors.As(err, &shardErr) {
+				keys = shardErr.Keys
+			}
+			mu.Lock()
+			batchErr = batchErr.add(keys, fmt.Errorf("shard %s: %w", shard.Name, err))
+			mu.Unlock()
+		}(shard, keys)
+	}
+	wg.Wait()
+
+	if batchErr != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// ringHash is FNV-1a followed by the splitmix64 finalizer, which spreads the similar
+// names of virtual nodes over the whole ring.
+func ringHash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,205 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/jetcache-go/remote"
+)
+
+// failingRemote is a Remote whose batch calls always fail.
+type failingRemote struct {
+	remote.Remote
+}
+
+var errFailing = errors.New("failing")
+
+func (failingRemote) MGet(context.Context, ...string) (map[string]any, error) {
+	return nil, errFailing
+}
+
+func (failingRemote) MSet(context.Context, map[string]any, time.Duration) error {
+	return errFailing
+}
+
+func TestSharded_Distribution(t *testing.T) {
+	s := remote.NewSharded([]remote.Shard{
+		{Name: "a", Remote: remote.NewMemory()},
+		{Name: "b", Remote: remote.NewMemory()},
+		{Name: "c", Remote: remote.NewMemory(), Weight: 2},
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 40000; i++ {
+		counts[s.ShardFor(fmt.Sprintf("key%d", i))]++
+	}
+	assert.InDelta(t, 10000, counts["a"], 1500)
+	assert.InDelta(t, 10000, counts["b"], 1500)
+	assert.InDelta(t, 20000, counts["c"], 1500)
+}
+
+func TestSharded_Rebalance(t *testing.T) {
+	var calls [][2][]string
+	s := remote.NewSharded([]remote.Shard{
+		{Name: "a", Remote: remote.NewMemory()},
+		{Name: "b", Remote: remote.NewMemory()},
+	}, remote.WithShardedVirtualNodes(100), remote.WithShardedOnRebalance(func(old, new []string) {
+		calls = append(calls, [2][]string{old, new})
+	}))
+
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = s.ShardFor(key)
+	}
+
+	// Only the keys taken by the new shard move.
+	s.AddShard(remote.Shard{Name: "c", Remote: remote.NewMemory()})
+	moved := 0
+	for key, shard := range before {
+		if now := s.ShardFor(key); now != shard {
+			assert.Equal(t, "c", now)
+			moved++
+		}
+	}
+	assert.InDelta(t, 3333, moved, 700)
+
+	// Removing it puts the keys back.
+	s.RemoveShard("c")
+	for key, shard := range before {
+		assert.Equal(t, shard, s.ShardFor(key))
+	}
+
+	// Removing an unknown shard does not change the ring.
+	s.RemoveShard("unknown")
+	assert.Equal(t, [][2][]string{
+		{{"a", "b"}, {"a", "b", "c"}},
+		{{"a", "b", "c"}, {"a", "b"}},
+	}, calls)
+
+	s.RemoveShard("a")
+	s.RemoveShard("b")
+	assert.Equal(t, "", s.ShardFor("key1"))
+	assert.NotNil(t, s.SetEX(context.Background(), "key1", "value1", time.Minute))
+}
+
+func TestSharded_Batches(t *testing.T) {
+	ctx := context.Background()
+	a, b := remote.NewMemory(), remote.NewMemory()
+	s := remote.NewSharded([]remote.Shard{{Name: "a", Remote: a}, {Name: "b", Remote: b}})
+
+	value := make(map[string]any)
+	keys := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value[key] = fmt.Sprintf("value%d", i)
+		keys = append(keys, key)
+	}
+	assert.Nil(t, s.MSet(ctx, value, time.Minute))
+
+	// Every key is on its own shard only.
+	for key, val := range value {
+		owner, other := a, b
+		if s.ShardFor(key) == "b" {
+			owner, other = b, a
+		}
+		got, err := owner.Get(ctx, key)
+		assert.Nil(t, err)
+		assert.Equal(t, val, got)
+		_, err = other.Get(ctx, key)
+		assert.ErrorIs(t, err, other.Nil())
+	}
+
+	ret, err := s.MGet(ctx, keys...)
+	assert.Nil(t, err)
+	assert.Equal(t, value, ret)
+
+	// A failing shard only fails its own keys.
+	s.AddShard(remote.Shard{Name: "b", Remote: failingRemote{b}})
+	var failed []string
+	for _, key := range keys {
+		if s.ShardFor(key) == "b" {
+			failed = append(failed, key)
+		}
+	}
+
+	ret, err = s.MGet(ctx, keys...)
+	var batchErr *remote.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.ErrorIs(t, err, errFailing)
+	assert.ElementsMatch(t, failed, batchErr.Keys)
+	assert.Len(t, ret, len(keys)-len(failed))
+
+	err = s.MSet(ctx, value, time.Minute)
+	assert.True(t, errors.As(err, &batchErr))
+	assert.ElementsMatch(t, failed, batchErr.Keys)
+}
+
+func TestSharded_NoShards(t *testing.T) {
+	ctx := context.Background()
+	s := remote.NewSharded(nil)
+
+	ret, err := s.MGet(ctx, "key")
+	assert.EqualError(t, err, "remote: sharded has no shards")
+	assert.Empty(t, ret)
+	err = s.MSet(ctx, map[string]any{"key": "value"}, time.Minute)
+	assert.EqualError(t, err, "remote: sharded has no shards")
+
+	// Nothing to fetch or write is not an error.
+	_, err = s.MGet(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.MSet(ctx, nil, time.Minute))
+}
+
+func TestSharded_Hash(t *testing.T) {
+	ctx := context.Background()
+	a, b := miniredis.RunT(t), miniredis.RunT(t)
+	s := remote.NewSharded([]remote.Shard{
+		{Name: "a", Remote: remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: a.Addr()}))},
+		{Name: "b", Remote: remote.NewGoRedisV9Adapter(redis.NewClient(&redis.Options{Addr: b.Addr()}))},
+	})
+	assert.True(t, remote.SupportsHash(s))
+
+	values := make(map[string]map[string]remote.Entry)
+	fields := make(map[string][]string)
+	want := make(map[string]map[string]any)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("hash%d", i)
+		values[key] = map[string]remote.Entry{"f1": {Value: "v" + key, Expire: time.Minute}}
+		fields[key] = []string{"f1", "f2"}
+		want[key] = map[string]any{"f1": "v" + key}
+	}
+	assert.Nil(t, s.HSet(ctx, values))
+	ret, err := s.HMGet(ctx, fields)
+	assert.Nil(t, err)
+	assert.Equal(t, want, ret)
+
+	// Every hash is on its own shard only.
+	for key := range values {
+		owner := a
+		if s.ShardFor(key) == "b" {
+			owner = b
+		}
+		assert.True(t, owner.Exists(key))
+	}
+
+	n, err := s.HDel(ctx, "hash1", "f1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// A shard without hashes fails its own hashes only.
+	s.AddShard(remote.Shard{Name: "b", Remote: remote.NewMemory()})
+	assert.False(t, remote.SupportsHash(s))
+	ret, err = s.HMGet(ctx, fields)
+	var batchErr *remote.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.ErrorIs(t, err, remote.ErrHashUnsupported)
+	assert.Len(t, ret, len(fields)-1-len(batchErr.Keys))
+}
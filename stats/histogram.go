@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the buckets of a Histogram. A last bucket
+// counts the durations above them.
+var LatencyBuckets = [...]time.Duration{
+	time.Microsecond, 2500 * time.Nanosecond, 5 * time.Microsecond,
+	10 * time.Microsecond, 25 * time.Microsecond, 50 * time.Microsecond,
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+type (
+	// Histogram counts durations in the LatencyBuckets. It is safe for concurrent use.
+	Histogram struct {
+		counts [len(LatencyBuckets) + 1]uint64
+		sum    uint64
+	}
+
+	// HistogramSnapshot is a point-in-time copy of a Histogram.
+	HistogramSnapshot struct {
+		// Counts are the counts per bucket, not cumulative.
+		Counts [len(LatencyBuckets) + 1]uint64
+		Count  uint64
+		Sum    time.Duration
+	}
+)
+
+// Observe records a duration.
+func (h *Histogram) Observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.counts[bucketOf(d)], 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+}
+
+// Snapshot returns the current counts of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	var s HistogramSnapshot
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+	s.Sum = time.Duration(atomic.LoadUint64(&h.sum))
+	return s
+}
+
+// swap returns the current counts of the histogram and resets it.
+func (h *Histogram) swap() HistogramSnapshot {
+	var s HistogramSnapshot
+	for i := range h.counts {
+		s.Counts[i] = atomic.SwapUint64(&h.counts[i], 0)
+		s.Count += s.Counts[i]
+	}
+	s.Sum = time.Duration(atomic.SwapUint64(&h.sum, 0))
+	return s
+}
+
+// Quantile returns an estimate of the q-quantile, 0 <= q <= 1, interpolated within
+// its bucket. Durations above the last bucket are reported as its upper bound.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	rank := q * float64(s.Count)
+	var cum uint64
+	for i, n := range s.Counts {
+		if n == 0 || float64(cum+n) < rank {
+			cum += n
+			continue
+		}
+		if i == len(LatencyBuckets) {
+			break
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = LatencyBuckets[i-1]
+		}
+		frac := (rank - float64(cum)) / float64(n)
+		return lower + time.Duration(frac*float64(LatencyBuckets[i]-lower))
+	}
+	return LatencyBuckets[len(LatencyBuckets)-1]
+}
+
+// bucketOf returns the index of the bucket counting d.
+func bucketOf(d time.Duration) int {
+	for i, bound := range LatencyBuckets {
+		if d <= bound {
+			return i
+		}
+	}
+	return len(LatencyBuckets)
+}
@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	assert.Equal(t, time.Duration(0), h.Snapshot().Quantile(0.5))
+
+	for i := 0; i < 90; i++ {
+		h.Observe(800 * time.Nanosecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(3 * time.Millisecond)
+	}
+	h.Observe(-time.Second)
+
+	s := h.Snapshot()
+	assert.Equal(t, uint64(101), s.Count)
+	assert.Equal(t, uint64(91), s.Counts[0])
+	assert.Equal(t, 90*800*time.Nanosecond+30*time.Millisecond, s.Sum)
+	assert.LessOrEqual(t, s.Quantile(0.5), time.Microsecond)
+	assert.Greater(t, s.Quantile(0.99), 2500*time.Microsecond)
+	assert.LessOrEqual(t, s.Quantile(0.99), 5*time.Millisecond)
+
+	h.Observe(time.Minute)
+	assert.Equal(t, 10*time.Second, h.Snapshot().Quantile(1))
+
+	assert.Equal(t, uint64(102), h.swap().Count)
+	assert.Equal(t, uint64(0), h.Snapshot().Count)
+}
+
+func TestBucketOf(t *testing.T) {
+	assert.Equal(t, 0, bucketOf(0))
+	assert.Equal(t, 0, bucketOf(time.Microsecond))
+	assert.Equal(t, 1, bucketOf(time.Microsecond+1))
+	assert.Equal(t, 9, bucketOf(time.Millisecond))
+	assert.Equal(t, len(LatencyBuckets), bucketOf(time.Hour))
+}
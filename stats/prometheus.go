@@ -0,0 +1,345 @@
+package stats
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefaultExporter is the Exporter of the handlers created by NewPrometheus.
+	DefaultExporter = NewExporter()
+
+	_ Handler            = (*Prometheus)(nil)
+	_ EventHandler       = (*Prometheus)(nil)
+	_ CompressionHandler = (*Prometheus)(nil)
+	_ CorruptionHandler  = (*Prometheus)(nil)
+	_ HedgeHandler       = (*Prometheus)(nil)
+	_ ExtendedHandler    = (*Prometheus)(nil)
+	_ http.Handler       = (*Exporter)(nil)
+
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+type (
+	// Exporter is an http.Handler serving the stats of its caches in the Prometheus
+	// text exposition format, without a Prometheus client library. The metrics are:
+	//
+	//	jetcache_requests_total{cache,tier,result}         counter, tier all|local|remote, result hit|miss
+	//	jetcache_queries_total{cache}                      counter
+	//	jetcache_query_errors_total{cache,class}           counter, class timeout|canceled|network|other
+	//	jetcache_refreshes_total{cache,result}             counter, result success|fail
+	//	jetcache_shared_loads_total{cache}                 counter
+	//	jetcache_read_bytes_total{cache,tier}              counter, tier local|remote
+	//	jetcache_written_bytes_total{cache,tier}           counter, tier local|remote
+	//	jetcache_event_keys_total{cache,result}            counter, result coalesced|dropped
+	//	jetcache_compression_bytes_total{cache,stage}      counter, stage raw|stored
+	//	jetcache_corrupted_values_total{cache}             counter
+	//	jetcache_hedged_reads_total{cache,result}          counter, result hedged|won
+	//	jetcache_operation_duration_seconds{cache,tier,op} histogram, op get|set|del|load
+	//
+	// The names and labels are stable. A duration series is served once observed.
+	Exporter struct {
+		mu     sync.RWMutex
+		caches map[string]*Prometheus
+	}
+
+	// Prometheus is a Handler keeping the counters and histograms of a cache for an
+	// Exporter. The counters are never reset.
+	Prometheus struct {
+		name string
+
+		hit, miss             uint64
+		localHit, localMiss   uint64
+		remoteHit, remoteMiss uint64
+		query                 uint64
+		queryFail             [errorClassCount]uint64
+		refresh, refreshFail  uint64
+		shared                uint64
+		bytesRead             [tierCount]uint64
+		bytesWritten          [tierCount]uint64
+		eventDropped          uint64
+		eventCoalesced        uint64
+		compressRaw           uint64
+		compressStored        uint64
+		corrupted             uint64
+		hedges, hedgeWins     uint64
+		latency               [tierCount][opCount]Histogram
+	}
+
+	// sample is a value of a metric with its label pairs.
+	sample struct {
+		labels []string
+		value  float64
+	}
+)
+
+// NewExporter creates a new instance of Exporter.
+func NewExporter() *Exporter {
+	return &Exporter{caches: make(map[string]*Prometheus)}
+}
+
+// NewPrometheus returns the handler of the cache name in DefaultExporter.
+func NewPrometheus(name string) Handler {
+	return DefaultExporter.Handler(name)
+}
+
+// Handler returns the handler of the cache name, created on first use. Caches of
+// the same name share a handler.
+func (e *Exporter) Handler(name string) *Prometheus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.caches[name]
+	if !ok {
+		p = &Prometheus{name: name}
+		e.caches[name] = p
+	}
+	return p
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var b bytes.Buffer
+	e.write(&b)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	_, _ = w.Write(b.Bytes())
+}
+
+func (e *Exporter) write(b *bytes.Buffer) {
+	e.mu.RLock()
+	caches := make([]*Prometheus, 0, len(e.caches))
+	for _, p := range e.caches {
+		caches = append(caches, p)
+	}
+	e.mu.RUnlock()
+	sort.Slice(caches, func(i, j int) bool {
+		return caches[i].name < caches[j].name
+	})
+
+	writeCounter(b, "jetcache_requests_total", "Cache lookups by tier and result.", caches, func(p *Prometheus) []sample {
+		return []sample{
+			{[]string{"tier", "all", "result", "hit"}, load(&p.hit)},
+			{[]string{"tier", "all", "result", "miss"}, load(&p.miss)},
+			{[]string{"tier", "local", "result", "hit"}, load(&p.localHit)},
+			{[]string{"tier", "local", "result", "miss"}, load(&p.localMiss)},
+			{[]string{"tier", "remote", "result", "hit"}, load(&p.remoteHit)},
+			{[]string{"tier", "remote", "result", "miss"}, load(&p.remoteMiss)},
+		}
+	})
+	writeCounter(b, "jetcache_queries_total", "Loader queries on a cache miss.", caches, func(p *Prometheus) []sample {
+		return []sample{{nil, load(&p.query)}}
+	})
+	writeCounter(b, "jetcache_query_errors_total", "Failed loader queries by error class.", caches, func(p *Prometheus) []sample {
+		samples := make([]sample, 0, errorClassCount)
+		for c := ErrorClass(0); c < errorClassCount; c++ {
+			samples = append(samples, sample{[]string{"class", c.String()}, load(&p.queryFail[c])})
+		}
+		return samples
+	})
+	writeCounter(b, "jetcache_refreshes_total", "Refresh tasks by result.", caches, func(p *Prometheus) []sample {
+		return []sample{
+			{[]string{"result", "success"}, load(&p.refresh)},
+			{[]string{"result", "fail"}, load(&p.refreshFail)},
+		}
+	})
+	writeCounter(b, "jetcache_shared_loads_total", "Loads whose result was shared with concurrent callers.", caches, func(p *Prometheus) []sample {
+		return []sample{{nil, load(&p.shared)}}
+	})
+	writeCounter(b, "jetcache_read_bytes_total", "Bytes of the values read by tier.", caches, func(p *Prometheus) []sample {
+		return tierSamples(&p.bytesRead)
+	})
+	writeCounter(b, "jetcache_written_bytes_total", "Bytes of the values written by tier.", caches, func(p *Prometheus) []sample {
+		return tierSamples(&p.bytesWritten)
+	})
+	writeCounter(b, "jetcache_event_keys_total", "Keys of local sync events coalesced or dropped before delivery.", caches, func(p *Prometheus) []sample {
+		return []sample{
+			{[]string{"result", "coalesced"}, load(&p.eventCoalesced)},
+			{[]string{"result", "dropped"}, load(&p.eventDropped)},
+		}
+	})
+	writeCounter(b, "jetcache_compression_bytes_total", "Bytes of the values before and after compression.", caches, func(p *Prometheus) []sample {
+		return []sample{
+			{[]string{"stage", "raw"}, load(&p.compressRaw)},
+			{[]string{"stage", "stored"}, load(&p.compressStored)},
+		}
+	})
+	writeCounter(b, "jetcache_corrupted_values_total", "Cached values that failed to decode and were quarantined.", caches, func(p *Prometheus) []sample {
+		return []sample{{nil, load(&p.corrupted)}}
+	})
+	writeCounter(b, "jetcache_hedged_reads_total", "Remote reads sent a second time, and the hedges that answered first.", caches, func(p *Prometheus) []sample {
+		return []sample{
+			{[]string{"result", "hedged"}, load(&p.hedges)},
+			{[]string{"result", "won"}, load(&p.hedgeWins)},
+		}
+	})
+	writeDurations(b, caches)
+}
+
+func (p *Prometheus) IncrHit() {
+	atomic.AddUint64(&p.hit, 1)
+}
+
+func (p *Prometheus) IncrMiss() {
+	atomic.AddUint64(&p.miss, 1)
+}
+
+func (p *Prometheus) IncrLocalHit() {
+	atomic.AddUint64(&p.localHit, 1)
+}
+
+func (p *Prometheus) IncrLocalMiss() {
+	atomic.AddUint64(&p.localMiss, 1)
+}
+
+func (p *Prometheus) IncrRemoteHit() {
+	atomic.AddUint64(&p.remoteHit, 1)
+}
+
+func (p *Prometheus) IncrRemoteMiss() {
+	atomic.AddUint64(&p.remoteMiss, 1)
+}
+
+func (p *Prometheus) IncrQuery() {
+	atomic.AddUint64(&p.query, 1)
+}
+
+func (p *Prometheus) IncrQueryFail(err error) {
+	atomic.AddUint64(&p.queryFail[ClassifyError(err)], 1)
+}
+
+func (p *Prometheus) IncrEventDropped(n uint64) {
+	atomic.AddUint64(&p.eventDropped, n)
+}
+
+func (p *Prometheus) IncrEventCoalesced(n uint64) {
+	atomic.AddUint64(&p.eventCoalesced, n)
+}
+
+func (p *Prometheus) IncrCompression(raw, stored uint64) {
+	atomic.AddUint64(&p.compressRaw, raw)
+	atomic.AddUint64(&p.compressStored, stored)
+}
+
+func (p *Prometheus) IncrCorrupted() {
+	atomic.AddUint64(&p.corrupted, 1)
+}
+
+func (p *Prometheus) IncrHedge() {
+	atomic.AddUint64(&p.hedges, 1)
+}
+
+func (p *Prometheus) IncrHedgeWin() {
+	atomic.AddUint64(&p.hedgeWins, 1)
+}
+
+func (p *Prometheus) ObserveLatency(tier Tier, op Op, d time.Duration) {
+	if tier < tierCount && op < opCount {
+		p.latency[tier][op].Observe(d)
+	}
+}
+
+func (p *Prometheus) AddBytesRead(tier Tier, n uint64) {
+	if tier < tierCount {
+		atomic.AddUint64(&p.bytesRead[tier], n)
+	}
+}
+
+func (p *Prometheus) AddBytesWritten(tier Tier, n uint64) {
+	if tier < tierCount {
+		atomic.AddUint64(&p.bytesWritten[tier], n)
+	}
+}
+
+func (p *Prometheus) IncrRefresh() {
+	atomic.AddUint64(&p.refresh, 1)
+}
+
+func (p *Prometheus) IncrRefreshFail(err error) {
+	atomic.AddUint64(&p.refreshFail, 1)
+}
+
+func (p *Prometheus) IncrShared() {
+	atomic.AddUint64(&p.shared, 1)
+}
+
+// writeCounter writes a counter metric with the samples of each cache.
+func writeCounter(b *bytes.Buffer, name, help string, caches []*Prometheus, samples func(p *Prometheus) []sample) {
+	writeMetadata(b, name, help, "counter")
+	for _, p := range caches {
+		for _, s := range samples(p) {
+			writeSample(b, name, p.name, s.labels, s.value)
+		}
+	}
+}
+
+// writeDurations writes the histograms of the operations observed.
+func writeDurations(b *bytes.Buffer, caches []*Prometheus) {
+	const name = "jetcache_operation_duration_seconds"
+	writeMetadata(b, name, "Duration of the cache operations by tier and operation.", "histogram")
+	for _, p := range caches {
+		for tier := Tier(0); tier < tierCount; tier++ {
+			for op := Op(0); op < opCount; op++ {
+				snap := p.latency[tier][op].Snapshot()
+				if snap.Count == 0 {
+					continue
+				}
+
+				labels := []string{"tier", tier.String(), "op", op.String()}
+				var cum uint64
+				for i, bound := range LatencyBuckets {
+					cum += snap.Counts[i]
+					writeSample(b, name+"_bucket", p.name, append(labels, "le", formatFloat(bound.Seconds())), float64(cum))
+				}
+				writeSample(b, name+"_bucket", p.name, append(labels, "le", "+Inf"), float64(snap.Count))
+				writeSample(b, name+"_sum", p.name, labels, snap.Sum.Seconds())
+				writeSample(b, name+"_count", p.name, labels, float64(snap.Count))
+			}
+		}
+	}
+}
+
+func writeMetadata(b *bytes.Buffer, name, help, typ string) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// writeSample writes a sample line, labels being pairs of label names and values
+// after the cache label.
+func writeSample(b *bytes.Buffer, name, cache string, labels []string, value float64) {
+	b.WriteString(name)
+	b.WriteString(`{cache="`)
+	b.WriteString(labelReplacer.Replace(cache))
+	b.WriteByte('"')
+	for i := 0; i+1 < len(labels); i += 2 {
+		b.WriteString("," + labels[i] + `="`)
+		b.WriteString(labelReplacer.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteString("} ")
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+}
+
+// tierSamples returns the samples of the local and remote tiers of counts.
+func tierSamples(counts *[tierCount]uint64) []sample {
+	return []sample{
+		{[]string{"tier", TierLocal.String()}, load(&counts[TierLocal])},
+		{[]string{"tier", TierRemote.String()}, load(&counts[TierRemote])},
+	}
+}
+
+func load(n *uint64) float64 {
+	return float64(atomic.LoadUint64(n))
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
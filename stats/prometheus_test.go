@@ -0,0 +1,88 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, e *Exporter) string {
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, prometheusContentType, resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestExporter(t *testing.T) {
+	e := NewExporter()
+	h := NewHandles(false, e.Handler("order"))
+	h.IncrHit()
+	h.IncrLocalHit()
+	h.IncrMiss()
+	h.IncrRemoteMiss()
+	h.IncrQuery()
+	h.IncrQueryFail(context.DeadlineExceeded)
+	h.(ExtendedHandler).ObserveLatency(TierRemote, OpGet, 3*time.Millisecond)
+	h.(ExtendedHandler).AddBytesRead(TierRemote, 128)
+	h.(ExtendedHandler).IncrRefreshFail(errors.New("any"))
+	h.(CorruptionHandler).IncrCorrupted()
+	h.(HedgeHandler).IncrHedge()
+	e.Handler(`user"s`).IncrHit()
+	assert.Same(t, e.Handler("order"), e.Handler("order"))
+
+	body := scrape(t, e)
+	for _, line := range []string{
+		"# TYPE jetcache_requests_total counter",
+		`jetcache_requests_total{cache="order",tier="all",result="hit"} 1`,
+		`jetcache_requests_total{cache="order",tier="local",result="hit"} 1`,
+		`jetcache_requests_total{cache="order",tier="remote",result="miss"} 1`,
+		`jetcache_requests_total{cache="user\"s",tier="all",result="hit"} 1`,
+		`jetcache_queries_total{cache="order"} 1`,
+		`jetcache_query_errors_total{cache="order",class="timeout"} 1`,
+		`jetcache_query_errors_total{cache="order",class="other"} 0`,
+		`jetcache_refreshes_total{cache="order",result="fail"} 1`,
+		`jetcache_shared_loads_total{cache="order"} 0`,
+		`jetcache_read_bytes_total{cache="order",tier="remote"} 128`,
+		`jetcache_written_bytes_total{cache="order",tier="local"} 0`,
+		`jetcache_event_keys_total{cache="order",result="dropped"} 0`,
+		`jetcache_compression_bytes_total{cache="order",stage="raw"} 0`,
+		`jetcache_corrupted_values_total{cache="order"} 1`,
+		`jetcache_hedged_reads_total{cache="order",result="hedged"} 1`,
+		`jetcache_hedged_reads_total{cache="order",result="won"} 0`,
+		"# TYPE jetcache_operation_duration_seconds histogram",
+		`jetcache_operation_duration_seconds_bucket{cache="order",tier="remote",op="get",le="0.0025"} 0`,
+		`jetcache_operation_duration_seconds_bucket{cache="order",tier="remote",op="get",le="0.005"} 1`,
+		`jetcache_operation_duration_seconds_bucket{cache="order",tier="remote",op="get",le="+Inf"} 1`,
+		`jetcache_operation_duration_seconds_sum{cache="order",tier="remote",op="get"} 0.003`,
+		`jetcache_operation_duration_seconds_count{cache="order",tier="remote",op="get"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, `op="set"`)
+	assert.Less(t, strings.Index(body, `cache="order"`), strings.Index(body, `cache="user\"s"`))
+
+	// Counters are cumulative across scrapes.
+	h.IncrHit()
+	assert.Contains(t, scrape(t, e), `jetcache_requests_total{cache="order",tier="all",result="hit"} 2`+"\n")
+}
+
+func TestNewPrometheus(t *testing.T) {
+	h := NewPrometheus("default")
+	assert.Same(t, DefaultExporter.Handler("default"), h)
+}
@@ -1,5 +1,46 @@
 package stats
 
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Tier is the tier of the cache an operation runs on.
+type Tier uint8
+
+const (
+	TierLocal Tier = iota
+	TierRemote
+	// TierLoader is the function loading values on a miss, e.g. the Do of Once.
+	TierLoader
+	tierCount
+)
+
+// Op is the kind of an operation observed by an ExtendedHandler. Batch operations
+// are observed once per batch.
+type Op uint8
+
+const (
+	OpGet Op = iota
+	OpSet
+	OpDel
+	OpLoad
+	opCount
+)
+
+// ErrorClass is the class of an error passed to IncrQueryFail or IncrRefreshFail.
+type ErrorClass uint8
+
+const (
+	ErrorOther ErrorClass = iota
+	ErrorTimeout
+	ErrorCanceled
+	ErrorNetwork
+	errorClassCount
+)
+
 type (
 	// Handler defines the interface that the Transport uses to collect cache metrics.
 	// Note that implementations of this interface must be thread-safe; the methods of a Handler
@@ -15,6 +56,44 @@ type (
 		IncrQueryFail(err error)
 	}
 
+	// EventHandler is implemented by a Handler that also counts the keys of local
+	// sync events that were dropped, or coalesced with a pending key, before delivery.
+	EventHandler interface {
+		IncrEventDropped(n uint64)
+		IncrEventCoalesced(n uint64)
+	}
+
+	// CompressionHandler is implemented by a Handler that also counts the size of the
+	// values before and after compression.
+	CompressionHandler interface {
+		IncrCompression(raw, stored uint64)
+	}
+
+	// CorruptionHandler is implemented by a Handler that also counts the cached values
+	// that failed to decode, e.g. on a checksum mismatch, and were quarantined.
+	CorruptionHandler interface {
+		IncrCorrupted()
+	}
+
+	// HedgeHandler is implemented by a Handler that also counts the remote reads sent
+	// a second time by a remote.Hedged, and the hedges that answered first.
+	HedgeHandler interface {
+		IncrHedge()
+		IncrHedgeWin()
+	}
+
+	// ExtendedHandler is implemented by a Handler that also observes the latency of
+	// the operations per tier, the bytes read and written per tier, the outcome of
+	// the refresh tasks, and the loads shared by concurrent callers.
+	ExtendedHandler interface {
+		ObserveLatency(tier Tier, op Op, d time.Duration)
+		AddBytesRead(tier Tier, n uint64)
+		AddBytesWritten(tier Tier, n uint64)
+		IncrRefresh()
+		IncrRefreshFail(err error)
+		IncrShared()
+	}
+
 	Handlers struct {
 		disable  bool
 		handlers []Handler
@@ -108,3 +187,227 @@ func (hs *Handlers) IncrQueryFail(err error) {
 		h.IncrQueryFail(err)
 	}
 }
+
+func (hs *Handlers) IncrEventDropped(n uint64) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(EventHandler); ok {
+			eh.IncrEventDropped(n)
+		}
+	}
+}
+
+func (hs *Handlers) IncrEventCoalesced(n uint64) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(EventHandler); ok {
+			eh.IncrEventCoalesced(n)
+		}
+	}
+}
+
+func (hs *Handlers) IncrCompression(raw, stored uint64) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if ch, ok := h.(CompressionHandler); ok {
+			ch.IncrCompression(raw, stored)
+		}
+	}
+}
+
+func (hs *Handlers) IncrCorrupted() {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if ch, ok := h.(CorruptionHandler); ok {
+			ch.IncrCorrupted()
+		}
+	}
+}
+
+func (hs *Handlers) IncrHedge() {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if hh, ok := h.(HedgeHandler); ok {
+			hh.IncrHedge()
+		}
+	}
+}
+
+func (hs *Handlers) IncrHedgeWin() {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if hh, ok := h.(HedgeHandler); ok {
+			hh.IncrHedgeWin()
+		}
+	}
+}
+
+// Extended returns hs as an ExtendedHandler, or nil if hs is disabled or none of its
+// handlers is an ExtendedHandler.
+func (hs *Handlers) Extended() ExtendedHandler {
+	if hs.disable {
+		return nil
+	}
+
+	for _, h := range hs.handlers {
+		if nested, ok := h.(*Handlers); ok {
+			if nested.Extended() != nil {
+				return hs
+			}
+		} else if _, ok := h.(ExtendedHandler); ok {
+			return hs
+		}
+	}
+	return nil
+}
+
+func (hs *Handlers) ObserveLatency(tier Tier, op Op, d time.Duration) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.ObserveLatency(tier, op, d)
+		}
+	}
+}
+
+func (hs *Handlers) AddBytesRead(tier Tier, n uint64) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.AddBytesRead(tier, n)
+		}
+	}
+}
+
+func (hs *Handlers) AddBytesWritten(tier Tier, n uint64) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.AddBytesWritten(tier, n)
+		}
+	}
+}
+
+func (hs *Handlers) IncrRefresh() {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.IncrRefresh()
+		}
+	}
+}
+
+func (hs *Handlers) IncrRefreshFail(err error) {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.IncrRefreshFail(err)
+		}
+	}
+}
+
+func (hs *Handlers) IncrShared() {
+	if hs.disable {
+		return
+	}
+
+	for _, h := range hs.handlers {
+		if eh, ok := h.(ExtendedHandler); ok {
+			eh.IncrShared()
+		}
+	}
+}
+
+// ClassifyError returns the class of err: a timeout, a cancellation, another
+// network error, or any other error.
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorCanceled
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorNetwork
+	}
+	return ErrorOther
+}
+
+func (t Tier) String() string {
+	switch t {
+	case TierLocal:
+		return "local"
+	case TierRemote:
+		return "remote"
+	case TierLoader:
+		return "loader"
+	default:
+		return "unknown"
+	}
+}
+
+func (op Op) String() string {
+	switch op {
+	case OpGet:
+		return "get"
+	case OpSet:
+		return "set"
+	case OpDel:
+		return "del"
+	case OpLoad:
+		return "load"
+	default:
+		return "unknown"
+	}
+}
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorTimeout:
+		return "timeout"
+	case ErrorCanceled:
+		return "canceled"
+	case ErrorNetwork:
+		return "network"
+	default:
+		return "other"
+	}
+}
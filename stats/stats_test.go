@@ -1,9 +1,13 @@
 package stats
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -56,6 +60,88 @@ func TestNewHandles(t *testing.T) {
 	}
 }
 
+func TestHandlers_IncrCompression(t *testing.T) {
+	var s Stats
+	NewHandles(false, &testHandler{}, &s).(CompressionHandler).IncrCompression(100, 40)
+	assert.Equal(t, uint64(100), s.CompressRaw)
+	assert.Equal(t, uint64(40), s.CompressStored)
+
+	NewHandles(true, &s).(CompressionHandler).IncrCompression(100, 40)
+	assert.Equal(t, uint64(100), s.CompressRaw)
+}
+
+func TestHandlers_IncrCorrupted(t *testing.T) {
+	var s Stats
+	NewHandles(false, &testHandler{}, &s).(CorruptionHandler).IncrCorrupted()
+	assert.Equal(t, uint64(1), s.Corrupted)
+
+	NewHandles(true, &s).(CorruptionHandler).IncrCorrupted()
+	assert.Equal(t, uint64(1), s.Corrupted)
+}
+
+func TestHandlers_IncrHedge(t *testing.T) {
+	var s Stats
+	h := NewHandles(false, &testHandler{}, &s).(HedgeHandler)
+	h.IncrHedge()
+	h.IncrHedge()
+	h.IncrHedgeWin()
+	assert.Equal(t, uint64(2), s.Hedges)
+	assert.Equal(t, uint64(1), s.HedgeWins)
+
+	NewHandles(true, &s).(HedgeHandler).IncrHedge()
+	assert.Equal(t, uint64(2), s.Hedges)
+}
+
+func TestHandlers_ExtendedHandler(t *testing.T) {
+	var s Stats
+	h := NewHandles(false, &testHandler{}, &s).(ExtendedHandler)
+	h.ObserveLatency(TierRemote, OpGet, time.Millisecond)
+	h.AddBytesRead(TierLocal, 10)
+	h.AddBytesWritten(TierRemote, 20)
+	h.IncrRefresh()
+	h.IncrRefreshFail(errors.New("any"))
+	h.IncrShared()
+
+	assert.Equal(t, uint64(1), s.Latency(TierRemote, OpGet).Count)
+	assert.Equal(t, uint64(0), s.Latency(TierLocal, OpGet).Count)
+	assert.Equal(t, uint64(10), s.BytesRead[TierLocal])
+	assert.Equal(t, uint64(20), s.BytesWritten[TierRemote])
+	assert.Equal(t, uint64(1), s.Refresh)
+	assert.Equal(t, uint64(1), s.RefreshFail)
+	assert.Equal(t, uint64(1), s.Shared)
+
+	h = NewHandles(true, &s).(ExtendedHandler)
+	h.IncrShared()
+	assert.Equal(t, uint64(1), s.Shared)
+}
+
+func TestHandlers_Extended(t *testing.T) {
+	var s Stats
+	assert.NotNil(t, NewHandles(false, &testHandler{}, &s).(*Handlers).Extended())
+	assert.NotNil(t, NewHandles(false, NewHandles(false, &s)).(*Handlers).Extended())
+	assert.Nil(t, NewHandles(false, &testHandler{}).(*Handlers).Extended())
+	assert.Nil(t, NewHandles(false, NewHandles(false, &testHandler{})).(*Handlers).Extended())
+	assert.Nil(t, NewHandles(true, &s).(*Handlers).Extended())
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err    error
+		expect ErrorClass
+	}{
+		{errors.New("any"), ErrorOther},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ErrorTimeout},
+		{context.Canceled, ErrorCanceled},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorNetwork},
+		{&net.DNSError{IsTimeout: true}, ErrorTimeout},
+	}
+	for _, v := range tests {
+		assert.Equal(t, v.expect, ClassifyError(v.err), v.err.Error())
+	}
+	assert.Equal(t, "network", ErrorNetwork.String())
+	assert.Equal(t, "remote_get", fmt.Sprintf("%s_%s", TierRemote, OpGet))
+}
+
 func (h *testHandler) IncrHit() {
 	atomic.AddUint64(&h.Hit, 1)
 }
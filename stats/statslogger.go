@@ -17,7 +17,13 @@ const defaultStatsInterval = time.Minute
 var (
 	once  sync.Once
 	inner *innerStats
-	_     Handler = (*Stats)(nil)
+	_     Handler      = (*Stats)(nil)
+	_     EventHandler = (*Stats)(nil)
+
+	_ CompressionHandler = (*Stats)(nil)
+	_ CorruptionHandler  = (*Stats)(nil)
+	_ HedgeHandler       = (*Stats)(nil)
+	_ ExtendedHandler    = (*Stats)(nil)
 )
 
 type (
@@ -32,6 +38,31 @@ type (
 		RemoteMiss uint64
 		Query      uint64
 		QueryFail  uint64
+		// EventDropped and EventCoalesced count the keys of local sync events.
+		EventDropped   uint64
+		EventCoalesced uint64
+		// CompressRaw and CompressStored are the sizes of the values before and after
+		// compression.
+		CompressRaw    uint64
+		CompressStored uint64
+		// Corrupted counts the cached values that failed to decode.
+		Corrupted uint64
+		// Hedges and HedgeWins count the hedged remote reads and the hedges that
+		// answered first.
+		Hedges    uint64
+		HedgeWins uint64
+		// QueryFailClass counts the failed queries per ErrorClass.
+		QueryFailClass [errorClassCount]uint64
+		// BytesRead and BytesWritten count the bytes per Tier.
+		BytesRead    [tierCount]uint64
+		BytesWritten [tierCount]uint64
+		// Refresh and RefreshFail count the refresh tasks that succeeded and failed.
+		Refresh     uint64
+		RefreshFail uint64
+		// Shared counts the loads whose result was shared with concurrent callers.
+		Shared uint64
+
+		latency [tierCount][opCount]Histogram
 	}
 
 	Options struct {
@@ -115,6 +146,70 @@ func (s *Stats) IncrQuery() {
 
 func (s *Stats) IncrQueryFail(err error) {
 	atomic.AddUint64(&s.QueryFail, 1)
+	atomic.AddUint64(&s.QueryFailClass[ClassifyError(err)], 1)
+}
+
+func (s *Stats) IncrEventDropped(n uint64) {
+	atomic.AddUint64(&s.EventDropped, n)
+}
+
+func (s *Stats) IncrEventCoalesced(n uint64) {
+	atomic.AddUint64(&s.EventCoalesced, n)
+}
+
+func (s *Stats) IncrCompression(raw, stored uint64) {
+	atomic.AddUint64(&s.CompressRaw, raw)
+	atomic.AddUint64(&s.CompressStored, stored)
+}
+
+func (s *Stats) IncrCorrupted() {
+	atomic.AddUint64(&s.Corrupted, 1)
+}
+
+func (s *Stats) IncrHedge() {
+	atomic.AddUint64(&s.Hedges, 1)
+}
+
+func (s *Stats) IncrHedgeWin() {
+	atomic.AddUint64(&s.HedgeWins, 1)
+}
+
+func (s *Stats) ObserveLatency(tier Tier, op Op, d time.Duration) {
+	if tier < tierCount && op < opCount {
+		s.latency[tier][op].Observe(d)
+	}
+}
+
+func (s *Stats) AddBytesRead(tier Tier, n uint64) {
+	if tier < tierCount {
+		atomic.AddUint64(&s.BytesRead[tier], n)
+	}
+}
+
+func (s *Stats) AddBytesWritten(tier Tier, n uint64) {
+	if tier < tierCount {
+		atomic.AddUint64(&s.BytesWritten[tier], n)
+	}
+}
+
+func (s *Stats) IncrRefresh() {
+	atomic.AddUint64(&s.Refresh, 1)
+}
+
+func (s *Stats) IncrRefreshFail(err error) {
+	atomic.AddUint64(&s.RefreshFail, 1)
+}
+
+func (s *Stats) IncrShared() {
+	atomic.AddUint64(&s.Shared, 1)
+}
+
+// Latency returns a snapshot of the latency histogram of op on tier.
+func (s *Stats) Latency(tier Tier, op Op) HistogramSnapshot {
+	if tier >= tierCount || op >= opCount {
+		return HistogramSnapshot{}
+	}
+	return s.latency[tier][op].Snapshot()
 }
 
 func (inner *innerStats) statLoop(ticker *time.Ticker) {
@@ -137,6 +232,28 @@ func (inner *innerStats) logStatSummary() {
 			LocalMiss:  atomic.SwapUint64(&s.LocalMiss, 0),
 			Query:      atomic.SwapUint64(&s.Query, 0),
 			QueryFail:  atomic.SwapUint64(&s.QueryFail, 0),
+
+			EventDropped:   atomic.SwapUint64(&s.EventDropped, 0),
+			EventCoalesced: atomic.SwapUint64(&s.EventCoalesced, 0),
+			CompressRaw:    atomic.SwapUint64(&s.CompressRaw, 0),
+			CompressStored: atomic.SwapUint64(&s.CompressStored, 0),
+			Corrupted:      atomic.SwapUint64(&s.Corrupted, 0),
+			Hedges:         atomic.SwapUint64(&s.Hedges, 0),
+			HedgeWins:      atomic.SwapUint64(&s.HedgeWins, 0),
+			Refresh:        atomic.SwapUint64(&s.Refresh, 0),
+			RefreshFail:    atomic.SwapUint64(&s.RefreshFail, 0),
+			Shared:         atomic.SwapUint64(&s.Shared, 0),
+		}
+		for c := range s.QueryFailClass {
+			stats[i].QueryFailClass[c] = atomic.SwapUint64(&s.QueryFailClass[c], 0)
+		}
+		for tier := range s.latency {
+			stats[i].BytesRead[tier] = atomic.SwapUint64(&s.BytesRead[tier], 0)
+			stats[i].BytesWritten[tier] = atomic.SwapUint64(&s.BytesWritten[tier], 0)
+			for op := range s.latency[tier] {
+				snap := s.latency[tier][op].swap()
+				stats[i].latency[tier][op] = Histogram{counts: snap.Counts, sum: uint64(snap.Sum)}
+			}
 		}
 		if len(s.Name) > maxNameLen {
 			maxNameLen = len(s.Name)
@@ -153,10 +270,94 @@ func (inner *innerStats) logStatSummary() {
 		sb.WriteString("\n")
 		sb.WriteString(rows)
 		sb.WriteString(formatSepLine(header))
+		sb.WriteString(formatEvents(stats))
+		sb.WriteString(formatCompression(stats))
+		sb.WriteString(formatLatency(stats))
+		sb.WriteString(formatTraffic(stats))
 		logger.Info(sb.String())
 	}
 }
 
+// formatEvents returns a line per cache that dropped or coalesced sync event keys,
+// and per cache that quarantined corrupted values.
+func formatEvents(stats []Stats) string {
+	var lines strings.Builder
+	for _, s := range stats {
+		if s.EventDropped > 0 || s.EventCoalesced > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s sync events: coalesced %d, dropped %d", s.Name, s.EventCoalesced, s.EventDropped))
+		}
+		if s.Corrupted > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s corrupted values quarantined: %d", s.Name, s.Corrupted))
+		}
+	}
+	return lines.String()
+}
+
+// formatCompression returns a line per cache that compressed values.
+func formatCompression(stats []Stats) string {
+	var lines strings.Builder
+	for _, s := range stats {
+		if s.CompressRaw > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s compression: ratio %.2f, saved %d bytes", s.Name,
+				float64(s.CompressStored)/float64(s.CompressRaw), int64(s.CompressRaw)-int64(s.CompressStored)))
+		}
+	}
+	return lines.String()
+}
+
+// formatLatency returns a line with the percentiles per cache, tier and operation
+// observed.
+func formatLatency(stats []Stats) string {
+	var lines strings.Builder
+	for i := range stats {
+		s := &stats[i]
+		for tier := Tier(0); tier < tierCount; tier++ {
+			for op := Op(0); op < opCount; op++ {
+				snap := s.latency[tier][op].Snapshot()
+				if snap.Count == 0 {
+					continue
+				}
+				lines.WriteString(fmt.Sprintf("\n%s latency %s_%s: count %d, p50 %s, p95 %s, p99 %s",
+					s.Name, tier, op, snap.Count, snap.Quantile(0.5), snap.Quantile(0.95), snap.Quantile(0.99)))
+			}
+		}
+	}
+	return lines.String()
+}
+
+// formatTraffic returns the lines per cache with the bytes read and written per
+// tier, the refresh tasks, the shared loads, the hedged reads and the classes of the
+// failed queries.
+func formatTraffic(stats []Stats) string {
+	var lines strings.Builder
+	for i := range stats {
+		s := &stats[i]
+		var tiers []string
+		for tier := Tier(0); tier < tierCount; tier++ {
+			if s.BytesRead[tier] > 0 || s.BytesWritten[tier] > 0 {
+				tiers = append(tiers, fmt.Sprintf("%s read %d, written %d", tier, s.BytesRead[tier], s.BytesWritten[tier]))
+			}
+		}
+		if len(tiers) > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s bytes: %s", s.Name, strings.Join(tiers, "; ")))
+		}
+		if s.Refresh > 0 || s.RefreshFail > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s refresh: success %d, fail %d", s.Name, s.Refresh, s.RefreshFail))
+		}
+		if s.Shared > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s loads shared: %d", s.Name, s.Shared))
+		}
+		if s.Hedges > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s hedged reads: %d, won %d", s.Name, s.Hedges, s.HedgeWins))
+		}
+		if s.QueryFail > 0 {
+			lines.WriteString(fmt.Sprintf("\n%s query_fail: timeout %d, canceled %d, network %d, other %d", s.Name,
+				s.QueryFailClass[ErrorTimeout], s.QueryFailClass[ErrorCanceled], s.QueryFailClass[ErrorNetwork], s.QueryFailClass[ErrorOther]))
+		}
+	}
+	return lines.String()
+}
+
 func formatHeader(maxLenStr string) string {
 	return fmt.Sprintf("%-"+maxLenStr+"s|%12s|%12s|%12s|%12s|%12s|%12s\n", "cache", "qpm", "hit_ratio", "hit", "miss", "query", "query_fail")
 }
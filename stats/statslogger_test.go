@@ -2,6 +2,7 @@ package stats
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -93,6 +94,53 @@ cache2       |           5|     100.00%|           5|           0|          50|
 	assert.Contains(t, logBuffer.String(), expected)
 }
 
+func TestFormatEvents(t *testing.T) {
+	stats := []Stats{
+		{Name: "cache1", EventCoalesced: 3, EventDropped: 1},
+		{Name: "cache2", Corrupted: 2},
+		{Name: "cache3"},
+	}
+	assert.Equal(t, "\ncache1 sync events: coalesced 3, dropped 1\ncache2 corrupted values quarantined: 2", formatEvents(stats))
+}
+
+func TestFormatCompression(t *testing.T) {
+	stats := []Stats{
+		{Name: "cache1", CompressRaw: 1000, CompressStored: 250},
+		{Name: "cache2"},
+	}
+	assert.Equal(t, "\ncache1 compression: ratio 0.25, saved 750 bytes", formatCompression(stats))
+
+	s := &Stats{Name: "cache1"}
+	s.IncrCompression(100, 40)
+	s.IncrCompression(100, 60)
+	assert.Equal(t, uint64(200), s.CompressRaw)
+	assert.Equal(t, uint64(100), s.CompressStored)
+}
+
+func TestFormatLatency(t *testing.T) {
+	stats := []Stats{{Name: "cache1"}, {Name: "cache2"}}
+	for i := 0; i < 100; i++ {
+		stats[0].ObserveLatency(TierRemote, OpGet, 2*time.Millisecond)
+	}
+	assert.Equal(t, "\ncache1 latency remote_get: count 100, p50 1.75ms, p95 2.425ms, p99 2.485ms", formatLatency(stats))
+}
+
+func TestFormatTraffic(t *testing.T) {
+	stats := []Stats{
+		{Name: "cache1", Refresh: 3, RefreshFail: 1, Shared: 2, Hedges: 5, HedgeWins: 2},
+		{Name: "cache2"},
+	}
+	stats[0].AddBytesRead(TierLocal, 10)
+	stats[0].AddBytesWritten(TierRemote, 20)
+	stats[0].IncrQueryFail(context.DeadlineExceeded)
+	stats[0].IncrQueryFail(errors.New("any"))
+	assert.Equal(t, "\ncache1 bytes: local read 10, written 0; remote read 0, written 20"+
+		"\ncache1 refresh: success 3, fail 1"+
+		"\ncache1 loads shared: 2"+
+		"\ncache1 hedged reads: 5, won 2"+
+		"\ncache1 query_fail: timeout 1, canceled 0, network 0, other 1", formatTraffic(stats))
+}
+
 func TestFormatHeader(t *testing.T) {
 	maxLenStr := "12"
 	expected := fmt.Sprintf("%-12s|%12s|%12s|%12s|%12s|%12s|%12s\n", "cache", "qpm", "hit_ratio", "hit", "miss", "query", "query_fail")
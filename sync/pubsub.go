@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"context"
+	gosync "sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pubSubTransport carries the events on a Redis Pub/Sub channel. The events published
+// while a process is not subscribed are lost to it.
+type pubSubTransport struct {
+	s *Sync
+
+	mu     gosync.Mutex // guards pubsub and closed.
+	pubsub *redis.PubSub
+	closed bool
+}
+
+func (t *pubSubTransport) publish(ctx context.Context, payload []byte) error {
+	return t.s.rdb.Publish(ctx, t.s.channel, payload).Err()
+}
+
+func (t *pubSubTransport) receive(ctx context.Context, resumed bool) (bool, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return false, context.Canceled
+	}
+	pubsub := t.s.rdb.Subscribe(ctx, t.s.channel)
+	t.pubsub = pubsub
+	t.mu.Unlock()
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return false, err
+	}
+	if resumed && t.s.clearOnReconnect {
+		t.s.clear()
+	}
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return true, err
+		}
+		t.s.handle(msg.Payload)
+	}
+}
+
+func (t *pubSubTransport) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.pubsub != nil {
+		_ = t.pubsub.Close()
+	}
+}
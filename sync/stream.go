@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultStreamMaxLen = 10000
+	// streamBlock bounds the wait of a read, hence the time Close waits for it.
+	streamBlock = time.Second
+	streamCount = 100
+	streamField = "event"
+)
+
+// streamTransport carries the events on a Redis stream. A process resumes reading
+// after the last event it read, so it only misses events trimmed from the stream
+// before it read them, whether disconnected or just behind, and then clears its
+// local tiers.
+type streamTransport struct {
+	s      *Sync
+	maxLen int64
+	lastID string // the ID of the last event read, "" until the position is known.
+}
+
+// WithStream carries the events on a Redis stream named by WithChannel instead of
+// Pub/Sub, capped at about maxLen events (default 10000). After a disconnection, a
+// process replays the events it missed. If some were trimmed from the stream, it
+// clears the local tier of the registered caches instead.
+func WithStream(maxLen int64) Option {
+	return func(o *Sync) {
+		if maxLen <= 0 {
+			maxLen = defaultStreamMaxLen
+		}
+		o.transport = &streamTransport{s: o, maxLen: maxLen}
+	}
+}
+
+func (t *streamTransport) publish(ctx context.Context, payload []byte) error {
+	return t.s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.s.channel,
+		MaxLen: t.maxLen,
+		Approx: true,
+		Values: []any{streamField, payload},
+	}).Err()
+}
+
+func (t *streamTransport) receive(ctx context.Context, resumed bool) (bool, error) {
+	if t.lastID == "" {
+		// Start after the last event published before this process.
+		last, err := t.s.rdb.XRevRangeN(ctx, t.s.channel, "+", "-", 1).Result()
+		if err != nil {
+			return false, err
+		}
+		t.lastID = "0-0"
+		if len(last) > 0 {
+			t.lastID = last[0].ID
+		}
+	} else if resumed {
+		missed, err := t.missed(ctx, t.lastID)
+		if err != nil {
+			return false, err
+		}
+		if missed {
+			t.s.clear()
+		}
+	}
+
+	for {
+		streams, err := t.s.rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{t.s.channel, t.lastID},
+			Count:   streamCount,
+			Block:   streamBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return true, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return true, err
+		}
+
+		for _, stream := range streams {
+			// Events are trimmed only past maxLen, so a smaller batch read all the
+			// events after lastID.
+			if n := int64(len(stream.Messages)); n >= min(streamCount, t.maxLen) {
+				missed, err := t.missed(ctx, t.lastID)
+				if err != nil {
+					return true, err
+				}
+				if missed {
+					t.s.clear()
+				}
+			}
+			for _, msg := range stream.Messages {
+				t.lastID = msg.ID
+				if ms, _, ok := parseStreamID(msg.ID); ok {
+					t.s.lag.Store(int64(time.Since(time.UnixMilli(ms))))
+				}
+				if payload, ok := msg.Values[streamField].(string); ok {
+					t.s.handle(payload)
+				}
+			}
+		}
+	}
+}
+
+// missed reports whether events after lastID were trimmed from the stream. Redis 7.0+
+// reports the last trimmed ID. Before, the events after lastID may have been trimmed
+// if lastID was, and the stream can not tell: it reports them missed to be safe.
+func (t *streamTransport) missed(ctx context.Context, lastID string) (bool, error) {
+	info, err := t.s.rdb.XInfoStream(ctx, t.s.channel).Result()
+	if err == nil && info.MaxDeletedEntryID != "" {
+		return compareStreamID(info.MaxDeletedEntryID, lastID) > 0, nil
+	}
+
+	first, err := t.s.rdb.XRangeN(ctx, t.s.channel, "-", "+", 1).Result()
+	if err != nil {
+		return false, err
+	}
+	return len(first) > 0 && compareStreamID(first[0].ID, lastID) > 0, nil
+}
+
+// close does nothing: a blocked read returns within streamBlock.
+func (t *streamTransport) close() {}
+
+// compareStreamID compares two stream IDs "<ms>-<seq>" as -1, 0 or +1.
+func compareStreamID(a, b string) int {
+	aMs, aSeq, _ := parseStreamID(a)
+	bMs, bSeq, _ := parseStreamID(b)
+	switch {
+	case aMs < bMs || aMs == bMs && aSeq < bSeq:
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+func parseStreamID(id string) (ms int64, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil || !found {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq, err == nil
+}
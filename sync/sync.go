@@ -0,0 +1,286 @@
+// Package sync keeps the local tier of caches in several processes consistent, by
+// publishing the events of cache.WithEventHandler on a Redis Pub/Sub channel or
+// stream, and deleting from the local tier the keys changed by other processes.
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	cache "github.com/mgtv-tech/jetcache-go"
+	"github.com/mgtv-tech/jetcache-go/logger"
+	"github.com/mgtv-tech/jetcache-go/util"
+)
+
+const (
+	defaultChannel          = "jetcache:sync"
+	defaultPublishTimeout   = time.Second
+	defaultReconnectBackoff = 5 * time.Second
+	minReconnectBackoff     = 100 * time.Millisecond
+	sourceIDLen             = 16
+)
+
+var errNotApplier = errors.New("sync: cache does not implement cache.EventApplier")
+
+type (
+	// Sync publishes the events of the caches of this process, and applies the events
+	// of the other processes to the local tier of the registered caches.
+	Sync struct {
+		rdb              redis.UniversalClient
+		channel          string
+		sourceID         string
+		publishTimeout   time.Duration
+		reconnectBackoff time.Duration
+		clearOnReconnect bool
+
+		mu     gosync.RWMutex
+		caches map[string][]cache.EventApplier
+
+		transport transport
+		cancel    context.CancelFunc
+		done      chan struct{}
+
+		received atomic.Uint64
+		resyncs  atomic.Uint64
+		lag      atomic.Int64
+	}
+
+	// Stats counts the events received by a Sync.
+	Stats struct {
+		// Received is the number of events received, including those of this process.
+		Received uint64
+		// Resyncs is the number of times the local tiers were cleared, because events
+		// may have been missed.
+		Resyncs uint64
+		// Lag is the time between the publication and the reception of the last event
+		// received from a stream. It is 0 with Pub/Sub.
+		Lag time.Duration
+	}
+
+	// transport carries the events between processes.
+	transport interface {
+		// publish publishes an encoded event.
+		publish(ctx context.Context, payload []byte) error
+		// receive passes the events received to s.handle until ctx is done or it fails.
+		// resumed is true if a previous call received events: the transport must then
+		// resync the local tiers for the events it may have missed. It reports whether
+		// it got to receive events.
+		receive(ctx context.Context, resumed bool) (bool, error)
+		// close stops a blocked receive.
+		close()
+	}
+
+	// Option defines the method to customize a Sync.
+	Option func(o *Sync)
+)
+
+// WithChannel sets the Pub/Sub channel. Default is "jetcache:sync".
+func WithChannel(channel string) Option {
+	return func(o *Sync) {
+		o.channel = channel
+	}
+}
+
+// WithSourceID sets the source id of this process, which must be unique among the
+// processes sharing the channel. Default is a random id.
+func WithSourceID(sourceID string) Option {
+	return func(o *Sync) {
+		o.sourceID = sourceID
+	}
+}
+
+// WithPublishTimeout sets the timeout of publishing an event. Default is 1s.
+func WithPublishTimeout(publishTimeout time.Duration) Option {
+	return func(o *Sync) {
+		o.publishTimeout = publishTimeout
+	}
+}
+
+// WithReconnectBackoff sets the maximum wait between two attempts to subscribe
+// again after a failure. The wait starts at 100ms and doubles. Default is 5s.
+func WithReconnectBackoff(reconnectBackoff time.Duration) Option {
+	return func(o *Sync) {
+		o.reconnectBackoff = reconnectBackoff
+	}
+}
+
+// WithClearOnReconnect clears the local tier of the registered caches after the
+// Pub/Sub subscription is restored, as the events published meanwhile are lost.
+// Default is true; without it, the local tiers may serve stale values until they
+// expire.
+func WithClearOnReconnect(clearOnReconnect bool) Option {
+	return func(o *Sync) {
+		o.clearOnReconnect = clearOnReconnect
+	}
+}
+
+// New creates a Sync and subscribes to its channel in the background. Close it when
+// it is no longer needed.
+func New(rdb redis.UniversalClient, opts ...Option) *Sync {
+	s := &Sync{
+		rdb:              rdb,
+		clearOnReconnect: true,
+		caches:           make(map[string][]cache.EventApplier),
+		done:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.channel == "" {
+		s.channel = defaultChannel
+	}
+	if s.sourceID == "" {
+		s.sourceID = util.NewSafeRand().RandN(sourceIDLen)
+	}
+	if s.publishTimeout <= 0 {
+		s.publishTimeout = defaultPublishTimeout
+	}
+	if s.reconnectBackoff < minReconnectBackoff {
+		s.reconnectBackoff = defaultReconnectBackoff
+	}
+	if s.transport == nil {
+		s.transport = &pubSubTransport{s: s}
+	}
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go s.subscribe(ctx)
+
+	return s
+}
+
+// CacheOptions returns the options making a cache publish its events through s.
+func (s *Sync) CacheOptions() []cache.Option {
+	return []cache.Option{
+		cache.WithSyncLocal(true),
+		cache.WithSourceId(s.sourceID),
+		cache.WithEventHandler(s.Publish),
+	}
+}
+
+// Register applies the events of the caches of the same name, set by
+// cache.WithName, published by other processes to the local tier of c. It fails if
+// c is not a cache.EventApplier, as the caches created by cache.New are.
+func (s *Sync) Register(c cache.Cache) error {
+	applier, ok := c.(cache.EventApplier)
+	if !ok {
+		return fmt.Errorf("%w: %T", errNotApplier, c)
+	}
+
+	name := applier.CacheName()
+	s.mu.Lock()
+	s.caches[name] = append(s.caches[name], applier)
+	s.mu.Unlock()
+	return nil
+}
+
+// Stats returns the counts of events received and local resyncs so far.
+func (s *Sync) Stats() Stats {
+	return Stats{
+		Received: s.received.Load(),
+		Resyncs:  s.resyncs.Load(),
+		Lag:      time.Duration(s.lag.Load()),
+	}
+}
+
+// SourceID returns the source id of this process.
+func (s *Sync) SourceID() string {
+	return s.sourceID
+}
+
+// Publish publishes event. It is meant for cache.WithEventHandler.
+func (s *Sync) Publish(event *cache.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("sync#Publish json.Marshal(%v) error(%v)", event, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.publishTimeout)
+	defer cancel()
+	if err = s.transport.publish(ctx, payload); err != nil {
+		logger.Error("sync#Publish(%s) error(%v)", s.channel, err)
+	}
+}
+
+// Close stops receiving events.
+func (s *Sync) Close() {
+	s.cancel()
+	s.transport.close()
+	<-s.done
+}
+
+// subscribe receives events until ctx is done, again after a failure.
+func (s *Sync) subscribe(ctx context.Context) {
+	defer close(s.done)
+
+	backoff := minReconnectBackoff
+	for resumed := false; ; {
+		received, err := s.transport.receive(ctx, resumed)
+		if received {
+			resumed = true
+			backoff = minReconnectBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn("sync#subscribe(%s) error(%v), retry in %v", s.channel, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, s.reconnectBackoff)
+	}
+}
+
+// handle applies an encoded event.
+func (s *Sync) handle(payload string) {
+	s.received.Add(1)
+
+	var event cache.Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		logger.Error("sync#handle json.Unmarshal(%s) error(%v)", payload, err)
+		return
+	}
+	s.apply(&event)
+}
+
+// apply applies event to the local tier of the caches it concerns, unless this
+// process published it. See cache.EventApplier for stale events.
+func (s *Sync) apply(event *cache.Event) {
+	if event.SourceID == s.sourceID {
+		return
+	}
+
+	s.mu.RLock()
+	caches := s.caches[event.CacheName]
+	s.mu.RUnlock()
+	for _, c := range caches {
+		c.ApplyEvent(event)
+	}
+}
+
+// clear clears the local tier of the registered caches.
+func (s *Sync) clear() {
+	s.resyncs.Add(1)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// A flush all event versioned now also drops the values loaded before.
+	version := time.Now().UnixNano()
+	for name, caches := range s.caches {
+		for _, c := range caches {
+			c.ApplyEvent(&cache.Event{CacheName: name, EventType: cache.EventTypeFlushAll, Version: version})
+		}
+	}
+}
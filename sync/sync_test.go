@@ -0,0 +1,333 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cache "github.com/mgtv-tech/jetcache-go"
+	"github.com/mgtv-tech/jetcache-go/local"
+	"github.com/mgtv-tech/jetcache-go/remote"
+)
+
+const (
+	cacheName = "sync-test"
+	channel   = "sync-test:events"
+)
+
+func TestSync(t *testing.T) {
+	t.Run("PubSub", func(t *testing.T) {
+		testSync(t, func(s *miniredis.Miniredis, payload string) {
+			s.Publish(channel, payload)
+		})
+	})
+	t.Run("Stream", func(t *testing.T) {
+		testSync(t, func(s *miniredis.Miniredis, payload string) {
+			_, _ = s.XAdd(channel, "*", []string{streamField, payload})
+		}, WithStream(0))
+	})
+}
+
+func testSync(t *testing.T, publish func(s *miniredis.Miniredis, payload string), opts ...Option) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	c1, sync1 := newCache(t, s, opts...)
+	c2, sync2 := newCache(t, s, opts...)
+	if len(opts) == 0 {
+		waitSubscribers(t, s, 2)
+	} else {
+		waitStreamReaders(t, s, sync1, sync2)
+	}
+
+	var val string
+	require.Nil(t, c1.Set(ctx, "key1", cache.Value("value1")))
+	require.Nil(t, c2.Get(ctx, "key1", &val))
+	assert.Equal(t, "value1", val)
+
+	// The change of c1 deletes the stale value from the local tier of c2.
+	require.Nil(t, c1.Set(ctx, "key1", cache.Value("value2")))
+	assert.Eventually(t, func() bool {
+		_ = c2.Get(ctx, "key1", &val)
+		return val == "value2"
+	}, time.Second, 10*time.Millisecond)
+
+	// c1 ignores its own event, its local tier still holds the value.
+	localCache, _ := c1.(cache.LocalExtender).LocalExtended()
+	_, ok := localCache.Get("key1")
+	assert.True(t, ok)
+
+	require.Nil(t, c2.Delete(ctx, "key1"))
+	assert.Eventually(t, func() bool {
+		_, ok := localCache.Get("key1")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	// Events of other caches and malformed events are ignored.
+	localCache.Set("key2", []byte("value2"))
+	payload, _ := json.Marshal(&cache.Event{CacheName: "other", SourceID: "other", Keys: []string{"key2"}})
+	publish(s, string(payload))
+	publish(s, "malformed")
+	payload, _ = json.Marshal(&cache.Event{CacheName: cacheName, SourceID: sync1.SourceID(), Keys: []string{"key2"}})
+	publish(s, string(payload))
+	received := sync1.Stats().Received + 3
+	assert.Eventually(t, func() bool {
+		return sync1.Stats().Received == received
+	}, time.Second, 10*time.Millisecond)
+	_, ok = localCache.Get("key2")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), sync1.Stats().Resyncs)
+	// A flush all event clears the local tier.
+	payload, _ = json.Marshal(&cache.Event{CacheName: cacheName, SourceID: "other", EventType: cache.EventTypeFlushAll})
+	publish(s, string(payload))
+	assert.Eventually(t, func() bool {
+		return localCache.Len() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSync_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	c1, _ := newCache(t, s)
+	c2, c2Sync := newCache(t, s, WithReconnectBackoff(200*time.Millisecond))
+	waitSubscribers(t, s, 2)
+
+	require.Nil(t, c2.Set(ctx, "key1", cache.Value("value1")))
+	localCache, _ := c2.(cache.LocalExtender).LocalExtended()
+
+	s.Close()
+	require.Nil(t, s.Restart())
+	waitSubscribers(t, s, 2)
+
+	// The events missed during the outage may have left stale values.
+	_, ok := localCache.Get("key1")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), c2Sync.Stats().Resyncs)
+
+	require.Nil(t, c2.Set(ctx, "key1", cache.Value("value1")))
+	require.Nil(t, c1.Delete(ctx, "key1"))
+	assert.Eventually(t, func() bool {
+		_, ok := localCache.Get("key1")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSync_StreamResume(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	c := cache.New(cache.WithName(cacheName), cache.WithLocal(local.NewLRU(local.MB, time.Minute)))
+	defer c.Close()
+	sync := &Sync{rdb: rdb, channel: channel, sourceID: "sync", caches: map[string][]cache.EventApplier{cacheName: {c.(cache.EventApplier)}}}
+	transport := &streamTransport{s: sync, maxLen: defaultStreamMaxLen}
+
+	event := func(key string) []string {
+		payload, _ := json.Marshal(&cache.Event{CacheName: cacheName, SourceID: "other", Keys: []string{key}})
+		return []string{streamField, string(payload)}
+	}
+	receive := func() {
+		ctx, cancel := context.WithTimeout(ctx, 2*streamBlock)
+		defer cancel()
+		_, _ = transport.receive(ctx, true)
+	}
+	localCache, _ := c.(cache.LocalExtender).LocalExtended()
+	localCache.Set("key1", []byte("value1"))
+	localCache.Set("key2", []byte("value2"))
+
+	// The events after the last one read are replayed.
+	lastID, err := s.XAdd(channel, "*", event("key0"))
+	require.Nil(t, err)
+	_, err = s.XAdd(channel, "*", event("key1"))
+	require.Nil(t, err)
+	transport.lastID = lastID
+	receive()
+
+	_, ok := localCache.Get("key1")
+	assert.False(t, ok)
+	_, ok = localCache.Get("key2")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), sync.Stats().Received)
+	assert.Equal(t, uint64(0), sync.Stats().Resyncs)
+	assert.Greater(t, sync.Stats().Lag, time.Duration(0))
+
+	// When the events after the last one read were trimmed, the local tier is cleared.
+	s.Del(channel)
+	_, err = s.XAdd(channel, "*", event("key3"))
+	require.Nil(t, err)
+	receive()
+
+	_, ok = localCache.Get("key2")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), sync.Stats().Resyncs)
+}
+
+func TestSync_StreamGap(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	c := cache.New(cache.WithName(cacheName), cache.WithLocal(local.NewLRU(local.MB, time.Minute)))
+	defer c.Close()
+	sync := &Sync{rdb: rdb, channel: channel, sourceID: "sync", caches: map[string][]cache.EventApplier{cacheName: {c.(cache.EventApplier)}}}
+	transport := &streamTransport{s: sync, maxLen: 2}
+	localCache, _ := c.(cache.LocalExtender).LocalExtended()
+
+	add := func(n int) (ids []string) {
+		for i := 0; i < n; i++ {
+			id, err := s.XAdd(channel, "*", []string{streamField, "{}"})
+			require.Nil(t, err)
+			ids = append(ids, id)
+		}
+		return
+	}
+	receive := func() {
+		ctx, cancel := context.WithTimeout(ctx, 2*streamBlock)
+		defer cancel()
+		_, _ = transport.receive(ctx, false)
+	}
+
+	// A full batch right after the last event read misses nothing.
+	transport.lastID = add(3)[0]
+	localCache.Set("key1", []byte("value1"))
+	receive()
+	assert.Equal(t, uint64(0), sync.Stats().Resyncs)
+
+	// A connected reader that falls behind maxLen clears the local tier.
+	lastID := transport.lastID
+	add(3)
+	require.Nil(t, rdb.XTrimMaxLen(ctx, channel, 2).Err())
+	transport.lastID = lastID
+	receive()
+	_, ok := localCache.Get("key1")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), sync.Stats().Resyncs)
+
+	// Redis 7.0+ tells a trimmed last event apart from missed events.
+	hook := &xInfoHook{}
+	rdb.AddHook(hook)
+	hook.maxDeleted = transport.lastID
+	missed, err := transport.missed(ctx, transport.lastID)
+	require.Nil(t, err)
+	assert.False(t, missed)
+	hook.maxDeleted = add(1)[0]
+	missed, err = transport.missed(ctx, transport.lastID)
+	require.Nil(t, err)
+	assert.True(t, missed)
+}
+
+func TestSync_StreamMaxLen(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	_, sync := newCache(t, s, WithStream(5))
+
+	for i := 0; i < 20; i++ {
+		sync.Publish(&cache.Event{CacheName: cacheName, EventType: cache.EventTypeDelete, Keys: []string{"key1"}})
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	assert.Eventually(t, func() bool {
+		n, err := rdb.XLen(ctx, channel).Result()
+		return err == nil && n == 5
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCompareStreamID(t *testing.T) {
+	assert.Equal(t, -1, compareStreamID("1-2", "2-1"))
+	assert.Equal(t, -1, compareStreamID("1-1", "1-2"))
+	assert.Equal(t, 0, compareStreamID("1-1", "1-1"))
+	assert.Equal(t, 1, compareStreamID("10-0", "9-5"))
+	assert.Equal(t, 1, compareStreamID("1-10", "1-9"))
+}
+
+func TestNew(t *testing.T) {
+	s := New(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}))
+	defer s.Close()
+
+	assert.Equal(t, defaultChannel, s.channel)
+	assert.Len(t, s.SourceID(), sourceIDLen)
+	assert.Equal(t, defaultPublishTimeout, s.publishTimeout)
+	assert.Equal(t, defaultReconnectBackoff, s.reconnectBackoff)
+	assert.True(t, s.clearOnReconnect)
+	assert.Len(t, s.CacheOptions(), 3)
+
+	s = New(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}), WithClearOnReconnect(false))
+	defer s.Close()
+	assert.False(t, s.clearOnReconnect)
+}
+
+func TestSync_Register(t *testing.T) {
+	s := New(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}))
+	defer s.Close()
+
+	// A Cache other than those of cache.New, e.g. a wrapper, can not apply events.
+	c := cache.New(cache.WithName(cacheName), cache.WithLocal(local.NewLRU(local.MB, time.Minute)))
+	defer c.Close()
+	assert.ErrorIs(t, s.Register(struct{ cache.Cache }{c}), errNotApplier)
+	// The events of c are those of its name.
+	assert.Nil(t, s.Register(c))
+	assert.Len(t, s.caches[cacheName], 1)
+}
+
+func newCache(t *testing.T, s *miniredis.Miniredis, opts ...Option) (cache.Cache, *Sync) {
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	sync := New(rdb, append([]Option{WithChannel(channel)}, opts...)...)
+	c := cache.New(append(sync.CacheOptions(),
+		cache.WithName(cacheName),
+		cache.WithLocal(local.NewLRU(local.MB, time.Minute)),
+		cache.WithRemote(remote.NewGoRedisV9Adapter(rdb)),
+	)...)
+	require.Nil(t, sync.Register(c))
+	t.Cleanup(func() {
+		c.Close()
+		sync.Close()
+	})
+
+	return c, sync
+}
+
+// waitStreamReaders waits for the syncs to read the stream, publishing empty events
+// until they all received one.
+func waitStreamReaders(t *testing.T, s *miniredis.Miniredis, syncs ...*Sync) {
+	require.Eventually(t, func() bool {
+		_, _ = s.XAdd(channel, "*", []string{streamField, "{}"})
+		for _, sync := range syncs {
+			if sync.Stats().Received == 0 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func waitSubscribers(t *testing.T, s *miniredis.Miniredis, n int) {
+	require.Eventually(t, func() bool {
+		return s.PubSubNumSub(channel)[channel] == n
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// xInfoHook answers XINFO STREAM with max-deleted-entry-id, which miniredis does not
+// report.
+type xInfoHook struct {
+	maxDeleted string
+}
+
+func (h *xInfoHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *xInfoHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if xinfo, ok := cmd.(*redis.XInfoStreamCmd); ok {
+			xinfo.SetVal(&redis.XInfoStream{MaxDeletedEntryID: h.maxDeleted})
+			return nil
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *xInfoHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}